@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"product-management/models"
+	services "product-management/services"
+	"product-management/utils"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// loginResponse is returned by a successful login
+type loginResponse struct {
+	Token     string       `json:"token"`
+	ExpiresAt time.Time    `json:"expires_at"`
+	User      *models.User `json:"user"`
+}
+
+// RegisterAuthHandlers sets up the routes for registration and login
+func RegisterAuthHandlers(router *mux.Router, users services.UserRepository, tokens *services.Tokens) {
+	router.HandleFunc("/users", func(w http.ResponseWriter, r *http.Request) {
+		RegisterUserHandler(w, r, users)
+	}).Methods("POST")
+
+	router.HandleFunc("/auth/login", func(w http.ResponseWriter, r *http.Request) {
+		LoginHandler(w, r, users, tokens)
+	}).Methods("POST")
+}
+
+// RegisterUserHandler creates a new user with a hashed password
+func RegisterUserHandler(w http.ResponseWriter, r *http.Request, users services.UserRepository) {
+	var creds models.Credentials
+	if err := json.NewDecoder(r.Body).Decode(&creds); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	if err := services.ValidateCredentials(creds); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	user, err := services.CreateUser(r.Context(), users, creds)
+	if errors.Is(err, services.ErrUsernameTaken) {
+		utils.RespondWithError(w, http.StatusConflict, "Username already taken")
+		return
+	}
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to create user")
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusCreated, user)
+}
+
+// LoginHandler verifies credentials and issues a signed session token
+func LoginHandler(w http.ResponseWriter, r *http.Request, users services.UserRepository, tokens *services.Tokens) {
+	var creds models.Credentials
+	if err := json.NewDecoder(r.Body).Decode(&creds); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	user, err := services.Authenticate(r.Context(), users, creds)
+	if errors.Is(err, services.ErrInvalidCredentials) {
+		utils.RespondWithError(w, http.StatusUnauthorized, "Invalid username or password")
+		return
+	}
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to log in")
+		return
+	}
+
+	token, expiresAt, err := tokens.Issue(user.ID)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to issue token")
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, loginResponse{Token: token, ExpiresAt: expiresAt, User: user})
+}
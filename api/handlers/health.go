@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"net/http"
+	"product-management/health"
+	"product-management/utils"
+
+	"github.com/gorilla/mux"
+)
+
+// readinessResponse is the body of /readyz
+type readinessResponse struct {
+	Status  string   `json:"status"`
+	Ready   bool     `json:"ready"`
+	Failing []string `json:"failing"`
+}
+
+// RegisterHealthHandlers sets up the liveness, readiness and status routes
+func RegisterHealthHandlers(router *mux.Router, checker *health.Checker) {
+	router.HandleFunc("/healthz", HealthzHandler).Methods("GET")
+
+	router.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		ReadyzHandler(w, r, checker)
+	}).Methods("GET")
+
+	router.HandleFunc("/status", func(w http.ResponseWriter, r *http.Request) {
+		StatusHandler(w, r, checker)
+	}).Methods("GET")
+}
+
+// HealthzHandler reports that the process is alive without touching any dependency
+func HealthzHandler(w http.ResponseWriter, r *http.Request) {
+	utils.RespondWithJSON(w, http.StatusOK, map[string]string{"status": health.StatusOK})
+}
+
+// ReadyzHandler answers 200 when the server accepts traffic and every dependency
+// responds, and 503 otherwise
+func ReadyzHandler(w http.ResponseWriter, r *http.Request, checker *health.Checker) {
+	report := checker.Check(r.Context())
+	code := http.StatusOK
+	if report.Status != health.StatusOK {
+		code = http.StatusServiceUnavailable
+	}
+	utils.RespondWithJSON(w, code, readinessResponse{Status: report.Status, Ready: report.Ready, Failing: report.Failing()})
+}
+
+// StatusHandler reports the latency, last error and pool stats of every dependency.
+// It always answers 200 so the details stay readable while the service is down.
+func StatusHandler(w http.ResponseWriter, r *http.Request, checker *health.Checker) {
+	utils.RespondWithJSON(w, http.StatusOK, checker.Check(r.Context()))
+}
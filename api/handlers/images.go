@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"net/http"
+	middleware "product-management/api/middlewear"
+	imageprocessor "product-management/image-processor"
+	"product-management/logging"
+	models "product-management/services"
+	"product-management/utils"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	defaultDeadLetterLimit = 50
+	maxDeadLetterLimit     = 500
+)
+
+// replayResponse reports the outcome of replaying dead-lettered jobs
+type replayResponse struct {
+	Replayed int                       `json:"replayed"`
+	Skipped  int                       `json:"skipped"`
+	Jobs     []imageprocessor.ImageJob `json:"jobs"`
+}
+
+// RegisterImageJobHandlers sets up the routes for image processing status and dead letters
+func RegisterImageJobHandlers(router *mux.Router, products models.ProductRepository, users models.UserRepository, queue imageprocessor.JobQueue, tokens *models.Tokens) {
+	router.Handle("/products/{id}/images/status", middleware.AuthMiddleware(tokens, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		GetImageStatusHandler(w, r, products, users)
+	}))).Methods("GET")
+
+	router.Handle("/admin/image-jobs/dead-letters", middleware.AuthMiddleware(tokens, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ListDeadLettersHandler(w, r, users, queue)
+	}))).Methods("GET")
+
+	router.Handle("/admin/image-jobs/dead-letters/replay", middleware.AuthMiddleware(tokens, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ReplayDeadLettersHandler(w, r, products, users, queue)
+	}))).Methods("POST")
+}
+
+// GetImageStatusHandler returns the processing state of a product's images to its owner or an admin
+func GetImageStatusHandler(w http.ResponseWriter, r *http.Request, products models.ProductRepository, users models.UserRepository) {
+	productID, err := utils.ParseID(mux.Vars(r)["id"])
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid product ID")
+		return
+	}
+
+	userID, ok := requireUserID(w, r)
+	if !ok {
+		return
+	}
+
+	if _, _, err := models.AuthorizeProductMutation(r.Context(), products, users, userID, productID); err != nil {
+		respondWithProductError(w, err, "Failed to retrieve product")
+		return
+	}
+
+	status, err := products.GetImageStatus(r.Context(), productID)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to retrieve image status")
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, status)
+}
+
+// ListDeadLettersHandler lists dead-lettered image jobs without removing them
+func ListDeadLettersHandler(w http.ResponseWriter, r *http.Request, users models.UserRepository, queue imageprocessor.JobQueue) {
+	limit, ok := requireAdminWithLimit(w, r, users)
+	if !ok {
+		return
+	}
+
+	letters, err := queue.ListDeadLetters(limit)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to read dead-lettered jobs")
+		return
+	}
+	if letters == nil {
+		letters = []imageprocessor.DeadLetter{}
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, letters)
+}
+
+// ReplayDeadLettersHandler moves dead-lettered image jobs back onto the work queue
+func ReplayDeadLettersHandler(w http.ResponseWriter, r *http.Request, products models.ProductRepository, users models.UserRepository, queue imageprocessor.JobQueue) {
+	limit, ok := requireAdminWithLimit(w, r, users)
+	if !ok {
+		return
+	}
+
+	replayed, skipped, err := queue.ReplayDeadLetters(r.Context(), limit)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to replay dead-lettered jobs")
+		return
+	}
+
+	for _, job := range replayed {
+		if err := models.RecordJobStatus(r.Context(), products, job, models.ImageStatusPending, nil); err != nil {
+			logging.FromContext(r.Context()).Error("Failed to mark replayed image job as pending", "correlation_id", job.CorrelationID, "error", err)
+		}
+	}
+	if replayed == nil {
+		replayed = []imageprocessor.ImageJob{}
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, replayResponse{Replayed: len(replayed), Skipped: skipped, Jobs: replayed})
+}
+
+// requireAdminWithLimit checks the caller is an admin and parses the limit query parameter
+func requireAdminWithLimit(w http.ResponseWriter, r *http.Request, users models.UserRepository) (int, bool) {
+	userID, ok := requireUserID(w, r)
+	if !ok {
+		return 0, false
+	}
+
+	if _, err := models.RequireAdmin(r.Context(), users, userID); err != nil {
+		respondWithProductError(w, err, "Failed to retrieve user")
+		return 0, false
+	}
+
+	limit := defaultDeadLetterLimit
+	if value := r.URL.Query().Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 || parsed > maxDeadLetterLimit {
+			utils.RespondWithError(w, http.StatusBadRequest, "limit must be between 1 and 500")
+			return 0, false
+		}
+		limit = parsed
+	}
+	return limit, true
+}
@@ -1,100 +1,470 @@
 package handlers
 
 import (
-	"database/sql"
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"net/url"
+	middleware "product-management/api/middlewear"
+	imageprocessor "product-management/image-processor"
+	"product-management/logging"
 	models "product-management/services"
+	"product-management/storage"
 	"product-management/utils"
+	"strconv"
+	"strings"
 
-	"github.com/go-redis/redis/v8"
 	"github.com/gorilla/mux"
 )
 
 // RegisterProductHandlers sets up the routes for the product API
-func RegisterProductHandlers(router *mux.Router, db *sql.DB, cache *redis.Client) {
-	router.HandleFunc("/products", func(w http.ResponseWriter, r *http.Request) {
-		CreateProductHandler(w, r, db, cache)
-	}).Methods("POST")
+func RegisterProductHandlers(router *mux.Router, products models.ProductRepository, users models.UserRepository, cache *models.ProductCache, queue imageprocessor.JobQueue, store storage.ObjectStore, tokens *models.Tokens) {
+	router.Handle("/products", middleware.AuthMiddleware(tokens, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		CreateProductHandler(w, r, products, cache, queue, store)
+	}))).Methods("POST")
+
+	// Registered before /products/{id} so "search" is not taken for a product ID
+	router.HandleFunc("/products/search", func(w http.ResponseWriter, r *http.Request) {
+		SearchProductsHandler(w, r, products)
+	}).Methods("GET")
 
 	router.HandleFunc("/products/{id}", func(w http.ResponseWriter, r *http.Request) {
-		GetProductHandler(w, r, db, cache)
+		GetProductHandler(w, r, products, cache)
 	}).Methods("GET")
 
 	router.HandleFunc("/products", func(w http.ResponseWriter, r *http.Request) {
-		GetProductsHandler(w, r, db)
+		GetProductsHandler(w, r, products)
 	}).Methods("GET")
+
+	router.Handle("/products/{id}", middleware.AuthMiddleware(tokens, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		UpdateProductHandler(w, r, products, users, cache, queue, store)
+	}))).Methods("PUT")
+
+	router.Handle("/products/{id}", middleware.AuthMiddleware(tokens, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		PatchProductHandler(w, r, products, users, cache, queue, store)
+	}))).Methods("PATCH")
+
+	router.Handle("/products/{id}", middleware.AuthMiddleware(tokens, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		DeleteProductHandler(w, r, products, users, cache)
+	}))).Methods("DELETE")
+
+	router.Handle("/products/{id}/images/process", middleware.AuthMiddleware(tokens, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ProcessProductImagesHandler(w, r, products, users, queue)
+	}))).Methods("POST")
 }
 
-// CreateProductHandler handles product creation
-func CreateProductHandler(w http.ResponseWriter, r *http.Request, db *sql.DB, cache *redis.Client) {
+// CreateProductHandler handles product creation for the authenticated user
+func CreateProductHandler(w http.ResponseWriter, r *http.Request, products models.ProductRepository, cache *models.ProductCache, queue imageprocessor.JobQueue, store storage.ObjectStore) {
+	userID, ok := requireUserID(w, r)
+	if !ok {
+		return
+	}
+
 	var product models.Product
 	if err := json.NewDecoder(r.Body).Decode(&product); err != nil {
 		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
 		return
 	}
+	// The owner always comes from the session, never from the request body
+	product.UserID = userID
+	if !checkUploadedImages(w, store, userID, nil, product.ProductImages) {
+		return
+	}
 	// Save product to DB
-	if err := product.Save(db); err != nil {
+	if err := products.Create(r.Context(), &product); err != nil {
 		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to save product")
 		return
 	}
 
-	// Queue image processing
-	// services.QueueImageProcessing(product.ProductImages)
+	// Queue image processing; the product is already saved, so a queue outage is logged rather than failing the request
+	if err := models.QueueImageProcessing(r.Context(), products, queue, product.ID, product.ProductImages); err != nil {
+		logging.FromContext(r.Context()).Error("Failed to queue images", "product_id", product.ID, "error", err)
+	}
 
 	utils.RespondWithJSON(w, http.StatusCreated, product)
 }
 
 // GetProductHandler fetches a product by ID
-func GetProductHandler(w http.ResponseWriter, r *http.Request, db *sql.DB, cache *redis.Client) {
-	id := mux.Vars(r)["id"]
-
-	// Fetch from DB if not found in cache
-	product, err := models.GetProductByID(db, id)
+func GetProductHandler(w http.ResponseWriter, r *http.Request, products models.ProductRepository, cache *models.ProductCache) {
+	id, err := utils.ParseID(mux.Vars(r)["id"])
 	if err != nil {
-		utils.RespondWithError(w, http.StatusNotFound, "Product not found")
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid product ID")
 		return
 	}
 
-	// Cache the result for future use
-	// services.CacheProduct(cache, product)
+	// Read through the cache, falling back to the DB on a miss
+	product, err := models.GetProductCached(r.Context(), products, cache, id)
+	if errors.Is(err, models.ErrProductNotFound) {
+		utils.RespondWithError(w, http.StatusNotFound, "Product not found")
+		return
+	}
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to retrieve product")
+		return
+	}
 
 	utils.RespondWithJSON(w, http.StatusOK, product)
 }
 
-// GetProductsHandler retrieves all products with optional filtering
-func GetProductsHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
-	userID := r.URL.Query().Get("user_id")
-	priceMin := r.URL.Query().Get("price_min")
-	priceMax := r.URL.Query().Get("price_max")
+// GetProductsHandler retrieves one page of products with optional filtering and sorting
+func GetProductsHandler(w http.ResponseWriter, r *http.Request, products models.ProductRepository) {
+	query := r.URL.Query()
+
+	page, err := models.ParsePageRequest(query.Get("limit"), query.Get("sort"), query.Get("order"), query.Get("cursor"))
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	filter, err := parseProductFilter(query)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// Get products from DB
+	list, err := products.List(r.Context(), filter, page)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to retrieve products: %v", err))
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, list)
+}
+
+// SearchProductsHandler runs a full-text search over product names and descriptions,
+// narrowed by the same filters as GetProductsHandler
+func SearchProductsHandler(w http.ResponseWriter, r *http.Request, products models.ProductRepository) {
+	query := r.URL.Query()
+	if strings.TrimSpace(query.Get("q")) == "" {
+		utils.RespondWithError(w, http.StatusBadRequest, "Missing search query q")
+		return
+	}
+
+	page, err := models.ParseSearchPageRequest(query.Get("limit"), query.Get("sort"), query.Get("order"), query.Get("cursor"))
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	filter, err := parseProductFilter(query)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	results, err := products.Search(r.Context(), filter, page)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to search products")
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, results)
+}
+
+// parseProductFilter reads the optional list filters from the query string
+func parseProductFilter(query url.Values) (models.ProductFilter, error) {
+	var filter models.ProductFilter
+
+	if value := query.Get("user_id"); value != "" {
+		userID, err := utils.ParseID(value)
+		if err != nil {
+			return filter, errors.New("Invalid user_id filter")
+		}
+		filter.UserID = userID
+	}
 
 	// Parse the price filters as floats if present
-	var minPrice, maxPrice float64
-	var err error
+	if value := query.Get("price_min"); value != "" {
+		minPrice, err := utils.ParsePrice(value)
+		if err != nil || minPrice < 0 {
+			return filter, errors.New("Invalid price_min filter")
+		}
+		filter.MinPrice = &minPrice
+	}
+	if value := query.Get("price_max"); value != "" {
+		maxPrice, err := utils.ParsePrice(value)
+		if err != nil || maxPrice < 0 {
+			return filter, errors.New("Invalid price_max filter")
+		}
+		filter.MaxPrice = &maxPrice
+	}
+	if filter.MinPrice != nil && filter.MaxPrice != nil && *filter.MinPrice > *filter.MaxPrice {
+		return filter, errors.New("price_min must not exceed price_max")
+	}
+
+	filter.NameContains = strings.TrimSpace(query.Get("name"))
 
-	if priceMin != "" {
-		minPrice, err = utils.ParsePrice(priceMin)
+	if value := query.Get("has_images"); value != "" {
+		hasImages, err := strconv.ParseBool(value)
 		if err != nil {
-			utils.RespondWithError(w, http.StatusBadRequest, "Invalid price_min filter")
-			return
+			return filter, errors.New("Invalid has_images filter")
 		}
+		filter.HasImages = &hasImages
 	}
 
-	if priceMax != "" {
-		maxPrice, err = utils.ParsePrice(priceMax)
+	if value := query.Get("created_after"); value != "" {
+		createdAfter, err := utils.ParseTime(value)
 		if err != nil {
-			utils.RespondWithError(w, http.StatusBadRequest, "Invalid price_max filter")
-			return
+			return filter, errors.New("Invalid created_after filter")
+		}
+		filter.CreatedAfter = &createdAfter
+	}
+	if value := query.Get("created_before"); value != "" {
+		createdBefore, err := utils.ParseTime(value)
+		if err != nil {
+			return filter, errors.New("Invalid created_before filter")
 		}
+		filter.CreatedBefore = &createdBefore
 	}
 
-	// Get products from DB
-	products, err := models.GetProducts(db, userID, minPrice, maxPrice)
+	if value := query.Get("ids"); value != "" {
+		for _, part := range strings.Split(value, ",") {
+			id, err := utils.ParseID(part)
+			if err != nil {
+				return filter, errors.New("Invalid ids filter")
+			}
+			filter.IDs = append(filter.IDs, id)
+		}
+		if len(filter.IDs) > models.MaxPageLimit {
+			return filter, fmt.Errorf("ids accepts at most %d values", models.MaxPageLimit)
+		}
+	}
+
+	if value := query.Get("q"); value != "" {
+		search, err := models.ParseSearchQuery(value)
+		if err != nil {
+			return filter, err
+		}
+		filter.Search = search
+	}
+
+	return filter, nil
+}
+
+// UpdateProductHandler replaces every mutable field of a product the caller may modify
+func UpdateProductHandler(w http.ResponseWriter, r *http.Request, products models.ProductRepository, users models.UserRepository, cache *models.ProductCache, queue imageprocessor.JobQueue, store storage.ObjectStore) {
+	productID, err := utils.ParseID(mux.Vars(r)["id"])
 	if err != nil {
-		utils.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to retrieve products: %v", err))
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid product ID")
+		return
+	}
+
+	userID, ok := requireUserID(w, r)
+	if !ok {
+		return
+	}
+
+	var product models.Product
+	if err := json.NewDecoder(r.Body).Decode(&product); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	if product.ID != 0 && product.ID != productID {
+		utils.RespondWithError(w, http.StatusBadRequest, "Product ID in body does not match URL")
+		return
+	}
+	product.ID = productID
+
+	existing, caller, err := models.AuthorizeProductMutation(r.Context(), products, users, userID, productID)
+	if err != nil {
+		respondWithProductError(w, err, "Failed to retrieve product")
+		return
+	}
+
+	// An omitted user_id keeps the current owner
+	if product.UserID == 0 {
+		product.UserID = existing.UserID
+	}
+	if err := models.CanAssignOwner(caller, existing, product.UserID); err != nil {
+		respondWithProductError(w, err, "Failed to update product")
+		return
+	}
+	if !checkUploadedImages(w, store, userID, existing.ProductImages, product.ProductImages) {
+		return
+	}
+
+	if err := products.Update(r.Context(), &product); err != nil {
+		respondWithProductError(w, err, "Failed to update product")
+		return
+	}
+	invalidateProduct(r.Context(), cache, product.ID)
+	queueAddedImages(r.Context(), products, queue, existing.ProductImages, &product)
+
+	utils.RespondWithJSON(w, http.StatusOK, product)
+}
+
+// PatchProductHandler applies a JSON merge patch (RFC 7396) to a product the caller may modify
+func PatchProductHandler(w http.ResponseWriter, r *http.Request, products models.ProductRepository, users models.UserRepository, cache *models.ProductCache, queue imageprocessor.JobQueue, store storage.ObjectStore) {
+	productID, err := utils.ParseID(mux.Vars(r)["id"])
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid product ID")
+		return
+	}
+
+	userID, ok := requireUserID(w, r)
+	if !ok {
+		return
+	}
+
+	patch, err := io.ReadAll(r.Body)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	existing, caller, err := models.AuthorizeProductMutation(r.Context(), products, users, userID, productID)
+	if err != nil {
+		respondWithProductError(w, err, "Failed to retrieve product")
+		return
+	}
+
+	original, err := json.Marshal(existing)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to encode product")
+		return
+	}
+
+	merged, err := utils.MergePatch(original, patch)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid merge patch")
+		return
+	}
+
+	var product models.Product
+	decoder := json.NewDecoder(bytes.NewReader(merged))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&product); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, fmt.Sprintf("Invalid merge patch: %v", err))
+		return
+	}
+	if product.ID != productID {
+		utils.RespondWithError(w, http.StatusBadRequest, "Product ID cannot be changed")
+		return
+	}
+
+	// Removing user_id keeps the current owner
+	if product.UserID == 0 {
+		product.UserID = existing.UserID
+	}
+	if err := models.CanAssignOwner(caller, existing, product.UserID); err != nil {
+		respondWithProductError(w, err, "Failed to update product")
+		return
+	}
+	if !checkUploadedImages(w, store, userID, existing.ProductImages, product.ProductImages) {
+		return
+	}
+
+	if err := products.Update(r.Context(), &product); err != nil {
+		respondWithProductError(w, err, "Failed to update product")
 		return
 	}
+	invalidateProduct(r.Context(), cache, product.ID)
+	queueAddedImages(r.Context(), products, queue, existing.ProductImages, &product)
+
+	utils.RespondWithJSON(w, http.StatusOK, product)
+}
 
-	utils.RespondWithJSON(w, http.StatusOK, products)
+// DeleteProductHandler removes a product the caller may modify
+func DeleteProductHandler(w http.ResponseWriter, r *http.Request, products models.ProductRepository, users models.UserRepository, cache *models.ProductCache) {
+	productID, err := utils.ParseID(mux.Vars(r)["id"])
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid product ID")
+		return
+	}
+
+	userID, ok := requireUserID(w, r)
+	if !ok {
+		return
+	}
+
+	if _, _, err := models.AuthorizeProductMutation(r.Context(), products, users, userID, productID); err != nil {
+		respondWithProductError(w, err, "Failed to retrieve product")
+		return
+	}
+
+	if err := products.Delete(r.Context(), productID); err != nil {
+		respondWithProductError(w, err, "Failed to delete product")
+		return
+	}
+	invalidateProduct(r.Context(), cache, productID)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ProcessProductImagesHandler re-queues every image of a product the caller may modify
+func ProcessProductImagesHandler(w http.ResponseWriter, r *http.Request, products models.ProductRepository, users models.UserRepository, queue imageprocessor.JobQueue) {
+	productID, err := utils.ParseID(mux.Vars(r)["id"])
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid product ID")
+		return
+	}
+
+	userID, ok := requireUserID(w, r)
+	if !ok {
+		return
+	}
+
+	product, _, err := models.AuthorizeProductMutation(r.Context(), products, users, userID, productID)
+	if err != nil {
+		respondWithProductError(w, err, "Failed to retrieve product")
+		return
+	}
+
+	if err := models.QueueImageProcessing(r.Context(), products, queue, product.ID, product.ProductImages); err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to queue image processing")
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusAccepted, map[string]int{"queued": len(product.ProductImages)})
+}
+
+// queueAddedImages queues the images of an updated product that are new or have
+// moved, as their renditions were dropped. The product is already saved, so a
+// queue outage is logged rather than failing the request.
+func queueAddedImages(ctx context.Context, products models.ProductRepository, queue imageprocessor.JobQueue, previous []string, product *models.Product) {
+	for index, imageURL := range product.ProductImages {
+		if index < len(previous) && previous[index] == imageURL {
+			continue
+		}
+		if err := models.QueueImage(ctx, products, queue, product.ID, index, imageURL); err != nil {
+			logging.FromContext(ctx).Error("Failed to queue image", "product_id", product.ID, "image_index", index, "error", err)
+			return
+		}
+	}
+}
+
+// invalidateProduct drops a changed product from the cache; a failure only risks
+// serving stale data until the TTL expires, so it is logged rather than returned
+func invalidateProduct(ctx context.Context, cache *models.ProductCache, id int) {
+	if err := models.InvalidateProduct(ctx, cache, id); err != nil {
+		logging.FromContext(ctx).Warn("Failed to invalidate cached product", "product_id", id, "error", err)
+	}
+}
+
+// requireUserID returns the authenticated caller or responds with 401
+func requireUserID(w http.ResponseWriter, r *http.Request) (int, bool) {
+	userID, ok := middleware.UserIDFromContext(r.Context())
+	if !ok {
+		utils.RespondWithError(w, http.StatusUnauthorized, "Authentication required")
+	}
+	return userID, ok
+}
+
+// respondWithProductError maps a services error to 401, 403, 404 or 500
+func respondWithProductError(w http.ResponseWriter, err error, message string) {
+	switch {
+	case errors.Is(err, models.ErrUserNotFound):
+		utils.RespondWithError(w, http.StatusUnauthorized, "Authentication required")
+	case errors.Is(err, models.ErrForbidden):
+		utils.RespondWithError(w, http.StatusForbidden, "You do not have permission to perform this action")
+	case errors.Is(err, models.ErrProductNotFound):
+		utils.RespondWithError(w, http.StatusNotFound, "Product not found")
+	default:
+		utils.RespondWithError(w, http.StatusInternalServerError, message)
+	}
 }
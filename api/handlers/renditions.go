@@ -0,0 +1,187 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	imageprocessor "product-management/image-processor"
+	"product-management/logging"
+	models "product-management/services"
+	"product-management/storage"
+	"product-management/utils"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// renditionCacheControl lets clients and CDNs keep a served rendition for a day
+const renditionCacheControl = "public, max-age=86400"
+
+// RegisterRenditionHandlers sets up the route serving product image renditions.
+// Without a store, requests are redirected to the rendition's stored URL.
+func RegisterRenditionHandlers(router *mux.Router, products models.ProductRepository, cache *models.ProductCache, store storage.ObjectStore) {
+	router.HandleFunc("/products/{id}/images/{index:[0-9]+}/{rendition}", func(w http.ResponseWriter, r *http.Request) {
+		ServeRenditionHandler(w, r, products, cache, store)
+	}).Methods("GET")
+}
+
+// ServeRenditionHandler answers with a rendition of a product image in the format
+// the client's Accept header prefers
+func ServeRenditionHandler(w http.ResponseWriter, r *http.Request, products models.ProductRepository, cache *models.ProductCache, store storage.ObjectStore) {
+	vars := mux.Vars(r)
+	productID, err := utils.ParseID(vars["id"])
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid product ID")
+		return
+	}
+	index, err := strconv.Atoi(vars["index"])
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid image index")
+		return
+	}
+
+	product, err := models.GetProductCached(r.Context(), products, cache, productID)
+	if errors.Is(err, models.ErrProductNotFound) {
+		utils.RespondWithError(w, http.StatusNotFound, "Product not found")
+		return
+	}
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to retrieve product")
+		return
+	}
+	if index >= len(product.Images) {
+		utils.RespondWithError(w, http.StatusNotFound, "Image not found")
+		return
+	}
+	rendition, ok := product.Images[index].Renditions[vars["rendition"]]
+	if !ok {
+		// Also the case while the image is still being processed
+		utils.RespondWithError(w, http.StatusNotFound, "Rendition not found")
+		return
+	}
+
+	// The answer depends on Accept, so shared caches must key on it
+	w.Header().Add("Vary", "Accept")
+	encodings := rendition.Encodings()
+	format, ok := negotiateFormat(r.Header.Get("Accept"), encodings)
+	if !ok {
+		utils.RespondWithError(w, http.StatusNotAcceptable, "Rendition is available as "+strings.Join(sortedFormats(encodings), ", "))
+		return
+	}
+	encoding := encodings[format]
+
+	if store == nil {
+		http.Redirect(w, r, encoding.URL, http.StatusFound)
+		return
+	}
+	body, info, err := store.Get(r.Context(), encoding.Key)
+	if errors.Is(err, storage.ErrNotFound) {
+		utils.RespondWithError(w, http.StatusNotFound, "Rendition not found")
+		return
+	}
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to read rendition")
+		return
+	}
+	defer body.Close()
+
+	w.Header().Set("Content-Type", imageprocessor.ContentType(format))
+	w.Header().Set("Cache-Control", renditionCacheControl)
+	if info.Size > 0 {
+		w.Header().Set("Content-Length", strconv.FormatInt(info.Size, 10))
+	}
+	if !info.ModTime.IsZero() {
+		w.Header().Set("Last-Modified", info.ModTime.UTC().Format(http.TimeFormat))
+	}
+	w.WriteHeader(http.StatusOK)
+	if _, err := io.Copy(w, body); err != nil {
+		logging.FromContext(r.Context()).Warn("Failed to send rendition", "key", encoding.Key, "error", err)
+	}
+}
+
+// negotiateFormat picks the stored format to serve for an Accept header: the one
+// the client rates highest and, among equally rated ones, the smallest. It reports
+// false when the client accepts none of them.
+func negotiateFormat(accept string, encodings map[string]imageprocessor.Encoding) (string, bool) {
+	ranges := parseAccept(accept)
+	best, bestQ, bestBytes := "", 0.0, 0
+	for _, format := range sortedFormats(encodings) {
+		q := acceptQuality(ranges, imageprocessor.ContentType(format))
+		bytes := encodings[format].Bytes
+		if q > bestQ || (q == bestQ && q > 0 && bytes < bestBytes) {
+			best, bestQ, bestBytes = format, q, bytes
+		}
+	}
+	return best, bestQ > 0
+}
+
+// sortedFormats lists the stored formats in a stable order
+func sortedFormats(encodings map[string]imageprocessor.Encoding) []string {
+	var formats []string
+	for format := range encodings {
+		formats = append(formats, format)
+	}
+	sort.Strings(formats)
+	return formats
+}
+
+// mediaRange is one entry of an Accept header
+type mediaRange struct {
+	mediaType string
+	q         float64
+}
+
+// parseAccept reads the media ranges of an Accept header. An empty header accepts
+// everything; entries with an unparseable quality are ignored.
+func parseAccept(accept string) []mediaRange {
+	if strings.TrimSpace(accept) == "" {
+		return []mediaRange{{mediaType: "*/*", q: 1}}
+	}
+
+	var ranges []mediaRange
+	for _, entry := range strings.Split(accept, ",") {
+		params := strings.Split(entry, ";")
+		mr := mediaRange{mediaType: strings.ToLower(strings.TrimSpace(params[0])), q: 1}
+		valid := mr.mediaType != ""
+		for _, param := range params[1:] {
+			key, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+			if strings.ToLower(strings.TrimSpace(key)) != "q" {
+				continue
+			}
+			q, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+			if err != nil || q < 0 || q > 1 {
+				valid = false
+			}
+			mr.q = q
+		}
+		if valid {
+			ranges = append(ranges, mr)
+		}
+	}
+	return ranges
+}
+
+// acceptQuality returns the quality the most specific matching range gives
+// mediaType, or 0 when no range matches
+func acceptQuality(ranges []mediaRange, mediaType string) float64 {
+	q, specificity := 0.0, -1
+	for _, mr := range ranges {
+		var s int
+		switch {
+		case mr.mediaType == mediaType:
+			s = 2
+		case strings.HasSuffix(mr.mediaType, "/*") && strings.HasPrefix(mediaType, strings.TrimSuffix(mr.mediaType, "*")):
+			s = 1
+		case mr.mediaType == "*/*":
+			s = 0
+		default:
+			continue
+		}
+		if s > specificity {
+			q, specificity = mr.q, s
+		}
+	}
+	return q
+}
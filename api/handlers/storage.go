@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"product-management/logging"
+	"product-management/storage"
+	"product-management/utils"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+// RegisterStorageHandlers serves the objects of a local or memory store under
+// /storage and accepts the uploads its signed links allow. Stores that check
+// their own signatures, such as S3, get no routes.
+func RegisterStorageHandlers(router *mux.Router, store storage.ObjectStore, maxBytes int64) {
+	verifier, ok := store.(storage.Verifier)
+	if !ok {
+		return
+	}
+
+	router.HandleFunc("/storage/{key:.+}", func(w http.ResponseWriter, r *http.Request) {
+		GetObjectHandler(w, r, store)
+	}).Methods("GET")
+
+	router.HandleFunc("/storage/{key:.+}", func(w http.ResponseWriter, r *http.Request) {
+		PutSignedObjectHandler(w, r, store, verifier, maxBytes)
+	}).Methods("PUT")
+}
+
+// GetObjectHandler streams a stored object; object URLs are public, as in a bucket
+// with a public-read ACL
+func GetObjectHandler(w http.ResponseWriter, r *http.Request, store storage.ObjectStore) {
+	key := mux.Vars(r)["key"]
+	body, info, err := store.Get(r.Context(), key)
+	if errors.Is(err, storage.ErrNotFound) || errors.Is(err, storage.ErrInvalidKey) {
+		utils.RespondWithError(w, http.StatusNotFound, "Object not found")
+		return
+	}
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to read object")
+		return
+	}
+	defer body.Close()
+
+	if info.ContentType != "" {
+		w.Header().Set("Content-Type", info.ContentType)
+	}
+	if info.Size > 0 {
+		w.Header().Set("Content-Length", strconv.FormatInt(info.Size, 10))
+	}
+	if !info.ModTime.IsZero() {
+		w.Header().Set("Last-Modified", info.ModTime.UTC().Format(http.TimeFormat))
+	}
+	w.WriteHeader(http.StatusOK)
+	if _, err := io.Copy(w, body); err != nil {
+		logging.FromContext(r.Context()).Warn("Failed to send object", "key", key, "error", err)
+	}
+}
+
+// PutSignedObjectHandler stores the body of a PUT made through a link handed out
+// by the store's SignedURL or SignedUploadURL. Bodies over maxBytes, or of another
+// size than the link was signed for, are refused.
+func PutSignedObjectHandler(w http.ResponseWriter, r *http.Request, store storage.ObjectStore, verifier storage.Verifier, maxBytes int64) {
+	key := mux.Vars(r)["key"]
+	if err := verifier.Verify(key, http.MethodPut, r.URL.Query()); err != nil {
+		utils.RespondWithError(w, http.StatusForbidden, "Invalid or expired upload link")
+		return
+	}
+
+	limit := maxBytes
+	if size, ok := storage.SignedSize(r.URL.Query()); ok {
+		if r.ContentLength != size {
+			utils.RespondWithError(w, http.StatusBadRequest, fmt.Sprintf("Content-Length must be %d", size))
+			return
+		}
+		limit = min(limit, size)
+	}
+
+	body := http.MaxBytesReader(w, r.Body, limit)
+	err := store.Put(r.Context(), key, body, r.Header.Get("Content-Type"))
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.As(err, &tooLarge):
+		deleteUpload(r.Context(), store, key)
+		utils.RespondWithError(w, http.StatusRequestEntityTooLarge, "Request body is too large")
+		return
+	case errors.Is(err, storage.ErrInvalidKey):
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid object key")
+		return
+	case err != nil:
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to store object")
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
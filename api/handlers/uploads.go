@@ -0,0 +1,372 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	middleware "product-management/api/middlewear"
+	"product-management/config"
+	imageprocessor "product-management/image-processor"
+	"product-management/logging"
+	models "product-management/services"
+	"product-management/storage"
+	"product-management/utils"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	// maxUploadFiles caps the images one multipart request may carry
+	maxUploadFiles = 10
+	// uploadSniffBytes is how much of an upload is buffered to check its header
+	// before it is streamed to the store
+	uploadSniffBytes = 1 << 20
+	// uploadURLTTL is how long a presigned upload link stays valid
+	uploadURLTTL = 15 * time.Minute
+)
+
+// presignRequest asks for a link to upload one image straight to the store
+type presignRequest struct {
+	ContentType string `json:"content_type"`
+	// Size is the image's size in bytes; the link allows no other
+	Size int64 `json:"size"`
+}
+
+// presignedUpload tells the client how to upload an image straight to the store
+// and which key to report once it has
+type presignedUpload struct {
+	Key       string `json:"key"`
+	UploadURL string `json:"upload_url"`
+	Method    string `json:"method"`
+	// Headers must be sent with the upload for the store to accept it
+	Headers   map[string]string `json:"headers"`
+	MaxBytes  int64             `json:"max_bytes"`
+	ExpiresAt time.Time         `json:"expires_at"`
+}
+
+// completeUploadRequest reports an image uploaded through a presigned link
+type completeUploadRequest struct {
+	Key string `json:"key"`
+}
+
+// RegisterUploadHandlers sets up the routes that add uploaded images to products,
+// either sent through the API or uploaded straight to the store
+func RegisterUploadHandlers(router *mux.Router, products models.ProductRepository, users models.UserRepository, cache *models.ProductCache, queue imageprocessor.JobQueue, store storage.ObjectStore, imagecfg config.ImageConfig, tokens *models.Tokens) {
+	router.Handle("/products/{id}/images", middleware.AuthMiddleware(tokens, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		UploadProductImagesHandler(w, r, products, users, cache, queue, store, imagecfg)
+	}))).Methods("POST")
+
+	router.Handle("/products/{id}/images/uploads", middleware.AuthMiddleware(tokens, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		PresignImageUploadHandler(w, r, products, users, store, imagecfg)
+	}))).Methods("POST")
+
+	router.Handle("/products/{id}/images/uploads/complete", middleware.AuthMiddleware(tokens, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		CompleteImageUploadHandler(w, r, products, users, cache, queue, store, imagecfg)
+	}))).Methods("POST")
+}
+
+// UploadProductImagesHandler streams the images in the image fields of a
+// multipart/form-data body to the store, adds them to the product and queues
+// them for processing
+func UploadProductImagesHandler(w http.ResponseWriter, r *http.Request, products models.ProductRepository, users models.UserRepository, cache *models.ProductCache, queue imageprocessor.JobQueue, store storage.ObjectStore, imagecfg config.ImageConfig) {
+	product, userID, ok := authorizeUpload(w, r, products, users, store)
+	if !ok {
+		return
+	}
+	productID := product.ID
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxUploadFiles*imagecfg.MaxBytes+uploadSniffBytes)
+	reader, err := r.MultipartReader()
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Expected a multipart/form-data body")
+		return
+	}
+
+	added := 0
+	for {
+		part, err := reader.NextPart()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			utils.RespondWithError(w, http.StatusRequestEntityTooLarge, "Request body is too large")
+			return
+		}
+		if err != nil {
+			utils.RespondWithError(w, http.StatusBadRequest, "Invalid multipart body")
+			return
+		}
+		// Other fields are skipped; NextPart discards whatever was not read
+		if part.FormName() != "image" {
+			continue
+		}
+		if added == maxUploadFiles {
+			utils.RespondWithError(w, http.StatusBadRequest, fmt.Sprintf("At most %d images can be uploaded at once", maxUploadFiles))
+			return
+		}
+
+		key, err := streamUpload(r.Context(), store, userID, productID, part, imagecfg)
+		if err != nil {
+			respondWithUploadError(w, err, "Failed to store image")
+			return
+		}
+		if err := addUploadedImage(r.Context(), products, cache, queue, productID, store.URL(key)); err != nil {
+			deleteUpload(r.Context(), store, key)
+			respondWithProductError(w, err, "Failed to add image")
+			return
+		}
+		added++
+	}
+	if added == 0 {
+		utils.RespondWithError(w, http.StatusBadRequest, "Missing image field")
+		return
+	}
+
+	respondWithProduct(w, r, products, productID)
+}
+
+// PresignImageUploadHandler hands out a link to upload one image of the given
+// content type and size straight to the store
+func PresignImageUploadHandler(w http.ResponseWriter, r *http.Request, products models.ProductRepository, users models.UserRepository, store storage.ObjectStore, imagecfg config.ImageConfig) {
+	product, userID, ok := authorizeUpload(w, r, products, users, store)
+	if !ok {
+		return
+	}
+
+	var req presignRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	format, ok := imageprocessor.UploadFormat(req.ContentType)
+	if !ok {
+		utils.RespondWithError(w, http.StatusBadRequest, "content_type must be image/jpeg, image/png, image/gif or image/webp")
+		return
+	}
+	if req.Size <= 0 {
+		utils.RespondWithError(w, http.StatusBadRequest, "size must be the image's size in bytes")
+		return
+	}
+	if req.Size > imagecfg.MaxBytes {
+		utils.RespondWithError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("size is over the limit of %d bytes", imagecfg.MaxBytes))
+		return
+	}
+
+	key, err := imageprocessor.UploadKey(userID, product.ID, format)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to create upload")
+		return
+	}
+	expiresAt := time.Now().Add(uploadURLTTL).UTC().Truncate(time.Second)
+	uploadURL, err := store.SignedUploadURL(r.Context(), key, req.Size, uploadURLTTL)
+	if errors.Is(err, storage.ErrSigningDisabled) {
+		utils.RespondWithError(w, http.StatusServiceUnavailable, "Presigned uploads are unavailable")
+		return
+	}
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to sign upload")
+		return
+	}
+
+	headers := map[string]string{
+		"Content-Type":   imageprocessor.SourceContentType(format),
+		"Content-Length": strconv.FormatInt(req.Size, 10),
+	}
+	if headerer, ok := store.(storage.UploadHeaderer); ok {
+		for name, value := range headerer.UploadHeaders() {
+			headers[name] = value
+		}
+	}
+	utils.RespondWithJSON(w, http.StatusOK, presignedUpload{
+		Key:       key,
+		UploadURL: uploadURL,
+		Method:    http.MethodPut,
+		Headers:   headers,
+		MaxBytes:  imagecfg.MaxBytes,
+		ExpiresAt: expiresAt,
+	})
+}
+
+// CompleteImageUploadHandler checks an image uploaded through a presigned link,
+// adds it to the product and queues it for processing. Uploads that are not an
+// image within the limits are deleted.
+func CompleteImageUploadHandler(w http.ResponseWriter, r *http.Request, products models.ProductRepository, users models.UserRepository, cache *models.ProductCache, queue imageprocessor.JobQueue, store storage.ObjectStore, imagecfg config.ImageConfig) {
+	product, userID, ok := authorizeUpload(w, r, products, users, store)
+	if !ok {
+		return
+	}
+
+	var req completeUploadRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	// Keys are only ever signed below the caller's prefix for the product, so no
+	// one can claim an object someone else uploaded
+	if !strings.HasPrefix(req.Key, imageprocessor.ProductUploadPrefix(userID, product.ID)) || path.Clean(req.Key) != req.Key {
+		utils.RespondWithError(w, http.StatusBadRequest, "key is not your upload for this product")
+		return
+	}
+
+	sourceURL := store.URL(req.Key)
+	for _, image := range product.ProductImages {
+		if image == sourceURL {
+			utils.RespondWithError(w, http.StatusConflict, "Upload has already been added")
+			return
+		}
+	}
+
+	if _, err := imageprocessor.ReadUpload(r.Context(), store, req.Key, imagecfg.MaxBytes, imagecfg.MaxPixels); err != nil {
+		if errors.Is(err, imageprocessor.ErrImageTooLarge) || errors.Is(err, imageprocessor.ErrNotAnImage) {
+			deleteUpload(r.Context(), store, req.Key)
+		}
+		respondWithUploadError(w, err, "Failed to read upload")
+		return
+	}
+	if err := addUploadedImage(r.Context(), products, cache, queue, product.ID, sourceURL); err != nil {
+		respondWithProductError(w, err, "Failed to add image")
+		return
+	}
+
+	respondWithProduct(w, r, products, product.ID)
+}
+
+// authorizeUpload returns the product the caller is adding images to and the
+// caller's user ID, once it has checked the caller may and that there is a store
+// to add them to
+func authorizeUpload(w http.ResponseWriter, r *http.Request, products models.ProductRepository, users models.UserRepository, store storage.ObjectStore) (*models.Product, int, bool) {
+	productID, err := utils.ParseID(mux.Vars(r)["id"])
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid product ID")
+		return nil, 0, false
+	}
+
+	userID, ok := requireUserID(w, r)
+	if !ok {
+		return nil, 0, false
+	}
+
+	product, _, err := models.AuthorizeProductMutation(r.Context(), products, users, userID, productID)
+	if err != nil {
+		respondWithProductError(w, err, "Failed to retrieve product")
+		return nil, 0, false
+	}
+	if store == nil {
+		utils.RespondWithError(w, http.StatusServiceUnavailable, "Image uploads are unavailable")
+		return nil, 0, false
+	}
+	return product, userID, true
+}
+
+// checkUploadedImages responds with 403 unless every image linking the store's
+// uploads, other than those the product already had, is one the caller uploaded.
+// Otherwise anyone could attach an image someone else uploaded for their product.
+func checkUploadedImages(w http.ResponseWriter, store storage.ObjectStore, userID int, previous, images []string) bool {
+	if store == nil {
+		return true
+	}
+	for _, image := range images {
+		if !strings.HasPrefix(image, store.URL(imageprocessor.UploadPrefix)) || slices.Contains(previous, image) {
+			continue
+		}
+		key, ok := imageprocessor.UploadedKey(store, image)
+		if !ok || !strings.HasPrefix(key, imageprocessor.UserUploadPrefix(userID)) {
+			utils.RespondWithError(w, http.StatusForbidden, "product_images may only link your own uploads")
+			return false
+		}
+	}
+	return true
+}
+
+// streamUpload checks the header of an uploaded image and streams it to the store
+// under a new key of the uploader's, which it returns. Nothing is left behind when
+// the image turns out to be over the size limit.
+func streamUpload(ctx context.Context, store storage.ObjectStore, userID, productID int, body io.Reader, imagecfg config.ImageConfig) (string, error) {
+	buffered := bufio.NewReaderSize(body, uploadSniffBytes)
+	header, err := buffered.Peek(uploadSniffBytes)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", err
+	}
+	format, err := imageprocessor.CheckImage(header, imagecfg.MaxPixels)
+	if err != nil {
+		return "", err
+	}
+
+	key, err := imageprocessor.UploadKey(userID, productID, format)
+	if err != nil {
+		return "", err
+	}
+	// Read one byte past the limit to tell a full-size image from an oversized one
+	limited := &io.LimitedReader{R: buffered, N: imagecfg.MaxBytes + 1}
+	if err := store.Put(ctx, key, limited, imageprocessor.SourceContentType(format)); err != nil {
+		return "", err
+	}
+	if limited.N == 0 {
+		deleteUpload(ctx, store, key)
+		return "", fmt.Errorf("%w: over the limit of %d bytes", imageprocessor.ErrImageTooLarge, imagecfg.MaxBytes)
+	}
+	return key, nil
+}
+
+// addUploadedImage appends an uploaded image to the product and queues it for
+// processing; the image is already stored, so a queue outage is logged rather than
+// failing the request
+func addUploadedImage(ctx context.Context, products models.ProductRepository, cache *models.ProductCache, queue imageprocessor.JobQueue, productID int, sourceURL string) error {
+	index, err := products.AddImage(ctx, productID, sourceURL)
+	if err != nil {
+		return err
+	}
+	invalidateProduct(ctx, cache, productID)
+
+	if err := models.QueueImage(ctx, products, queue, productID, index, sourceURL); err != nil {
+		logging.FromContext(ctx).Error("Failed to queue uploaded image", "product_id", productID, "image_index", index, "error", err)
+	}
+	return nil
+}
+
+// deleteUpload removes a rejected upload; a failure only leaves an unreferenced
+// object behind, so it is logged rather than returned
+func deleteUpload(ctx context.Context, store storage.ObjectStore, key string) {
+	if err := store.Delete(ctx, key); err != nil {
+		logging.FromContext(ctx).Warn("Failed to delete rejected upload", "key", key, "error", err)
+	}
+}
+
+// respondWithProduct answers 201 with the product the images were added to
+func respondWithProduct(w http.ResponseWriter, r *http.Request, products models.ProductRepository, productID int) {
+	product, err := products.GetByID(r.Context(), productID)
+	if err != nil {
+		respondWithProductError(w, err, "Failed to retrieve product")
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusCreated, product)
+}
+
+// respondWithUploadError maps an upload failure to 400, 404, 413, 415 or 500
+func respondWithUploadError(w http.ResponseWriter, err error, message string) {
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.As(err, &tooLarge):
+		utils.RespondWithError(w, http.StatusRequestEntityTooLarge, "Request body is too large")
+	case errors.Is(err, imageprocessor.ErrImageTooLarge):
+		utils.RespondWithError(w, http.StatusRequestEntityTooLarge, err.Error())
+	case errors.Is(err, imageprocessor.ErrNotAnImage):
+		utils.RespondWithError(w, http.StatusUnsupportedMediaType, err.Error())
+	case errors.Is(err, storage.ErrNotFound):
+		utils.RespondWithError(w, http.StatusNotFound, "Upload not found")
+	case errors.Is(err, storage.ErrInvalidKey):
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid upload key")
+	default:
+		utils.RespondWithError(w, http.StatusInternalServerError, message)
+	}
+}
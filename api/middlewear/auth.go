@@ -0,0 +1,50 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"product-management/logging"
+	models "product-management/services"
+	"product-management/utils"
+	"strings"
+)
+
+type contextKey string
+
+const userIDKey contextKey = "userID"
+
+// AuthMiddleware rejects requests unless they carry a bearer token that tokens
+// accepts, and stores the caller's user ID in the request context
+func AuthMiddleware(tokens *models.Tokens, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Auth schemes are case-insensitive (RFC 7235)
+		scheme, token, found := strings.Cut(r.Header.Get("Authorization"), " ")
+		if !found || !strings.EqualFold(scheme, "Bearer") || strings.TrimSpace(token) == "" {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			utils.RespondWithError(w, http.StatusUnauthorized, "Missing bearer token")
+			return
+		}
+
+		userID, err := tokens.Parse(strings.TrimSpace(token))
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+			utils.RespondWithError(w, http.StatusUnauthorized, "Invalid or expired token")
+			return
+		}
+
+		recordUser(r.Context(), userID)
+		ctx := logging.With(WithUserID(r.Context(), userID), "user_id", userID)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// WithUserID returns a copy of ctx carrying the authenticated user's ID
+func WithUserID(ctx context.Context, userID int) context.Context {
+	return context.WithValue(ctx, userIDKey, userID)
+}
+
+// UserIDFromContext returns the authenticated user's ID, if any
+func UserIDFromContext(ctx context.Context) (int, bool) {
+	userID, ok := ctx.Value(userIDKey).(int)
+	return userID, ok
+}
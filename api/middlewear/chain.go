@@ -0,0 +1,16 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// Chain wraps h in middlewares, the first outermost, in the order router.Use
+// applies them to matched routes
+func Chain(h http.Handler, middlewares ...mux.MiddlewareFunc) http.Handler {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		h = middlewares[i](h)
+	}
+	return h
+}
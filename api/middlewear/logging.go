@@ -1,14 +1,97 @@
 package middleware
 
 import (
-	"log"
+	"context"
+	"log/slog"
 	"net/http"
+	"product-management/logging"
+	"time"
+
+	"github.com/gorilla/mux"
 )
 
+const accessLogKey contextKey = "accessLog"
+
+// accessLog collects what inner handlers know about a request for its access log
+type accessLog struct {
+	userID int
+}
+
+// LoggingMiddleware writes one access log record per request with its route,
+// status, response size, latency and authenticated user
 func LoggingMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		log.Printf("Started %s %s", r.Method, r.URL.Path)
-		next.ServeHTTP(w, r)
-		log.Printf("Completed %s %s", r.Method, r.URL.Path)
+		start := time.Now()
+		entry := &accessLog{}
+		recorder := recordResponse(w)
+		logger := logging.FromContext(r.Context())
+
+		logger.Debug("Started request", "method", r.Method, "path", r.URL.Path)
+		next.ServeHTTP(recorder, r.WithContext(context.WithValue(r.Context(), accessLogKey, entry)))
+
+		attrs := []any{
+			"method", r.Method,
+			"path", r.URL.Path,
+			"status", recorder.status,
+			"bytes", recorder.bytes,
+			"latency_ms", float64(time.Since(start).Microseconds()) / 1000,
+			"remote_addr", r.RemoteAddr,
+		}
+		if route := mux.CurrentRoute(r); route != nil {
+			if template, err := route.GetPathTemplate(); err == nil {
+				attrs = append(attrs, "route", template)
+			}
+		}
+		if entry.userID != 0 {
+			attrs = append(attrs, "user_id", entry.userID)
+		}
+
+		level := slog.LevelInfo
+		if recorder.status >= http.StatusInternalServerError {
+			level = slog.LevelError
+		}
+		logger.Log(r.Context(), level, "Completed request", attrs...)
 	})
 }
+
+// recordUser notes the authenticated user on the request's access log, if any
+func recordUser(ctx context.Context, userID int) {
+	if entry, ok := ctx.Value(accessLogKey).(*accessLog); ok {
+		entry.userID = userID
+	}
+}
+
+// responseRecorder remembers the status and size of the response written through it
+type responseRecorder struct {
+	http.ResponseWriter
+	status      int
+	bytes       int64
+	wroteHeader bool
+}
+
+// recordResponse wraps w, reusing it when it already records the response
+func recordResponse(w http.ResponseWriter) *responseRecorder {
+	if recorder, ok := w.(*responseRecorder); ok {
+		return recorder
+	}
+	return &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	if !r.wroteHeader {
+		r.status, r.wroteHeader = status, true
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	r.wroteHeader = true
+	n, err := r.ResponseWriter.Write(b)
+	r.bytes += int64(n)
+	return n, err
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (r *responseRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
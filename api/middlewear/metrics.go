@@ -0,0 +1,27 @@
+package middleware
+
+import (
+	"net/http"
+	"product-management/metrics"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// MetricsMiddleware times each request by its mux route template rather than its
+// path, so /products/1 and /products/2 share a series
+func MetricsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		recorder := recordResponse(w)
+		next.ServeHTTP(recorder, r)
+
+		route := "unknown"
+		if current := mux.CurrentRoute(r); current != nil {
+			if template, err := current.GetPathTemplate(); err == nil {
+				route = template
+			}
+		}
+		metrics.ObserveRequest(r.Method, route, recorder.status, time.Since(start))
+	})
+}
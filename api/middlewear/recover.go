@@ -0,0 +1,40 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"product-management/logging"
+	"product-management/utils"
+	"runtime/debug"
+)
+
+// RecoveryMiddleware turns a panicking handler into a JSON 500 and logs the panic
+// with its stack. If the handler already started its response, the connection is
+// closed instead so the client sees a truncated reply rather than a corrupt one.
+func RecoveryMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		recorder := recordResponse(w)
+		defer func() {
+			recovered := recover()
+			if recovered == nil {
+				return
+			}
+			if err, ok := recovered.(error); ok && errors.Is(err, http.ErrAbortHandler) {
+				panic(recovered)
+			}
+
+			logging.FromContext(r.Context()).Error("Recovered from panic",
+				"method", r.Method,
+				"path", r.URL.Path,
+				"panic", fmt.Sprint(recovered),
+				"stack", string(debug.Stack()),
+			)
+			if recorder.wroteHeader {
+				panic(http.ErrAbortHandler)
+			}
+			utils.RespondWithJSON(recorder, http.StatusInternalServerError, map[string]string{"error": "Internal server error"})
+		}()
+		next.ServeHTTP(recorder, r)
+	})
+}
@@ -0,0 +1,53 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"product-management/logging"
+	"product-management/tracing"
+
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TracingMiddleware runs each request in a server span named after its route
+// template, continuing the caller's trace when the request carries a traceparent
+// header. The trace ID is added to the request's logger.
+func TracingMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+
+		name := r.Method
+		attrs := []attribute.KeyValue{
+			attribute.String("http.request.method", r.Method),
+			attribute.String("url.path", r.URL.Path),
+		}
+		if route := mux.CurrentRoute(r); route != nil {
+			if template, err := route.GetPathTemplate(); err == nil {
+				name += " " + template
+				attrs = append(attrs, attribute.String("http.route", template))
+			}
+		}
+		if id := logging.RequestID(ctx); id != "" {
+			attrs = append(attrs, attribute.String("http.request.id", id))
+		}
+
+		ctx, span := tracing.Tracer().Start(ctx, name, trace.WithSpanKind(trace.SpanKindServer), trace.WithAttributes(attrs...))
+		defer span.End()
+		if span.SpanContext().IsValid() {
+			ctx = logging.With(ctx, "trace_id", span.SpanContext().TraceID().String())
+		}
+
+		recorder := recordResponse(w)
+		next.ServeHTTP(recorder, r.WithContext(ctx))
+
+		span.SetAttributes(attribute.Int("http.response.status_code", recorder.status))
+		if recorder.status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, fmt.Sprintf("status %d", recorder.status))
+		}
+	})
+}
@@ -1,13 +1,129 @@
 package api
 
 import (
+	"database/sql"
+	"log/slog"
+	"net/http"
 	"product-management/api/handlers"
+	middleware "product-management/api/middlewear"
+	"product-management/cache"
+	"product-management/config"
+	"product-management/db"
+	"product-management/health"
+	imageprocessor "product-management/image-processor"
+	"product-management/metrics"
+	services "product-management/services"
+	"product-management/storage"
+	"product-management/utils"
+	"time"
 
+	"github.com/go-redis/redis/v8"
 	"github.com/gorilla/mux"
 )
 
-func RegisterRoutes(router *mux.Router) {
-	router.HandleFunc("/products", handlers.CreateProduct).Methods("POST")
-	router.HandleFunc("/products/{id}", handlers.GetProduct).Methods("GET")
-	router.HandleFunc("/products", handlers.GetAllProducts).Methods("GET")
+// Dependencies are the stores and clients the API is served from
+type Dependencies struct {
+	Products services.ProductRepository
+	Users    services.UserRepository
+	// Cache is optional; without it products are always read from Products
+	Cache *redis.Client
+	// CacheTTL is how long a product stays in Cache after a read
+	CacheTTL time.Duration
+	Queue    imageprocessor.JobQueue
+	Tokens   *services.Tokens
+	// Store is optional; without it image requests are redirected to the stored
+	// renditions instead of being served from it, and uploads are refused
+	Store storage.ObjectStore
+	// Image holds the limits uploaded images are checked against; the zero value
+	// uses the defaults
+	Image config.ImageConfig
+	// DB is optional; when set, /readyz and /status probe it and report its pool stats
+	DB *sql.DB
+	// Ready reports whether the server accepts traffic; nil means it always does
+	Ready func() bool
+	// HealthCheckTimeout bounds each dependency probe; zero leaves probes bounded
+	// only by the request
+	HealthCheckTimeout time.Duration
+}
+
+// NewRouter returns a router serving every API route from deps
+func NewRouter(deps Dependencies) *mux.Router {
+	router := mux.NewRouter()
+	registerRoutes(router, deps)
+	return router
+}
+
+// RegisterRoutes serves the API from the Postgres repositories, Redis cache and
+// RabbitMQ described by cfg; ready backs the readiness endpoint
+func RegisterRoutes(router *mux.Router, cfg *config.Config, ready func() bool) {
+	store, err := storage.New(cfg.Storage, cfg.S3)
+	if err != nil {
+		slog.Warn("Image storage is unavailable; image requests will be redirected and uploads refused", "backend", cfg.Storage.Backend, "error", err)
+		store = nil
+	}
+
+	registerRoutes(router, Dependencies{
+		Products:           services.NewPostgresProductRepository(db.DB),
+		Users:              services.NewPostgresUserRepository(db.DB),
+		Cache:              cache.RedisClient,
+		CacheTTL:           cfg.Redis.ProductCacheTTL,
+		Queue:              imageprocessor.NewAMQPQueue(cfg.AMQP.URL),
+		Tokens:             services.NewTokens(cfg.Auth),
+		Store:              store,
+		Image:              cfg.Image,
+		DB:                 db.DB,
+		Ready:              ready,
+		HealthCheckTimeout: cfg.Server.HealthCheckTimeout,
+	})
+}
+
+// registerRoutes adds every API route to router
+func registerRoutes(router *mux.Router, deps Dependencies) {
+	// Every request gets an ID, a span, a latency observation and an access log record, and
+	// a panicking handler answers 500 instead of dropping the connection. mux only runs
+	// router.Use middleware on matched routes, so the 404 and 405 handlers get the
+	// same chain themselves.
+	chain := []mux.MiddlewareFunc{middleware.RequestIDMiddleware, middleware.TracingMiddleware, middleware.MetricsMiddleware, middleware.LoggingMiddleware, middleware.RecoveryMiddleware}
+	router.Use(chain...)
+	router.NotFoundHandler = middleware.Chain(http.HandlerFunc(notFound), chain...)
+	router.MethodNotAllowedHandler = middleware.Chain(http.HandlerFunc(methodNotAllowed), chain...)
+
+	productCache := services.NewProductCache(deps.Cache, deps.CacheTTL)
+	handlers.RegisterProductHandlers(router, deps.Products, deps.Users, productCache, deps.Queue, deps.Store, deps.Tokens)
+	handlers.RegisterImageJobHandlers(router, deps.Products, deps.Users, deps.Queue, deps.Tokens)
+	handlers.RegisterRenditionHandlers(router, deps.Products, productCache, deps.Store)
+	imagecfg := deps.Image
+	if imagecfg.MaxBytes == 0 {
+		imagecfg = config.Default().Image
+	}
+	handlers.RegisterUploadHandlers(router, deps.Products, deps.Users, productCache, deps.Queue, deps.Store, imagecfg, deps.Tokens)
+	handlers.RegisterStorageHandlers(router, deps.Store, imagecfg.MaxBytes)
+	handlers.RegisterAuthHandlers(router, deps.Users, deps.Tokens)
+	handlers.RegisterHealthHandlers(router, newChecker(deps))
+	router.Handle("/metrics", metrics.Handler()).Methods("GET")
+}
+
+// notFound answers requests for a path no route serves
+func notFound(w http.ResponseWriter, r *http.Request) {
+	utils.RespondWithError(w, http.StatusNotFound, "Not found")
+}
+
+// methodNotAllowed answers requests for a path served only with other methods
+func methodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	utils.RespondWithError(w, http.StatusMethodNotAllowed, "Method not allowed")
+}
+
+// newChecker probes every dependency in deps that can be reached over the network
+func newChecker(deps Dependencies) *health.Checker {
+	checker := health.NewChecker(deps.HealthCheckTimeout, deps.Ready)
+	if deps.DB != nil {
+		checker.AddPostgres("postgres", deps.DB)
+	}
+	if deps.Cache != nil {
+		checker.AddRedis("redis", deps.Cache)
+	}
+	if deps.Queue != nil {
+		checker.Add("rabbitmq", deps.Queue.Ping, nil)
+	}
+	return checker
 }
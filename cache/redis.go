@@ -1,9 +1,10 @@
 package cache
 
 import (
-	"fmt"
-	"log"
+	"log/slog"
+	"os"
 	"product-management/config"
+	"product-management/tracing"
 
 	"github.com/go-redis/redis/v8"
 	"golang.org/x/net/context"
@@ -12,13 +13,15 @@ import (
 var RedisClient *redis.Client
 var ctx = context.Background()
 
-func InitRedis() {
+func InitRedis(cfg config.RedisConfig) {
 	RedisClient = redis.NewClient(&redis.Options{
-		Addr: fmt.Sprintf("%s:%s", config.CacheHost, config.CachePort),
+		Addr: cfg.Addr(),
 	})
+	RedisClient.AddHook(tracing.RedisHook{})
 	_, err := RedisClient.Ping(ctx).Result()
 	if err != nil {
-		log.Fatalf("Error connecting to Redis: %v", err)
+		slog.Error("Error connecting to Redis", "addr", cfg.Addr(), "error", err)
+		os.Exit(1)
 	}
-	log.Println("Connected to Redis")
+	slog.Info("Connected to Redis", "addr", cfg.Addr())
 }
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+
+	"product-management/cache"
+	"product-management/config"
+	"product-management/db"
+	imageprocessor "product-management/image-processor"
+	"product-management/logging"
+	"product-management/metrics"
+	"product-management/server"
+	services "product-management/services"
+	"product-management/storage"
+	"product-management/tracing"
+)
+
+func main() {
+	// Load configuration; CONFIG_FILE optionally names a YAML or JSON file
+	cfg, err := config.Load(os.Getenv("CONFIG_FILE"), ".env")
+	if err == nil && cfg.Storage.Backend == storage.BackendS3 {
+		// The worker cannot run without storage; the API only loses uploads and
+		// serving images without it
+		err = cfg.S3.Validate()
+	}
+	if err != nil {
+		log.Fatalf("Error loading configuration: %v", err)
+	}
+	logFiles, err := logging.Setup(cfg.Log)
+	if err != nil {
+		log.Fatalf("Error setting up logging: %v", err)
+	}
+	stopTracing, err := tracing.Setup(context.Background(), cfg.Tracing, "worker")
+	if err != nil {
+		slog.Error("Error setting up tracing", "error", err)
+		os.Exit(1)
+	}
+
+	// Initialize database connection
+	db.InitDB(cfg.DB)
+	if err := metrics.RegisterDB("postgres", db.DB); err != nil {
+		slog.Warn("Failed to export database pool metrics", "error", err)
+	}
+
+	// Initialize Redis client so finished images invalidate cached products
+	cache.InitRedis(cfg.Redis)
+
+	store, err := storage.New(cfg.Storage, cfg.S3)
+	if err != nil {
+		slog.Error("Error setting up image storage", "backend", cfg.Storage.Backend, "error", err)
+		os.Exit(1)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	// Process each queued image and record the result on its product. Consume
+	// returns once the job in hand has finished, so the pools it uses close last.
+	w := &worker{
+		products:  services.NewPostgresProductRepository(db.DB),
+		cache:     services.NewProductCache(cache.RedisClient, cfg.Redis.ProductCacheTTL),
+		processor: imageprocessor.NewProcessor(store, cfg.Image),
+		primary:   cfg.Image.PrimaryRendition,
+	}
+	metricsCtx, stopMetrics := context.WithCancel(ctx)
+	metricsDone := serveMetrics(metricsCtx, cfg)
+	consumeErr := imageprocessor.Consume(ctx, cfg.AMQP.URL, w.processJob, w.recordFailure)
+	stopMetrics()
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+	defer cancel()
+	err = errors.Join(consumeErr, <-metricsDone, server.Shutdown(shutdownCtx,
+		server.Hook{Name: "database pool", Stop: func(context.Context) error { return db.DB.Close() }},
+		server.Hook{Name: "Redis client", Stop: func(context.Context) error { return cache.RedisClient.Close() }},
+		server.Hook{Name: "trace exporter", Stop: stopTracing},
+	))
+	if err != nil {
+		slog.Error("Image worker stopped", "error", err)
+		logFiles.Close()
+		os.Exit(1)
+	}
+	slog.Info("Image worker shut down")
+	logFiles.Close()
+}
+
+// serveMetrics serves /metrics on the configured worker port until ctx is cancelled
+// and then reports how serving ended
+func serveMetrics(ctx context.Context, cfg *config.Config) <-chan error {
+	done := make(chan error, 1)
+	if cfg.Metrics.WorkerPort == 0 {
+		done <- nil
+		return done
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.Handler())
+	opts := server.OptionsFromConfig(cfg.Server)
+	opts.Addr = net.JoinHostPort(cfg.Server.Host, strconv.Itoa(cfg.Metrics.WorkerPort))
+	// Nothing routes traffic to the worker, so there is nothing to drain
+	opts.DrainDelay = 0
+	go func() { done <- server.New(mux, opts).Run(ctx) }()
+	return done
+}
+
+// worker stores the results of image jobs on their products
+type worker struct {
+	products  services.ProductRepository
+	cache     *services.ProductCache
+	processor *imageprocessor.Processor
+	// primary names the rendition listed in compressed_product_images
+	primary string
+}
+
+// processJob runs one image job and stores the result on its product
+func (w *worker) processJob(ctx context.Context, job imageprocessor.ImageJob) error {
+	// Bare-URL messages from older publishers carry no product ID
+	if job.IsLegacy() {
+		renditions, err := w.processor.ProcessImage(ctx, job.SourceURL)
+		if err != nil {
+			return err
+		}
+		ids, err := w.products.AddCompressedImage(ctx, job.SourceURL, renditions[w.primary].URL)
+		for _, id := range ids {
+			w.invalidateProduct(ctx, id)
+		}
+		return err
+	}
+
+	w.recordStatus(ctx, job, services.ImageStatusProcessing, nil)
+	renditions, err := w.processor.ProcessImage(ctx, job.SourceURL, job.Renditions...)
+	if err != nil {
+		return err
+	}
+
+	// A job for other renditions leaves the primary URL as it was
+	err = w.products.SetImageRenditions(ctx, job.ProductID, job.ImageIndex, job.SourceURL, renditions[w.primary].URL, renditions)
+	if errors.Is(err, services.ErrProductNotFound) {
+		// The product was deleted or its image replaced; retrying will not help
+		logging.FromContext(ctx).Info("Discarding stale image job")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	w.invalidateProduct(ctx, job.ProductID)
+
+	w.recordStatus(ctx, job, services.ImageStatusDone, nil)
+	return nil
+}
+
+// invalidateProduct drops a product whose images changed from the cache
+func (w *worker) invalidateProduct(ctx context.Context, id int) {
+	if err := services.InvalidateProduct(ctx, w.cache, id); err != nil {
+		logging.FromContext(ctx).Warn("Failed to invalidate cached product", "product_id", id, "error", err)
+	}
+}
+
+// recordFailure marks a failed image as pending another attempt, or failed once dead-lettered
+func (w *worker) recordFailure(ctx context.Context, job imageprocessor.ImageJob, err error, deadLettered bool) {
+	if job.IsLegacy() {
+		return
+	}
+	status := services.ImageStatusPending
+	if deadLettered {
+		status = services.ImageStatusFailed
+	}
+	w.recordStatus(ctx, job, status, err)
+}
+
+// recordStatus persists an image's processing state; failures are logged so they never block the queue
+func (w *worker) recordStatus(ctx context.Context, job imageprocessor.ImageJob, status string, lastErr error) {
+	if err := services.RecordJobStatus(ctx, w.products, job, status, lastErr); err != nil {
+		logging.FromContext(ctx).Error("Failed to record image job status", "status", status, "error", err)
+	}
+}
@@ -0,0 +1,145 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v3"
+)
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// Load builds the configuration from the defaults, then file when it is not empty,
+// then envFile when it exists, then the process environment, and validates the result
+func Load(file, envFile string) (*Config, error) {
+	dotenv := map[string]string{}
+	if envFile != "" {
+		values, err := godotenv.Read(envFile)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("failed to read %s: %w", envFile, err)
+		}
+		if values != nil {
+			dotenv = values
+		}
+	}
+
+	return load(file, func(key string) (string, bool) {
+		if value, ok := os.LookupEnv(key); ok {
+			return value, true
+		}
+		value, ok := dotenv[key]
+		return value, ok
+	})
+}
+
+// load applies file and then every variable lookup finds on top of the defaults
+func load(file string, lookup func(key string) (string, bool)) (*Config, error) {
+	cfg := Default()
+	if file != "" {
+		if err := readFile(file, &cfg); err != nil {
+			return nil, err
+		}
+	}
+	if err := applyEnv(reflect.ValueOf(&cfg).Elem(), "", lookup); err != nil {
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid configuration:\n%w", err)
+	}
+	return &cfg, nil
+}
+
+// readFile decodes a YAML or JSON file over cfg, rejecting keys Config does not have
+func readFile(file string, cfg *Config) error {
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".yaml", ".yml", ".json":
+	default:
+		return fmt.Errorf("config file %s: extension must be .yaml, .yml or .json", file)
+	}
+
+	contents, err := os.ReadFile(file)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	// JSON is valid YAML, so one decoder handles both and parses durations such as "30s"
+	decoder := yaml.NewDecoder(bytes.NewReader(contents))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("config file %s: %w", file, err)
+	}
+	return nil
+}
+
+// applyEnv overwrites every field tagged with env whose variable lookup finds. A tag
+// may list several variables; the first one that is set wins.
+func applyEnv(v reflect.Value, prefix string, lookup func(key string) (string, bool)) error {
+	var errs []error
+	for i := 0; i < v.NumField(); i++ {
+		field, value := v.Type().Field(i), v.Field(i)
+		name := prefix + field.Tag.Get("yaml")
+		if field.Type.Kind() == reflect.Struct {
+			if err := applyEnv(value, name+".", lookup); err != nil {
+				errs = append(errs, err)
+			}
+			continue
+		}
+
+		for _, key := range strings.Split(field.Tag.Get("env"), ",") {
+			raw, ok := lookup(key)
+			if key == "" || !ok {
+				continue
+			}
+			if err := setField(value, raw); err != nil {
+				errs = append(errs, fieldError(name, key, fmt.Sprintf("is invalid: %v", err)))
+			}
+			break
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// setField parses raw into a string, bool, integer, float or time.Duration field
+func setField(value reflect.Value, raw string) error {
+	switch {
+	case value.Type() == durationType:
+		d, err := time.ParseDuration(strings.TrimSpace(raw))
+		if err != nil {
+			return err
+		}
+		value.SetInt(int64(d))
+	case value.Kind() == reflect.String:
+		value.SetString(raw)
+	case value.Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(strings.TrimSpace(raw))
+		if err != nil {
+			return err
+		}
+		value.SetBool(b)
+	case value.Kind() == reflect.Int || value.Kind() == reflect.Int64:
+		n, err := strconv.ParseInt(strings.TrimSpace(raw), 10, 64)
+		if err != nil {
+			return err
+		}
+		value.SetInt(n)
+	case value.Kind() == reflect.Float64:
+		f, err := strconv.ParseFloat(strings.TrimSpace(raw), 64)
+		if err != nil {
+			return err
+		}
+		value.SetFloat(f)
+	default:
+		return fmt.Errorf("unsupported type %s", value.Type())
+	}
+	return nil
+}
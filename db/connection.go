@@ -2,8 +2,8 @@ package db
 
 import (
 	"database/sql"
-	"fmt"
-	"log"
+	"log/slog"
+	"os"
 	"product-management/config"
 
 	_ "github.com/lib/pq"
@@ -11,19 +11,19 @@ import (
 
 var DB *sql.DB
 
-func InitDB() {
+func InitDB(cfg config.DBConfig) {
 	var err error
-	connStr := fmt.Sprintf("user=%s password=%s dbname=%s host=%s port=%s sslmode=disable",
-		config.DBUser, config.DBPassword, config.DBName, config.DBHost, config.DBPort)
-	DB, err = sql.Open("postgres", connStr)
+	DB, err = sql.Open("postgres", cfg.DSN())
 	if err != nil {
-		log.Fatalf("Error opening DB connection: %v", err)
+		slog.Error("Error opening DB connection", "error", err)
+		os.Exit(1)
 	}
 
 	err = DB.Ping()
 	if err != nil {
-		log.Fatalf("Error connecting to DB: %v", err)
+		slog.Error("Error connecting to DB", "host", cfg.Host, "error", err)
+		os.Exit(1)
 	}
 
-	log.Println("Connected to the database")
+	slog.Info("Connected to the database", "host", cfg.Host, "name", cfg.Name)
 }
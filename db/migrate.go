@@ -0,0 +1,281 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// migrationFiles holds the SQL migrations compiled into the binary
+//
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// migrationLockID is the Postgres advisory lock key held while migrations run, so
+// several instances starting together apply each migration once
+const migrationLockID = 727_274_000_001
+
+// migrationName matches files such as 003_add_user_credentials.up.sql
+var migrationName = regexp.MustCompile(`^(\d+)_([a-z0-9_]+)\.(up|down)\.sql$`)
+
+// ErrIrreversible is returned when rolling back a migration without a down file
+var ErrIrreversible = errors.New("migration has no down file")
+
+// Migration is one versioned schema change
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// MigrationStatus reports whether a migration has been applied
+type MigrationStatus struct {
+	Migration
+	Applied   bool
+	AppliedAt time.Time
+}
+
+// Migrator applies and rolls back migrations against a database
+type Migrator struct {
+	db         *sql.DB
+	migrations []Migration
+}
+
+// NewMigrator returns a Migrator for the given migrations, which must be sorted by version
+func NewMigrator(db *sql.DB, migrations []Migration) *Migrator {
+	return &Migrator{db: db, migrations: migrations}
+}
+
+// Migrations returns the migrations embedded from db/migrations
+func Migrations() ([]Migration, error) {
+	sub, err := fs.Sub(migrationFiles, "migrations")
+	if err != nil {
+		return nil, err
+	}
+	return LoadMigrations(sub)
+}
+
+// LoadMigrations reads NNN_name.up.sql and NNN_name.down.sql files from the root of
+// fsys, sorted by version. Every version needs an up file; the down file is optional.
+func LoadMigrations(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int]*Migration{}
+	for _, entry := range entries {
+		if entry.IsDir() || path.Ext(entry.Name()) != ".sql" {
+			continue
+		}
+		match := migrationName.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("migration %s: name must look like 001_description.up.sql", entry.Name())
+		}
+
+		version, _ := strconv.Atoi(match[1])
+		contents, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = migration
+		}
+		if migration.Name != match[2] {
+			return nil, fmt.Errorf("migration %s: version %d is already used by %s", entry.Name(), version, migration.Name)
+		}
+		if match[3] == "up" {
+			migration.Up = string(contents)
+		} else {
+			migration.Down = string(contents)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.Up == "" {
+			return nil, fmt.Errorf("migration %03d_%s has no up file", migration.Version, migration.Name)
+		}
+		migrations = append(migrations, *migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// Up applies every pending migration in version order and returns the ones it applied
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	var applied []Migration
+	err := m.withLock(ctx, func(conn *sql.Conn, done map[int]time.Time) error {
+		for _, migration := range m.migrations {
+			if _, ok := done[migration.Version]; ok {
+				continue
+			}
+			if err := m.apply(ctx, conn, migration, true); err != nil {
+				return err
+			}
+			applied = append(applied, migration)
+		}
+		return nil
+	})
+	return applied, err
+}
+
+// Down rolls back the most recently applied steps migrations and returns them in the
+// order they were rolled back
+func (m *Migrator) Down(ctx context.Context, steps int) ([]Migration, error) {
+	var rolledBack []Migration
+	err := m.withLock(ctx, func(conn *sql.Conn, done map[int]time.Time) error {
+		for i := len(m.migrations) - 1; i >= 0 && len(rolledBack) < steps; i-- {
+			migration := m.migrations[i]
+			if _, ok := done[migration.Version]; !ok {
+				continue
+			}
+			if err := m.apply(ctx, conn, migration, false); err != nil {
+				return err
+			}
+			rolledBack = append(rolledBack, migration)
+		}
+		return nil
+	})
+	return rolledBack, err
+}
+
+// Redo rolls back the most recently applied migration and applies it again
+func (m *Migrator) Redo(ctx context.Context) (*Migration, error) {
+	var redone *Migration
+	err := m.withLock(ctx, func(conn *sql.Conn, done map[int]time.Time) error {
+		for i := len(m.migrations) - 1; i >= 0; i-- {
+			migration := m.migrations[i]
+			if _, ok := done[migration.Version]; !ok {
+				continue
+			}
+			if err := m.apply(ctx, conn, migration, false); err != nil {
+				return err
+			}
+			if err := m.apply(ctx, conn, migration, true); err != nil {
+				return err
+			}
+			redone = &migration
+			return nil
+		}
+		return nil
+	})
+	return redone, err
+}
+
+// Status lists every known migration and whether it has been applied
+func (m *Migrator) Status(ctx context.Context) ([]MigrationStatus, error) {
+	var statuses []MigrationStatus
+	err := m.withLock(ctx, func(conn *sql.Conn, done map[int]time.Time) error {
+		for _, migration := range m.migrations {
+			appliedAt, ok := done[migration.Version]
+			statuses = append(statuses, MigrationStatus{Migration: migration, Applied: ok, AppliedAt: appliedAt})
+		}
+		return nil
+	})
+	return statuses, err
+}
+
+// withLock runs fn on a single connection holding the migration advisory lock, after
+// making sure schema_migrations exists and reading which versions it records
+func (m *Migrator) withLock(ctx context.Context, fn func(conn *sql.Conn, done map[int]time.Time) error) (err error) {
+	// Advisory locks belong to a session, so every statement must use the same connection
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, migrationLockID); err != nil {
+		return fmt.Errorf("failed to acquire migration lock: %w", err)
+	}
+	defer func() {
+		if _, unlockErr := conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1)`, migrationLockID); unlockErr != nil && err == nil {
+			err = fmt.Errorf("failed to release migration lock: %w", unlockErr)
+		}
+	}()
+
+	_, err = conn.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version    BIGINT PRIMARY KEY,
+		name       TEXT NOT NULL,
+		applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+	)`)
+	if err != nil {
+		return fmt.Errorf("failed to create schema_migrations: %w", err)
+	}
+
+	done, err := appliedVersions(ctx, conn)
+	if err != nil {
+		return err
+	}
+	return fn(conn, done)
+}
+
+// appliedVersions reads schema_migrations into a map of version to applied time
+func appliedVersions(ctx context.Context, conn *sql.Conn) (map[int]time.Time, error) {
+	rows, err := conn.QueryContext(ctx, `SELECT version, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schema_migrations: %w", err)
+	}
+	defer rows.Close()
+
+	done := map[int]time.Time{}
+	for rows.Next() {
+		var version int
+		var appliedAt time.Time
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, err
+		}
+		done[version] = appliedAt
+	}
+	return done, rows.Err()
+}
+
+// apply runs one direction of a migration and records it in the same transaction, so a
+// failing migration leaves neither schema changes nor a schema_migrations row behind
+func (m *Migrator) apply(ctx context.Context, conn *sql.Conn, migration Migration, up bool) error {
+	script := migration.Up
+	record, args := `INSERT INTO schema_migrations (version, name) VALUES ($1, $2)`, []interface{}{migration.Version, migration.Name}
+	if !up {
+		if migration.Down == "" {
+			return fmt.Errorf("migration %03d_%s: %w", migration.Version, migration.Name, ErrIrreversible)
+		}
+		script = migration.Down
+		record, args = `DELETE FROM schema_migrations WHERE version = $1`, []interface{}{migration.Version}
+	}
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, script); err != nil {
+		return fmt.Errorf("migration %03d_%s failed: %w", migration.Version, migration.Name, err)
+	}
+	if _, err := tx.ExecContext(ctx, record, args...); err != nil {
+		return fmt.Errorf("failed to record migration %03d_%s: %w", migration.Version, migration.Name, err)
+	}
+	return tx.Commit()
+}
+
+// Migrate applies every pending embedded migration to DB
+func Migrate(ctx context.Context) ([]Migration, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return nil, err
+	}
+	return NewMigrator(DB, migrations).Up(ctx)
+}
@@ -0,0 +1,4 @@
+ALTER TABLE users
+    ADD COLUMN username VARCHAR(100) UNIQUE,
+    ADD COLUMN password TEXT NOT NULL DEFAULT '',
+    ADD COLUMN role VARCHAR(20) NOT NULL DEFAULT 'user' CHECK (role IN ('user', 'admin'));
@@ -0,0 +1,3 @@
+ALTER TABLE products
+    ALTER COLUMN compressed_product_images DROP NOT NULL,
+    ALTER COLUMN compressed_product_images DROP DEFAULT;
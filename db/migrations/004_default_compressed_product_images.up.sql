@@ -0,0 +1,5 @@
+UPDATE products SET compressed_product_images = '{}' WHERE compressed_product_images IS NULL;
+
+ALTER TABLE products
+    ALTER COLUMN compressed_product_images SET DEFAULT '{}',
+    ALTER COLUMN compressed_product_images SET NOT NULL;
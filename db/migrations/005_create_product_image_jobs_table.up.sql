@@ -0,0 +1,11 @@
+CREATE TABLE product_image_jobs (
+    product_id     INTEGER NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+    image_index    INTEGER NOT NULL,
+    source_url     TEXT NOT NULL,
+    status         TEXT NOT NULL,
+    attempts       INTEGER NOT NULL DEFAULT 0,
+    last_error     TEXT NOT NULL DEFAULT '',
+    correlation_id TEXT NOT NULL DEFAULT '',
+    updated_at     TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (product_id, image_index)
+);
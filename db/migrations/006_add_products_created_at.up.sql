@@ -0,0 +1 @@
+ALTER TABLE products ADD COLUMN created_at TIMESTAMPTZ NOT NULL DEFAULT now();
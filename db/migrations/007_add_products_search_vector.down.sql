@@ -0,0 +1,3 @@
+DROP INDEX products_search_vector_idx;
+
+ALTER TABLE products DROP COLUMN search_vector;
@@ -0,0 +1,6 @@
+ALTER TABLE products ADD COLUMN search_vector tsvector GENERATED ALWAYS AS (
+    setweight(to_tsvector('english', coalesce(product_name, '')), 'A') ||
+    setweight(to_tsvector('english', coalesce(product_description, '')), 'B')
+) STORED;
+
+CREATE INDEX products_search_vector_idx ON products USING GIN (search_vector);
@@ -0,0 +1 @@
+ALTER TABLE products ADD COLUMN image_renditions JSONB NOT NULL DEFAULT '{}';
@@ -0,0 +1,66 @@
+package health
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// PoolStats are the database/sql connection pool counters reported for Postgres
+type PoolStats struct {
+	MaxOpenConnections int     `json:"max_open_connections"`
+	OpenConnections    int     `json:"open_connections"`
+	InUse              int     `json:"in_use"`
+	Idle               int     `json:"idle"`
+	WaitCount          int64   `json:"wait_count"`
+	WaitDurationMS     float64 `json:"wait_duration_ms"`
+	MaxIdleClosed      int64   `json:"max_idle_closed"`
+	MaxIdleTimeClosed  int64   `json:"max_idle_time_closed"`
+	MaxLifetimeClosed  int64   `json:"max_lifetime_closed"`
+}
+
+// RedisPoolStats are the go-redis connection pool counters reported for Redis
+type RedisPoolStats struct {
+	Hits       uint32 `json:"hits"`
+	Misses     uint32 `json:"misses"`
+	Timeouts   uint32 `json:"timeouts"`
+	TotalConns uint32 `json:"total_conns"`
+	IdleConns  uint32 `json:"idle_conns"`
+	StaleConns uint32 `json:"stale_conns"`
+}
+
+// AddPostgres registers a probe that pings db and reports its pool stats
+func (c *Checker) AddPostgres(name string, db *sql.DB) {
+	c.Add(name, db.PingContext, func() interface{} {
+		stats := db.Stats()
+		return PoolStats{
+			MaxOpenConnections: stats.MaxOpenConnections,
+			OpenConnections:    stats.OpenConnections,
+			InUse:              stats.InUse,
+			Idle:               stats.Idle,
+			WaitCount:          stats.WaitCount,
+			WaitDurationMS:     float64(stats.WaitDuration.Microseconds()) / 1000,
+			MaxIdleClosed:      stats.MaxIdleClosed,
+			MaxIdleTimeClosed:  stats.MaxIdleTimeClosed,
+			MaxLifetimeClosed:  stats.MaxLifetimeClosed,
+		}
+	})
+}
+
+// AddRedis registers a probe that pings client and reports its pool stats
+func (c *Checker) AddRedis(name string, client *redis.Client) {
+	c.Add(name, func(ctx context.Context) error {
+		return client.Ping(ctx).Err()
+	}, func() interface{} {
+		stats := client.PoolStats()
+		return RedisPoolStats{
+			Hits:       stats.Hits,
+			Misses:     stats.Misses,
+			Timeouts:   stats.Timeouts,
+			TotalConns: stats.TotalConns,
+			IdleConns:  stats.IdleConns,
+			StaleConns: stats.StaleConns,
+		}
+	})
+}
@@ -0,0 +1,138 @@
+// Package health probes the services the API depends on and reports their state
+package health
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const (
+	// StatusOK means the process is ready and every dependency answered
+	StatusOK = "ok"
+	// StatusUnavailable means the process is draining or a dependency failed its probe
+	StatusUnavailable = "unavailable"
+)
+
+// Probe returns an error when a dependency cannot be reached
+type Probe func(ctx context.Context) error
+
+// DependencyStatus is the outcome of probing one dependency
+type DependencyStatus struct {
+	Name      string  `json:"name"`
+	Healthy   bool    `json:"healthy"`
+	LatencyMS float64 `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"`
+	// LastError is the most recent failure, kept after the dependency recovers
+	LastError   string      `json:"last_error,omitempty"`
+	LastErrorAt *time.Time  `json:"last_error_at,omitempty"`
+	Stats       interface{} `json:"stats,omitempty"`
+}
+
+// Report is the state of the process and every registered dependency
+type Report struct {
+	Status       string             `json:"status"`
+	Ready        bool               `json:"ready"`
+	CheckedAt    time.Time          `json:"checked_at"`
+	Dependencies []DependencyStatus `json:"dependencies"`
+}
+
+// Failing lists the dependencies whose probe failed
+func (r Report) Failing() []string {
+	failing := []string{}
+	for _, dependency := range r.Dependencies {
+		if !dependency.Healthy {
+			failing = append(failing, dependency.Name)
+		}
+	}
+	return failing
+}
+
+// Checker probes registered dependencies, each under its own timeout
+type Checker struct {
+	timeout      time.Duration
+	ready        func() bool
+	dependencies []*dependency
+}
+
+// dependency is a registered probe and the last failure it reported
+type dependency struct {
+	name  string
+	probe Probe
+	stats func() interface{}
+
+	mu          sync.Mutex
+	lastError   string
+	lastErrorAt time.Time
+}
+
+// NewChecker returns a Checker that gives each probe timeout to answer, or only the
+// caller's deadline when timeout is zero. ready reports whether the process accepts
+// traffic; nil means it always does.
+func NewChecker(timeout time.Duration, ready func() bool) *Checker {
+	return &Checker{timeout: timeout, ready: ready}
+}
+
+// Add registers a dependency. stats is optional and is reported by Check
+// alongside the probe result, for example connection pool counters.
+func (c *Checker) Add(name string, probe Probe, stats func() interface{}) {
+	c.dependencies = append(c.dependencies, &dependency{name: name, probe: probe, stats: stats})
+}
+
+// Check probes every dependency concurrently and reports the results in the
+// order the dependencies were added
+func (c *Checker) Check(ctx context.Context) Report {
+	report := Report{
+		Ready:        c.ready == nil || c.ready(),
+		CheckedAt:    time.Now().UTC(),
+		Dependencies: make([]DependencyStatus, len(c.dependencies)),
+	}
+
+	var wg sync.WaitGroup
+	for i, d := range c.dependencies {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			report.Dependencies[i] = d.check(ctx, c.timeout)
+		}()
+	}
+	wg.Wait()
+
+	report.Status = StatusOK
+	if !report.Ready || len(report.Failing()) > 0 {
+		report.Status = StatusUnavailable
+	}
+	return report
+}
+
+// check runs the probe once and records a failure as the last error
+func (d *dependency) check(ctx context.Context, timeout time.Duration) DependencyStatus {
+	probeCtx, cancel := ctx, context.CancelFunc(func() {})
+	if timeout > 0 {
+		probeCtx, cancel = context.WithTimeout(ctx, timeout)
+	}
+	defer cancel()
+
+	started := time.Now()
+	err := d.probe(probeCtx)
+	status := DependencyStatus{
+		Name:      d.name,
+		Healthy:   err == nil,
+		LatencyMS: float64(time.Since(started).Microseconds()) / 1000,
+	}
+	if d.stats != nil {
+		status.Stats = d.stats()
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if err != nil {
+		status.Error = err.Error()
+		d.lastError, d.lastErrorAt = status.Error, started.UTC()
+	}
+	if d.lastError != "" {
+		lastErrorAt := d.lastErrorAt
+		status.LastError, status.LastErrorAt = d.lastError, &lastErrorAt
+	}
+	return status
+}
@@ -0,0 +1,115 @@
+package imageprocessor
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/streadway/amqp"
+)
+
+// DeadLetter describes a message waiting in the dead-letter queue
+type DeadLetter struct {
+	// Job is nil when the message could not be parsed as an image job
+	Job           *ImageJob `json:"job,omitempty"`
+	Body          string    `json:"body,omitempty"`
+	ContentType   string    `json:"content_type"`
+	CorrelationID string    `json:"correlation_id"`
+	LastError     string    `json:"last_error"`
+	DeadAt        time.Time `json:"dead_lettered_at"`
+}
+
+// ListDeadLetters returns up to limit dead-lettered messages without removing them
+func (q *AMQPQueue) ListDeadLetters(limit int) ([]DeadLetter, error) {
+	var letters []DeadLetter
+	err := q.withDeadLetters(limit, func(ch *amqp.Channel, delivery amqp.Delivery) (bool, error) {
+		letters = append(letters, newDeadLetter(delivery))
+		return false, nil
+	})
+	return letters, err
+}
+
+// ReplayDeadLetters moves up to limit dead-lettered jobs back onto the work queue
+// with a fresh attempt budget. Messages that are not valid image jobs stay in the
+// dead-letter queue and are counted as skipped.
+func (q *AMQPQueue) ReplayDeadLetters(ctx context.Context, limit int) (replayed []ImageJob, skipped int, err error) {
+	err = q.withDeadLetters(limit, func(ch *amqp.Channel, delivery amqp.Delivery) (bool, error) {
+		job, parseErr := ParseImageJob(delivery.ContentType, delivery.Body)
+		if parseErr != nil || job.IsLegacy() {
+			skipped++
+			return false, nil
+		}
+
+		job.Attempt = 1
+		if err := publishJob(ctx, ch, QueueName, job, nil); err != nil {
+			return false, err
+		}
+		replayed = append(replayed, job)
+		return true, nil
+	})
+	return replayed, skipped, err
+}
+
+// withDeadLetters fetches up to limit messages from the dead-letter queue and
+// passes each to visit. Messages visit consumes are acked; the rest are returned
+// to the queue once every message has been visited.
+func (q *AMQPQueue) withDeadLetters(limit int, visit func(ch *amqp.Channel, delivery amqp.Delivery) (bool, error)) error {
+	return q.withChannel(func(ch *amqp.Channel) error {
+		return visitDeadLetters(ch, limit, visit)
+	})
+}
+
+// visitDeadLetters gets up to limit messages from the dead-letter queue on ch
+func visitDeadLetters(ch *amqp.Channel, limit int, visit func(ch *amqp.Channel, delivery amqp.Delivery) (bool, error)) error {
+	// Unacked messages stay invisible to further gets, so each get returns the next one
+	var kept []amqp.Delivery
+	defer func() {
+		for _, delivery := range kept {
+			delivery.Nack(false, true)
+		}
+	}()
+
+	for i := 0; i < limit; i++ {
+		delivery, ok, err := ch.Get(DeadLetterQueue, false)
+		if err != nil {
+			return fmt.Errorf("failed to read the dead-letter queue: %w", err)
+		}
+		if !ok {
+			return nil
+		}
+
+		consumed, err := visit(ch, delivery)
+		if err != nil {
+			kept = append(kept, delivery)
+			return err
+		}
+		if consumed {
+			if err := delivery.Ack(false); err != nil {
+				return fmt.Errorf("failed to ack dead letter: %w", err)
+			}
+			continue
+		}
+		kept = append(kept, delivery)
+	}
+	return nil
+}
+
+// newDeadLetter summarizes a dead-lettered delivery
+func newDeadLetter(delivery amqp.Delivery) DeadLetter {
+	letter := DeadLetter{
+		ContentType:   delivery.ContentType,
+		CorrelationID: delivery.CorrelationId,
+		DeadAt:        delivery.Timestamp,
+	}
+	if lastError, ok := delivery.Headers[lastErrorHeader].(string); ok {
+		letter.LastError = lastError
+	}
+
+	job, err := ParseImageJob(delivery.ContentType, delivery.Body)
+	if err != nil {
+		letter.Body = string(delivery.Body)
+		return letter
+	}
+	letter.Job = &job
+	return letter
+}
@@ -0,0 +1,242 @@
+package imageprocessor
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"product-management/config"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// connectTimeout bounds dialing and the TLS handshake of a single connection;
+// DownloadTimeout still bounds the whole fetch
+const connectTimeout = 10 * time.Second
+
+var (
+	// ErrBlockedAddress is returned for source URLs that resolve to loopback,
+	// private, link-local or other internal addresses
+	ErrBlockedAddress = errors.New("address is not allowed")
+	// ErrImageTooLarge is returned for source images over the byte or pixel limits
+	ErrImageTooLarge = errors.New("image is too large")
+	// ErrNotAnImage is returned for content that is not a supported image format
+	ErrNotAnImage = errors.New("not a supported image")
+)
+
+// blockedPrefixes are internal or reserved ranges that netip has no predicate for.
+// NAT64, 6to4 and Teredo addresses embed an IPv4 address a relay or gateway would
+// deliver to, so they are refused whole rather than trusting the embedded one.
+var blockedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+	netip.MustParsePrefix("64:ff9b::/96"),
+	netip.MustParsePrefix("2001::/32"),
+	netip.MustParsePrefix("2002::/16"),
+}
+
+// sniffedFormats maps the content types http.DetectContentType reports for the
+// image formats that can be decoded to their names
+var sniffedFormats = map[string]string{
+	"image/jpeg": "jpeg",
+	"image/png":  "png",
+	"image/gif":  "gif",
+	"image/webp": "webp",
+}
+
+// Fetcher downloads source images from untrusted URLs. It refuses internal
+// addresses, whatever the URL's host name resolves to, and content that is too
+// large or not an image.
+type Fetcher struct {
+	client       *http.Client
+	maxBytes     int64
+	maxPixels    int64
+	maxRedirects int
+}
+
+// NewFetcher returns a Fetcher enforcing the limits in imagecfg
+func NewFetcher(imagecfg config.ImageConfig) *Fetcher {
+	f := &Fetcher{
+		maxBytes:     imagecfg.MaxBytes,
+		maxPixels:    imagecfg.MaxPixels,
+		maxRedirects: imagecfg.MaxRedirects,
+	}
+
+	// The address is checked when each connection is dialed, after DNS resolution,
+	// so neither a redirect nor a rebinding DNS answer can reach an internal host
+	dialer := &net.Dialer{Timeout: connectTimeout}
+	if !imagecfg.AllowPrivateNetworks {
+		dialer.Control = refuseInternal
+	}
+	transport := &http.Transport{
+		// A proxy would dial the source on our behalf, out of reach of the check
+		Proxy:                 nil,
+		DialContext:           dialer.DialContext,
+		TLSHandshakeTimeout:   connectTimeout,
+		ResponseHeaderTimeout: imagecfg.DownloadTimeout,
+		MaxIdleConns:          10,
+		IdleConnTimeout:       90 * time.Second,
+	}
+	f.client = &http.Client{
+		Transport:     transport,
+		Timeout:       imagecfg.DownloadTimeout,
+		CheckRedirect: f.checkRedirect,
+	}
+	return f
+}
+
+// Fetch downloads the image at rawURL and checks that it is a supported image
+// within the limits
+func (f *Fetcher) Fetch(ctx context.Context, rawURL string) ([]byte, error) {
+	if err := checkFetchURL(rawURL); err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "image/*")
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		err := fmt.Errorf("status code %d", resp.StatusCode)
+		// Client errors other than a timeout or rate limit will not go away on retry
+		if resp.StatusCode >= 400 && resp.StatusCode < 500 &&
+			resp.StatusCode != http.StatusRequestTimeout && resp.StatusCode != http.StatusTooManyRequests {
+			return nil, Permanent(err)
+		}
+		return nil, err
+	}
+	if err := checkDeclaredType(resp.Header.Get("Content-Type")); err != nil {
+		return nil, err
+	}
+	if resp.ContentLength > f.maxBytes {
+		return nil, fmt.Errorf("%w: %d bytes is over the limit of %d", ErrImageTooLarge, resp.ContentLength, f.maxBytes)
+	}
+
+	// Read one byte past the limit to tell a full-size image from an oversized one
+	imageBytes, err := io.ReadAll(io.LimitReader(resp.Body, f.maxBytes+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read image body: %w", err)
+	}
+	if int64(len(imageBytes)) > f.maxBytes {
+		return nil, fmt.Errorf("%w: over the limit of %d bytes", ErrImageTooLarge, f.maxBytes)
+	}
+
+	if _, err := CheckImage(imageBytes, f.maxPixels); err != nil {
+		return nil, err
+	}
+	return imageBytes, nil
+}
+
+// checkFetchURL requires an absolute http or https URL
+func checkFetchURL(rawURL string) error {
+	parsed, err := url.Parse(rawURL)
+	if err != nil || parsed.Host == "" || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+		return Permanent(fmt.Errorf("source_url %q must be an absolute http(s) URL", rawURL))
+	}
+	return nil
+}
+
+// checkRedirect follows at most maxRedirects redirects, and only to http(s) URLs
+func (f *Fetcher) checkRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) > f.maxRedirects {
+		return Permanent(fmt.Errorf("stopped after %d redirects", f.maxRedirects))
+	}
+	if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+		return Permanent(fmt.Errorf("redirect to a %s URL is not allowed", req.URL.Scheme))
+	}
+	return nil
+}
+
+// CheckImage verifies from its magic bytes that data holds a supported image, and
+// from its header that the image has no more than maxPixels pixels, without
+// decoding it. It returns the image's format.
+func CheckImage(data []byte, maxPixels int64) (string, error) {
+	sniffed := http.DetectContentType(data)
+	format, ok := sniffedFormats[sniffed]
+	if !ok {
+		return "", fmt.Errorf("%w: content is %s", ErrNotAnImage, sniffed)
+	}
+
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return "", fmt.Errorf("%w: unreadable %s header: %v", ErrNotAnImage, format, err)
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 {
+		return "", fmt.Errorf("%w: %s is %dx%d", ErrNotAnImage, format, cfg.Width, cfg.Height)
+	}
+	if int64(cfg.Width)*int64(cfg.Height) > maxPixels {
+		return "", fmt.Errorf("%w: %dx%d is over the limit of %d pixels", ErrImageTooLarge, cfg.Width, cfg.Height, maxPixels)
+	}
+	return format, nil
+}
+
+// checkDeclaredType rejects responses whose Content-Type says they are not an
+// image. Servers often label images loosely, so a missing or generic binary type
+// is left for the magic bytes to decide.
+func checkDeclaredType(contentType string) error {
+	if contentType == "" {
+		return nil
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return fmt.Errorf("%w: unreadable Content-Type %q", ErrNotAnImage, contentType)
+	}
+	switch {
+	case mediaType == "application/octet-stream", mediaType == "binary/octet-stream":
+		return nil
+	case strings.HasPrefix(mediaType, "image/"):
+		return nil
+	}
+	return fmt.Errorf("%w: served as %s", ErrNotAnImage, mediaType)
+}
+
+// refuseInternal is the dialer's Control hook; it sees the resolved address
+// every connection is about to be made to
+func refuseInternal(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrBlockedAddress, host)
+	}
+	if IsInternalAddr(addr) {
+		return fmt.Errorf("%w: %s", ErrBlockedAddress, addr)
+	}
+	return nil
+}
+
+// IsInternalAddr reports whether addr is loopback, private, link-local,
+// multicast, unspecified or in another range a public image cannot be served from
+func IsInternalAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if addr.Zone() != "" || addr.IsLoopback() || addr.IsPrivate() || addr.IsLinkLocalUnicast() ||
+		addr.IsLinkLocalMulticast() || addr.IsInterfaceLocalMulticast() || addr.IsMulticast() || addr.IsUnspecified() {
+		return true
+	}
+	for _, prefix := range blockedPrefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,184 @@
+package imageprocessor
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/url"
+)
+
+const (
+	// JobVersion is the envelope version produced by this build
+	JobVersion = 1
+	// JobContentType identifies a JSON image job on the wire
+	JobContentType = "application/vnd.product-management.image-job+json"
+	// legacyContentType marks the original bare-URL messages
+	legacyContentType = "text/plain"
+
+	// RenditionCompressed is the only rendition older publishers ask for; workers
+	// produce every configured rendition for it
+	RenditionCompressed = "compressed"
+)
+
+// ErrUnsupportedJob is returned for messages this worker does not understand,
+// such as a newer envelope version published during a rollout.
+var ErrUnsupportedJob = errors.New("unsupported image job")
+
+// ErrPermanent matches failures that retrying cannot fix, such as a source image
+// that is gone or is not an image. Jobs failing with it are dead-lettered at once.
+var ErrPermanent = errors.New("permanent failure")
+
+// permanentError marks err as permanent without changing its message
+type permanentError struct{ err error }
+
+func (e permanentError) Error() string        { return e.err.Error() }
+func (e permanentError) Unwrap() error        { return e.err }
+func (e permanentError) Is(target error) bool { return target == ErrPermanent }
+
+// Permanent marks err as a failure retrying cannot fix
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return permanentError{err: err}
+}
+
+// IsPermanent reports whether err is a failure retrying cannot fix: one marked
+// with Permanent, a blocked source address or a source that is too large or not
+// a supported image
+func IsPermanent(err error) bool {
+	return errors.Is(err, ErrPermanent) || errors.Is(err, ErrBlockedAddress) ||
+		errors.Is(err, ErrImageTooLarge) || errors.Is(err, ErrNotAnImage)
+}
+
+// ImageJob is the versioned envelope published for every image to process
+type ImageJob struct {
+	Version    int    `json:"version"`
+	ProductID  int    `json:"product_id"`
+	ImageIndex int    `json:"image_index"`
+	SourceURL  string `json:"source_url"`
+	Attempt    int    `json:"attempt"`
+	// Renditions names the configured renditions to produce; empty means all of them
+	Renditions    []string `json:"renditions,omitempty"`
+	CorrelationID string   `json:"correlation_id"`
+	// RequestID is the X-Request-ID of the API request that queued the job, if any
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// NewImageJob builds a first-attempt job for the image at index of a product
+func NewImageJob(productID, index int, sourceURL string) ImageJob {
+	return ImageJob{
+		Version:       JobVersion,
+		ProductID:     productID,
+		ImageIndex:    index,
+		SourceURL:     sourceURL,
+		Attempt:       1,
+		CorrelationID: newCorrelationID(),
+	}
+}
+
+// IsLegacy reports whether the job was decoded from a bare-URL message
+func (j ImageJob) IsLegacy() bool {
+	return j.Version == 0
+}
+
+// Validate checks that a job carries everything the worker needs
+func (j ImageJob) Validate() error {
+	if j.Version != JobVersion {
+		return fmt.Errorf("%w: version %d", ErrUnsupportedJob, j.Version)
+	}
+	if j.ProductID <= 0 {
+		return errors.New("product_id must be positive")
+	}
+	if j.ImageIndex < 0 {
+		return errors.New("image_index must not be negative")
+	}
+	if err := validateSourceURL(j.SourceURL); err != nil {
+		return err
+	}
+	if j.Attempt < 1 {
+		return errors.New("attempt must be at least 1")
+	}
+	for _, rendition := range j.Renditions {
+		if rendition == "" {
+			return errors.New("rendition names must not be empty")
+		}
+	}
+	if j.CorrelationID == "" {
+		return errors.New("correlation_id is required")
+	}
+	return nil
+}
+
+// EncodeImageJob validates a job and returns its wire body and content type
+func EncodeImageJob(job ImageJob) ([]byte, string, error) {
+	if err := job.Validate(); err != nil {
+		return nil, "", fmt.Errorf("invalid image job: %w", err)
+	}
+	body, err := json.Marshal(job)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to encode image job: %w", err)
+	}
+	return body, mime.FormatMediaType(JobContentType, map[string]string{"version": fmt.Sprint(JobVersion)}), nil
+}
+
+// encodeMessage returns the wire body and content type of a job being passed on.
+// Legacy jobs keep their bare-URL form, which EncodeImageJob refuses, so a retried
+// job reaches the worker as it was first published.
+func encodeMessage(job ImageJob) ([]byte, string, error) {
+	if job.IsLegacy() {
+		return []byte(job.SourceURL), legacyContentType, nil
+	}
+	return EncodeImageJob(job)
+}
+
+// ParseImageJob decodes a queued message. Bare-URL text/plain messages from
+// older publishers are returned as legacy jobs without a product ID.
+func ParseImageJob(contentType string, body []byte) (ImageJob, error) {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil && contentType != "" {
+		return ImageJob{}, fmt.Errorf("%w: content type %q", ErrUnsupportedJob, contentType)
+	}
+
+	switch mediaType {
+	case legacyContentType, "":
+		sourceURL := string(body)
+		if err := validateSourceURL(sourceURL); err != nil {
+			return ImageJob{}, err
+		}
+		return ImageJob{SourceURL: sourceURL, Attempt: 1}, nil
+	case JobContentType:
+		var job ImageJob
+		if err := json.Unmarshal(body, &job); err != nil {
+			return ImageJob{}, fmt.Errorf("failed to decode image job: %w", err)
+		}
+		if err := job.Validate(); err != nil {
+			return ImageJob{}, err
+		}
+		return job, nil
+	default:
+		return ImageJob{}, fmt.Errorf("%w: content type %q", ErrUnsupportedJob, mediaType)
+	}
+}
+
+// validateSourceURL requires an absolute URL: http(s) for images hosted elsewhere,
+// or whatever scheme the object store links uploaded images with
+func validateSourceURL(sourceURL string) error {
+	parsed, err := url.Parse(sourceURL)
+	if err != nil || !parsed.IsAbs() || (parsed.Host == "" && parsed.Path == "") {
+		return fmt.Errorf("source_url %q must be an absolute URL", sourceURL)
+	}
+	return nil
+}
+
+// newCorrelationID returns a random identifier used to follow a job through the pipeline
+func newCorrelationID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(b)
+}
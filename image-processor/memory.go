@@ -0,0 +1,199 @@
+package imageprocessor
+
+import (
+	"context"
+	"product-management/metrics"
+	"product-management/tracing"
+	"sync"
+	"time"
+)
+
+// MemoryQueue is an in-process JobQueue for tests and local development. Jobs go
+// through the same envelope encoding as on RabbitMQ, and Drain processes them with
+// the worker's retry and dead-letter rules, minus the retry delays.
+type MemoryQueue struct {
+	mu       sync.Mutex
+	messages []memoryMessage
+	dead     []DeadLetter
+}
+
+// memoryMessage is a job waiting on the work queue with the trace context it was
+// published in
+type memoryMessage struct {
+	job     ImageJob
+	headers map[string]string
+}
+
+// NewMemoryQueue returns an empty MemoryQueue
+func NewMemoryQueue() *MemoryQueue {
+	return &MemoryQueue{}
+}
+
+// Publish appends a job to the work queue
+func (q *MemoryQueue) Publish(ctx context.Context, job ImageJob) error {
+	err := q.publish(ctx, QueueName, job)
+	metrics.JobsPublished.WithLabelValues(metrics.Result(err)).Inc()
+	return err
+}
+
+// PublishLegacy appends a bare-URL job to the work queue, as publishers from
+// before the versioned envelope sent them
+func (q *MemoryQueue) PublishLegacy(ctx context.Context, sourceURL string) error {
+	return q.publish(ctx, QueueName, ImageJob{SourceURL: sourceURL, Attempt: 1})
+}
+
+// publish validates a job and appends it to the work queue in a producer span
+// for the named queue
+func (q *MemoryQueue) publish(ctx context.Context, queue string, job ImageJob) (err error) {
+	ctx, span := startPublish(ctx, queue, job)
+	defer func() {
+		tracing.RecordError(span, err)
+		span.End()
+	}()
+
+	// Round-trip the message so jobs the worker could not parse fail here too
+	body, contentType, err := encodeMessage(job)
+	if err != nil {
+		return err
+	}
+	parsed, err := ParseImageJob(contentType, body)
+	if err != nil {
+		return err
+	}
+	if parsed.IsLegacy() {
+		// The worker reads it from the message headers
+		parsed.Attempt = job.Attempt
+	}
+	job = parsed
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.messages = append(q.messages, memoryMessage{job: job, headers: tracing.InjectMap(ctx)})
+	return nil
+}
+
+// Jobs returns the jobs waiting on the work queue, oldest first
+func (q *MemoryQueue) Jobs() []ImageJob {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	jobs := make([]ImageJob, 0, len(q.messages))
+	for _, message := range q.messages {
+		jobs = append(jobs, message.job)
+	}
+	return jobs
+}
+
+// Drain hands every waiting job to handle, including retries published along the
+// way, and returns how many deliveries it made. Failed jobs are retried with the
+// next attempt number until MaxAttempts, then dead-lettered; permanent failures
+// are dead-lettered at once.
+func (q *MemoryQueue) Drain(handle ImageHandler, onFailure FailureHandler) int {
+	delivered := 0
+	for {
+		message, ok := q.next()
+		if !ok {
+			return delivered
+		}
+		delivered++
+		q.deliver(message, handle, onFailure)
+	}
+}
+
+// deliver runs handle on one message in a consumer span continuing its trace
+func (q *MemoryQueue) deliver(message memoryMessage, handle ImageHandler, onFailure FailureHandler) {
+	job := message.job
+	ctx, span := startProcess(tracing.ExtractMap(context.Background(), message.headers), job)
+	defer span.End()
+	ctx = jobContext(ctx, job)
+	start := time.Now()
+	handleErr := handle(ctx, job)
+	metrics.JobDuration.WithLabelValues(metrics.Result(handleErr)).Observe(time.Since(start).Seconds())
+	if handleErr == nil {
+		return
+	}
+	tracing.RecordError(span, handleErr)
+
+	deadLettered := deadLetters(job, handleErr)
+	if deadLettered {
+		q.DeadLetter(job, handleErr)
+	} else {
+		retry := job
+		retry.Attempt++
+		// The job was valid when first published, so requeueing it cannot fail
+		q.publish(ctx, retryQueueName(retry.Attempt), retry)
+	}
+	if onFailure != nil {
+		onFailure(ctx, job, handleErr, deadLettered)
+	}
+}
+
+// next removes and returns the oldest waiting message
+func (q *MemoryQueue) next() (memoryMessage, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.messages) == 0 {
+		return memoryMessage{}, false
+	}
+	message := q.messages[0]
+	q.messages = q.messages[1:]
+	return message, true
+}
+
+// DeadLetter moves a job straight to the dead-letter queue with cause as its last error
+func (q *MemoryQueue) DeadLetter(job ImageJob, cause error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	contentType := JobContentType
+	if job.IsLegacy() {
+		contentType = legacyContentType
+	}
+	q.dead = append(q.dead, DeadLetter{
+		Job:           &job,
+		ContentType:   contentType,
+		CorrelationID: job.CorrelationID,
+		LastError:     cause.Error(),
+		DeadAt:        time.Now(),
+	})
+}
+
+// ListDeadLetters returns up to limit dead-lettered jobs without removing them
+func (q *MemoryQueue) ListDeadLetters(limit int) ([]DeadLetter, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if limit > len(q.dead) {
+		limit = len(q.dead)
+	}
+	return append([]DeadLetter(nil), q.dead[:limit]...), nil
+}
+
+// ReplayDeadLetters moves up to limit dead-lettered jobs back onto the work queue
+// with a fresh attempt budget
+func (q *MemoryQueue) ReplayDeadLetters(ctx context.Context, limit int) (replayed []ImageJob, skipped int, err error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var kept []DeadLetter
+	for i, letter := range q.dead {
+		if i >= limit {
+			kept = append(kept, q.dead[i:]...)
+			break
+		}
+		if letter.Job == nil || letter.Job.IsLegacy() {
+			skipped++
+			kept = append(kept, letter)
+			continue
+		}
+
+		job := *letter.Job
+		job.Attempt = 1
+		q.messages = append(q.messages, memoryMessage{job: job, headers: tracing.InjectMap(ctx)})
+		replayed = append(replayed, job)
+	}
+	q.dead = kept
+	return replayed, skipped, nil
+}
+
+// Ping always succeeds; the queue lives in this process
+func (q *MemoryQueue) Ping(ctx context.Context) error {
+	return nil
+}
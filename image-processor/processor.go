@@ -2,123 +2,132 @@ package imageprocessor
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
-	"image"
+	_ "image/gif"  // to decode gif images
 	_ "image/jpeg" // to decode jpeg images
 	_ "image/png"  // to decode png images
-	"io"
-	"log"
-	"net/http"
-	"strings"
-
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/session"
-	"github.com/aws/aws-sdk-go/service/s3"
-	"github.com/disintegration/imaging"
-	"github.com/nfnt/resize"
-)
-
-const (
-	bucketName = "" // give your bucket name
-	awsRegion  = ""
+	"product-management/config"
+	"product-management/logging"
+	"product-management/metrics"
+	"product-management/storage"
+	"product-management/tracing"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	_ "golang.org/x/image/webp" // to decode webp images
 )
 
-// DownloadImage downloads the image from a URL and returns the image as bytes.
-func DownloadImage(imageURL string) ([]byte, error) {
-	resp, err := http.Get(imageURL)
-	if err != nil {
-		return nil, fmt.Errorf("failed to download image: %w", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("failed to download image: status code %d", resp.StatusCode)
-	}
+// Processor downloads, compresses and stores images as configured
+type Processor struct {
+	store   storage.ObjectStore
+	image   config.ImageConfig
+	fetcher *Fetcher
+}
 
-	imageBytes, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read image body: %w", err)
+// NewProcessor returns a Processor storing images in store and compressing with
+// the settings in imagecfg
+func NewProcessor(store storage.ObjectStore, imagecfg config.ImageConfig) *Processor {
+	return &Processor{
+		store:   store,
+		image:   imagecfg,
+		fetcher: NewFetcher(imagecfg),
 	}
-
-	return imageBytes, nil
 }
 
-// CompressImage compresses the image by resizing it.
-func CompressImage(imageBytes []byte) ([]byte, error) {
-	// Decode the image
-	img, _, err := image.Decode(bytes.NewReader(imageBytes))
-	if err != nil {
-		return nil, fmt.Errorf("failed to decode image: %w", err)
+// DownloadImage downloads the image from a URL and returns the image as bytes,
+// refusing internal addresses and anything that is not an image within the limits.
+// Images uploaded to the store are read from it directly.
+func (p *Processor) DownloadImage(ctx context.Context, imageURL string) ([]byte, error) {
+	if key, ok := UploadedKey(p.store, imageURL); ok {
+		imageBytes, err := ReadUpload(ctx, p.store, key, p.image.MaxBytes, p.image.MaxPixels)
+		if errors.Is(err, storage.ErrNotFound) {
+			return nil, Permanent(err)
+		}
+		return imageBytes, err
 	}
+	return p.fetcher.Fetch(ctx, imageURL)
+}
 
-	// Resize the image (compressing it)
-	compressedImg := resize.Resize(800, 0, img, resize.Lanczos3)
-
-	// Encode the resized image to a byte buffer (you can choose the format here, e.g., JPEG or PNG)
-	var buf bytes.Buffer
-	err = imaging.Encode(&buf, compressedImg, imaging.JPEG)
-	if err != nil {
-		return nil, fmt.Errorf("failed to encode compressed image: %w", err)
+// Upload stores an encoded image under key and returns its URL
+func (p *Processor) Upload(ctx context.Context, imageBytes []byte, key, contentType string) (string, error) {
+	if err := p.store.Put(ctx, key, bytes.NewReader(imageBytes), contentType); err != nil {
+		return "", err
 	}
-
-	return buf.Bytes(), nil
+	return p.store.URL(key), nil
 }
 
-// UploadToS3 uploads the compressed image to an S3 bucket and returns the S3 path.
-func UploadToS3(imageBytes []byte, fileName string) (string, error) {
-	// Create a session to interact with AWS
-	sess, err := session.NewSession(&aws.Config{
-		Region: aws.String(awsRegion),
-	})
-	if err != nil {
-		return "", fmt.Errorf("failed to create AWS session: %w", err)
+// startStage starts timing a ProcessImage stage in a child span of ctx; the returned
+// function ends it, recording err
+func startStage(ctx context.Context, stage string, attrs ...attribute.KeyValue) (context.Context, func(err error)) {
+	start := time.Now()
+	ctx, span := tracing.Tracer().Start(ctx, "image "+stage)
+	span.SetAttributes(attrs...)
+	return ctx, func(err error) {
+		metrics.ObserveStage(stage, start, err)
+		tracing.RecordError(span, err)
+		span.End()
 	}
+}
 
-	svc := s3.New(sess)
-
-	// Upload the image to S3
-	_, err = svc.PutObject(&s3.PutObjectInput{
-		Bucket: aws.String(bucketName),
-		Key:    aws.String(fileName),
-		Body:   bytes.NewReader(imageBytes),
-		ACL:    aws.String("public-read"),
-	})
+// ProcessImage downloads the image, renders the renditions called names, or every
+// configured rendition when there are none, and stores them
+func (p *Processor) ProcessImage(ctx context.Context, imageURL string, names ...string) (Renditions, error) {
+	logger := logging.FromContext(ctx)
+	profiles, err := p.Profiles(names)
 	if err != nil {
-		return "", fmt.Errorf("failed to upload image to S3: %w", err)
+		return nil, err
 	}
 
-	// Return the URL of the uploaded image
-	// The URL format will be: https://{bucket-name}.s3.{region}.amazonaws.com/{file-name}
-	imageURL := fmt.Sprintf("https://%s.s3.%s.amazonaws.com/%s", bucketName, awsRegion, fileName)
-	return imageURL, nil
-}
-
-// ProcessImage downloads, compresses, and uploads the image to S3
-func ProcessImage(imageURL string) (string, error) {
 	// 1. Download the image
-	log.Printf("Downloading image from URL: %s", imageURL)
-	imageBytes, err := DownloadImage(imageURL)
+	logger.Info("Downloading image", "url", imageURL)
+	stageCtx, end := startStage(ctx, metrics.StageDownload, attribute.String("url.full", imageURL))
+	imageBytes, err := p.DownloadImage(stageCtx, imageURL)
+	end(err)
 	if err != nil {
-		return "", fmt.Errorf("failed to download image: %w", err)
+		return nil, fmt.Errorf("failed to download image: %w", err)
 	}
 
-	// 2. Compress the image
-	log.Printf("Compressing image...")
-	compressedImageBytes, err := CompressImage(imageBytes)
+	// 2. Decode it once and encode every rendition
+	logger.Debug("Rendering image", "bytes", len(imageBytes), "renditions", len(profiles))
+	_, end = startStage(ctx, metrics.StageCompress, attribute.Int("image.bytes", len(imageBytes)), attribute.Int("image.renditions", len(profiles)))
+	rendered, err := p.renderImage(imageBytes, profiles)
+	end(err)
 	if err != nil {
-		return "", fmt.Errorf("failed to compress image: %w", err)
+		return nil, fmt.Errorf("failed to compress image: %w", err)
 	}
 
-	// 3. Generate a unique file name for the compressed image
-	fileName := fmt.Sprintf("%s_compressed.jpg", strings.TrimSuffix(imageURL, ".jpg"))
-
-	// 4. Upload to S3
-	log.Printf("Uploading compressed image to S3...")
-	uploadedImageURL, err := UploadToS3(compressedImageBytes, fileName)
+	// 3. Store each rendition under a key derived from the source URL
+	stageCtx, end = startStage(ctx, metrics.StageUpload, attribute.Int("image.renditions", len(rendered)))
+	renditions := Renditions{}
+	for _, image := range rendered {
+		name := image.profile.Name
+		key := RenditionKey(imageURL, name, image.format)
+		logger.Debug("Storing rendition", "rendition", name, "format", image.format, "key", key, "bytes", len(image.data))
+		var url string
+		url, err = p.Upload(stageCtx, image.data, key, formats[image.format].contentType)
+		if err != nil {
+			break
+		}
+
+		// The profile's own format comes first; the others are its alternates
+		if image.format == image.profile.Format {
+			renditions[name] = Rendition{URL: url, Key: key, Width: image.width, Height: image.height, Format: image.format, Bytes: len(image.data)}
+			continue
+		}
+		rendition := renditions[name]
+		if rendition.Alternates == nil {
+			rendition.Alternates = map[string]Encoding{}
+		}
+		rendition.Alternates[image.format] = Encoding{URL: url, Key: key, Bytes: len(image.data)}
+		renditions[name] = rendition
+	}
+	end(err)
 	if err != nil {
-		return "", fmt.Errorf("failed to upload compressed image to S3: %w", err)
+		return nil, fmt.Errorf("failed to store rendition: %w", err)
 	}
 
-	// 5. Return the URL of the uploaded image
-	return uploadedImageURL, nil
+	logger.Info("Processed image", "renditions", len(renditions))
+	return renditions, nil
 }
@@ -0,0 +1,157 @@
+package imageprocessor
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"image"
+	"product-management/config"
+
+	"github.com/HugoSmits86/nativewebp"
+	"github.com/disintegration/imaging"
+)
+
+// Rendition is one stored rendition of a source image
+type Rendition struct {
+	URL    string `json:"url"`
+	Key    string `json:"key"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+	Format string `json:"format"`
+	Bytes  int    `json:"bytes"`
+	// Alternates are the same rendition stored in other formats, by format
+	Alternates map[string]Encoding `json:"alternates,omitempty"`
+}
+
+// Encoding is a rendition stored in one of its alternate formats
+type Encoding struct {
+	URL   string `json:"url"`
+	Key   string `json:"key"`
+	Bytes int    `json:"bytes"`
+}
+
+// Encodings returns every stored format of the rendition, its own included
+func (r Rendition) Encodings() map[string]Encoding {
+	encodings := map[string]Encoding{r.Format: {URL: r.URL, Key: r.Key, Bytes: r.Bytes}}
+	for format, encoding := range r.Alternates {
+		encodings[format] = encoding
+	}
+	return encodings
+}
+
+// Renditions maps rendition names to the renditions of one source image
+type Renditions map[string]Rendition
+
+// renderedImage is a rendition encoded in one of its formats, waiting to be stored
+type renderedImage struct {
+	profile config.RenditionConfig
+	format  string
+	data    []byte
+	width   int
+	height  int
+}
+
+// formats maps the configured formats to their file extension and content type
+var formats = map[string]struct{ ext, contentType string }{
+	config.FormatJPEG: {ext: "jpg", contentType: "image/jpeg"},
+	config.FormatPNG:  {ext: "png", contentType: "image/png"},
+	config.FormatWebP: {ext: "webp", contentType: "image/webp"},
+}
+
+// ContentType returns the media type of a rendition format, or "" for an unknown one
+func ContentType(format string) string {
+	return formats[format].contentType
+}
+
+// RenditionKey returns the key a rendition of the image at sourceURL is stored under.
+// It depends only on its inputs, so reprocessing an image replaces its renditions.
+func RenditionKey(sourceURL, name, format string) string {
+	return fmt.Sprintf("renditions/%x/%s.%s", sha256.Sum256([]byte(sourceURL)), name, formats[format].ext)
+}
+
+// Profiles returns the configured renditions called names, or every configured
+// rendition when names is empty. Jobs from older publishers ask for the
+// compressed rendition, which also means every rendition. Unknown names return
+// ErrUnsupportedJob so a worker configured with them can take the job.
+func (p *Processor) Profiles(names []string) ([]config.RenditionConfig, error) {
+	if len(names) == 0 || (len(names) == 1 && names[0] == RenditionCompressed) {
+		return p.image.Renditions, nil
+	}
+
+	var profiles []config.RenditionConfig
+	for _, name := range names {
+		profile, ok := p.profile(name)
+		if !ok {
+			return nil, fmt.Errorf("%w: rendition %q", ErrUnsupportedJob, name)
+		}
+		profiles = append(profiles, profile)
+	}
+	return profiles, nil
+}
+
+func (p *Processor) profile(name string) (config.RenditionConfig, bool) {
+	for _, profile := range p.image.Renditions {
+		if profile.Name == name {
+			return profile, true
+		}
+	}
+	return config.RenditionConfig{}, false
+}
+
+// renderImage decodes a source image once and encodes every profile from it in
+// each of the profile's formats. Animated GIFs are rendered from their first frame.
+func (p *Processor) renderImage(imageBytes []byte, profiles []config.RenditionConfig) ([]renderedImage, error) {
+	img, _, err := image.Decode(bytes.NewReader(imageBytes))
+	if err != nil {
+		return nil, Permanent(fmt.Errorf("failed to decode image: %w", err))
+	}
+
+	var rendered []renderedImage
+	for _, profile := range profiles {
+		resized := resizeImage(img, profile)
+		bounds := resized.Bounds()
+		for _, format := range profile.Formats() {
+			data, err := encodeImage(resized, format, profile.Quality)
+			if err != nil {
+				return nil, fmt.Errorf("failed to encode rendition %s as %s: %w", profile.Name, format, err)
+			}
+			rendered = append(rendered, renderedImage{profile: profile, format: format, data: data, width: bounds.Dx(), height: bounds.Dy()})
+		}
+	}
+	return rendered, nil
+}
+
+// resizeImage applies a profile's fit mode. Fitting never enlarges an image.
+func resizeImage(img image.Image, profile config.RenditionConfig) image.Image {
+	if profile.Fit == config.FitFill {
+		return imaging.Fill(img, profile.Width, profile.Height, imaging.Center, imaging.Lanczos)
+	}
+
+	// A zero bound leaves that side free, which Fit expresses as the image's own size
+	width, height := profile.Width, profile.Height
+	bounds := img.Bounds()
+	if width == 0 {
+		width = bounds.Dx()
+	}
+	if height == 0 {
+		height = bounds.Dy()
+	}
+	return imaging.Fit(img, width, height, imaging.Lanczos)
+}
+
+// encodeImage encodes img in format; quality applies to jpeg only
+func encodeImage(img image.Image, format string, quality int) ([]byte, error) {
+	var buf bytes.Buffer
+	var err error
+	switch format {
+	case config.FormatJPEG:
+		err = imaging.Encode(&buf, img, imaging.JPEG, imaging.JPEGQuality(quality))
+	case config.FormatPNG:
+		err = imaging.Encode(&buf, img, imaging.PNG)
+	case config.FormatWebP:
+		err = nativewebp.Encode(&buf, img, nil)
+	default:
+		err = fmt.Errorf("unsupported format %q", format)
+	}
+	return buf.Bytes(), err
+}
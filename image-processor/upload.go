@@ -0,0 +1,111 @@
+package imageprocessor
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/url"
+	"path"
+	"product-management/storage"
+	"strings"
+)
+
+// UploadPrefix is the key prefix of source images uploaded to the object store
+// rather than hosted elsewhere
+const UploadPrefix = "uploads/"
+
+// uploadExtensions maps the source formats that can be uploaded to their file extensions
+var uploadExtensions = map[string]string{
+	"jpeg": "jpg",
+	"png":  "png",
+	"gif":  "gif",
+	"webp": "webp",
+}
+
+// UploadFormat returns the source format of an uploadable image content type
+func UploadFormat(contentType string) (string, bool) {
+	format, ok := sniffedFormats[strings.ToLower(contentType)]
+	return format, ok
+}
+
+// SourceContentType returns the media type of an uploadable source format
+func SourceContentType(format string) string {
+	for contentType, f := range sniffedFormats {
+		if f == format {
+			return contentType
+		}
+	}
+	return ""
+}
+
+// UserUploadPrefix is the key prefix of every image uploaded by a user
+func UserUploadPrefix(userID int) string {
+	return fmt.Sprintf("%s%d/", UploadPrefix, userID)
+}
+
+// ProductUploadPrefix is the key prefix of the images a user uploads for a product
+func ProductUploadPrefix(userID, productID int) string {
+	return fmt.Sprintf("%s%d/", UserUploadPrefix(userID), productID)
+}
+
+// UploadKey returns a new random key to store a source image a user uploads for a
+// product under
+func UploadKey(userID, productID int, format string) (string, error) {
+	ext, ok := uploadExtensions[format]
+	if !ok {
+		return "", fmt.Errorf("%w: %s", ErrNotAnImage, format)
+	}
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate upload key: %w", err)
+	}
+	return ProductUploadPrefix(userID, productID) + hex.EncodeToString(b) + "." + ext, nil
+}
+
+// UploadedKey returns the key of sourceURL when it links an image uploaded to
+// store, which is then read from the store instead of being fetched
+func UploadedKey(store storage.ObjectStore, sourceURL string) (string, bool) {
+	if store == nil {
+		return "", false
+	}
+	rest, ok := strings.CutPrefix(sourceURL, store.URL(UploadPrefix))
+	if !ok || rest == "" {
+		return "", false
+	}
+	unescaped, err := url.PathUnescape(rest)
+	if err != nil {
+		return "", false
+	}
+	key := UploadPrefix + unescaped
+	if path.Clean(key) != key {
+		return "", false
+	}
+	return key, true
+}
+
+// ReadUpload reads the uploaded image under key and checks that it is a supported
+// image within the limits
+func ReadUpload(ctx context.Context, store storage.ObjectStore, key string, maxBytes, maxPixels int64) ([]byte, error) {
+	body, info, err := store.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	if info.Size > maxBytes {
+		return nil, fmt.Errorf("%w: %d bytes is over the limit of %d", ErrImageTooLarge, info.Size, maxBytes)
+	}
+
+	imageBytes, err := io.ReadAll(io.LimitReader(body, maxBytes+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read upload %s: %w", key, err)
+	}
+	if int64(len(imageBytes)) > maxBytes {
+		return nil, fmt.Errorf("%w: over the limit of %d bytes", ErrImageTooLarge, maxBytes)
+	}
+	if _, err := CheckImage(imageBytes, maxPixels); err != nil {
+		return nil, err
+	}
+	return imageBytes, nil
+}
@@ -0,0 +1,244 @@
+package imageprocessor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"product-management/logging"
+	"product-management/metrics"
+	"product-management/tracing"
+	"time"
+
+	"github.com/streadway/amqp"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ImageHandler processes a single job taken from the queue. ctx carries a logger
+// describing the job and the span of the attempt, continuing the publisher's trace.
+type ImageHandler func(ctx context.Context, job ImageJob) error
+
+// FailureHandler is told about every failed attempt; deadLettered is true once
+// the job has exhausted its retries
+type FailureHandler func(ctx context.Context, job ImageJob, err error, deadLettered bool)
+
+// jobContext returns a copy of ctx whose logger describes job, carrying the ID of
+// the request that queued it
+func jobContext(ctx context.Context, job ImageJob) context.Context {
+	if job.RequestID != "" {
+		ctx = logging.WithRequestID(ctx, job.RequestID)
+	}
+	return logging.With(ctx, "correlation_id", job.CorrelationID, "product_id", job.ProductID, "image_index", job.ImageIndex, "attempt", job.Attempt)
+}
+
+// startProcess starts the consumer span for one attempt at job
+func startProcess(ctx context.Context, job ImageJob) (context.Context, trace.Span) {
+	return tracing.Tracer().Start(ctx, QueueName+" process",
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(jobAttributes(job)...),
+	)
+}
+
+const (
+	// reconnectBaseDelay is the wait before the first attempt to reconnect to the
+	// broker; it doubles on each failed attempt up to reconnectMaxDelay
+	reconnectBaseDelay = time.Second
+	reconnectMaxDelay  = 30 * time.Second
+)
+
+// Consume delivers image jobs queued on the broker at url to handle one at a time
+// until ctx is cancelled. Messages are acked only after handle succeeds or the job
+// has been handed to a retry queue. Failed jobs are retried with exponential backoff
+// up to MaxAttempts and then dead-lettered along with malformed messages; permanent
+// failures are dead-lettered on the first attempt. Messages from a newer envelope
+// version are dead-lettered as they are, to be replayed once workers are upgraded;
+// jobs handle rejects with ErrUnsupportedJob take the retry ladder so a worker
+// configured for them gets a chance to pick them up. When the connection to the
+// broker drops, Consume reconnects with backoff.
+func Consume(ctx context.Context, url string, handle ImageHandler, onFailure FailureHandler) error {
+	if _, err := amqp.ParseURI(url); err != nil {
+		return fmt.Errorf("invalid RabbitMQ URL: %w", err)
+	}
+
+	delay := reconnectBaseDelay
+	for {
+		connected, err := consumeSession(ctx, url, handle, onFailure)
+		if ctx.Err() != nil {
+			return nil
+		}
+		if connected {
+			delay = reconnectBaseDelay
+		}
+		slog.Warn("Lost RabbitMQ connection; reconnecting", "error", err, "delay", delay)
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(delay):
+		}
+		delay = min(delay*2, reconnectMaxDelay)
+	}
+}
+
+// consumeSession consumes over one connection to the broker until it drops or
+// ctx is cancelled. connected reports whether the consumer was registered.
+func consumeSession(ctx context.Context, url string, handle ImageHandler, onFailure FailureHandler) (connected bool, err error) {
+	conn, err := amqp.Dial(url)
+	if err != nil {
+		return false, fmt.Errorf("failed to connect to RabbitMQ: %w", err)
+	}
+	defer conn.Close()
+
+	ch, err := conn.Channel()
+	if err != nil {
+		return false, fmt.Errorf("failed to open a channel: %w", err)
+	}
+	defer ch.Close()
+
+	if err := declareTopology(ch); err != nil {
+		return false, err
+	}
+
+	// Only hold one unacknowledged message at a time
+	if err := ch.Qos(1, 0, false); err != nil {
+		return false, fmt.Errorf("failed to set QoS: %w", err)
+	}
+
+	deliveries, err := ch.Consume(
+		QueueName, // queue
+		"",        // consumer
+		false,     // auto-ack
+		false,     // exclusive
+		false,     // no-local
+		false,     // no-wait
+		nil,       // args
+	)
+	if err != nil {
+		return false, fmt.Errorf("failed to register a consumer: %w", err)
+	}
+
+	closed := conn.NotifyClose(make(chan *amqp.Error, 1))
+	slog.Info("Waiting for images", "queue", QueueName)
+	// A job in hand runs to completion after ctx is cancelled
+	jobCtx := context.WithoutCancel(ctx)
+	for {
+		select {
+		case <-ctx.Done():
+			return true, nil
+		case amqpErr := <-closed:
+			return true, fmt.Errorf("RabbitMQ connection closed: %v", amqpErr)
+		case delivery, ok := <-deliveries:
+			if !ok {
+				return true, fmt.Errorf("delivery channel closed")
+			}
+			handleDelivery(jobCtx, ch, delivery, handle, onFailure)
+		}
+	}
+}
+
+// handleDelivery parses one message, runs handle and acknowledges it accordingly
+func handleDelivery(ctx context.Context, ch *amqp.Channel, delivery amqp.Delivery, handle ImageHandler, onFailure FailureHandler) {
+	job, err := ParseImageJob(delivery.ContentType, delivery.Body)
+	if err != nil {
+		ctx = logging.With(ctx, "correlation_id", delivery.CorrelationId)
+		if errors.Is(err, ErrUnsupportedJob) {
+			// Requeueing would hand it straight back to this worker
+			logging.FromContext(ctx).Warn("Dead-lettering unsupported message", "error", err)
+		} else {
+			logging.FromContext(ctx).Warn("Dead-lettering malformed message", "error", err)
+		}
+		settle(ctx, delivery, deadLetterRaw(ch, delivery, err))
+		return
+	}
+
+	if job.IsLegacy() {
+		job.Attempt = legacyAttempt(delivery.Headers)
+	}
+
+	ctx, span := startProcess(tracing.ExtractHeaders(ctx, delivery.Headers), job)
+	defer span.End()
+	ctx = jobContext(ctx, job)
+	start := time.Now()
+	handleErr := handle(ctx, job)
+	metrics.JobDuration.WithLabelValues(metrics.Result(handleErr)).Observe(time.Since(start).Seconds())
+	if handleErr == nil {
+		settle(ctx, delivery, nil)
+		return
+	}
+	tracing.RecordError(span, handleErr)
+
+	logging.FromContext(ctx).Warn("Image job attempt failed", "max_attempts", MaxAttempts, "source_url", job.SourceURL, "error", handleErr)
+	headers := amqp.Table{lastErrorHeader: handleErr.Error()}
+	deadLettered := deadLetters(job, handleErr)
+	if deadLettered {
+		err = publishDeadLetter(ch, delivery.ContentType, delivery.CorrelationId, delivery.Body, headers)
+	} else {
+		retry := job
+		retry.Attempt++
+		err = publishJob(ctx, ch, retryQueueName(retry.Attempt), retry, headers)
+	}
+	if onFailure != nil {
+		onFailure(ctx, job, handleErr, deadLettered)
+	}
+	settle(ctx, delivery, err)
+}
+
+// deadLetters reports whether a failed attempt at job ends its retries. Permanent
+// failures would only fail the same way on every retry.
+func deadLetters(job ImageJob, err error) bool {
+	return job.Attempt >= MaxAttempts || IsPermanent(err)
+}
+
+// legacyAttempt returns the attempt number a legacy message was retried with, or
+// 1 for one straight from an older publisher
+func legacyAttempt(headers amqp.Table) int {
+	switch attempt := headers[attemptHeader].(type) {
+	case int32:
+		return max(int(attempt), 1)
+	case int64:
+		return max(int(attempt), 1)
+	}
+	return 1
+}
+
+// settle acks a delivery once it has been handled or handed off, and requeues it
+// if handing it off failed so the job is never lost
+func settle(ctx context.Context, delivery amqp.Delivery, handoffErr error) {
+	logger := logging.FromContext(ctx)
+	if handoffErr != nil {
+		logger.Warn("Requeueing message", "error", handoffErr)
+		if err := delivery.Nack(false, true); err != nil {
+			logger.Error("Failed to requeue message", "error", err)
+		}
+		return
+	}
+	if err := delivery.Ack(false); err != nil {
+		logger.Error("Failed to ack message", "error", err)
+	}
+}
+
+// deadLetterRaw forwards an unparseable message to the dead-letter exchange unchanged
+func deadLetterRaw(ch *amqp.Channel, delivery amqp.Delivery, cause error) error {
+	return publishDeadLetter(ch, delivery.ContentType, delivery.CorrelationId, delivery.Body, amqp.Table{lastErrorHeader: cause.Error()})
+}
+
+// publishDeadLetter publishes a message body to the dead-letter exchange
+func publishDeadLetter(ch *amqp.Channel, contentType, correlationID string, body []byte, headers amqp.Table) error {
+	err := ch.Publish(
+		DeadLetterExchange, // exchange
+		"",                 // routing key
+		false,              // mandatory
+		false,              // immediate
+		amqp.Publishing{
+			Headers:       headers,
+			ContentType:   contentType,
+			DeliveryMode:  amqp.Persistent,
+			CorrelationId: correlationID,
+			Timestamp:     time.Now(),
+			Body:          body,
+		},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to dead-letter message: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,187 @@
+// Package logging builds the structured slog logger described by logs/logs.json and
+// carries per-request and per-job loggers through contexts
+package logging
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"product-management/config"
+	"strings"
+)
+
+// Config mirrors logs/logs.json
+type Config struct {
+	// Level is debug, info, warn or error
+	Level string `json:"log_level"`
+	// Format is json or text
+	Format  string   `json:"log_format"`
+	Outputs []Output `json:"log_output"`
+}
+
+// Output is one sink every record is written to
+type Output struct {
+	// Type is console, which writes to stdout, or file
+	Type     string `json:"type"`
+	Filename string `json:"filename"`
+	// MaxSize is the size in megabytes at which the file is rotated; 0 means 100
+	MaxSize int `json:"max_size"`
+	// MaxBackups is how many rotated files to keep; 0 keeps them all
+	MaxBackups int `json:"max_backups"`
+	// MaxAge is how many days to keep rotated files; 0 keeps them regardless of age
+	MaxAge int `json:"max_age"`
+}
+
+// DefaultConfig logs text at info level to the console
+func DefaultConfig() Config {
+	return Config{Level: "info", Format: "text", Outputs: []Output{{Type: "console"}}}
+}
+
+// LoadConfig reads a logging configuration file, rejecting keys Config does not have
+func LoadConfig(path string) (Config, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return Config{}, fmt.Errorf("failed to read logging config: %w", err)
+	}
+	defer file.Close()
+
+	var cfg Config
+	decoder := json.NewDecoder(file)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&cfg); err != nil {
+		return Config{}, fmt.Errorf("logging config %s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// ParseLevel parses debug, info, warn or error in any case
+func ParseLevel(level string) (slog.Level, error) {
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(level)); err != nil {
+		return 0, fmt.Errorf("log_level must be debug, info, warn or error, got %q", level)
+	}
+	return l, nil
+}
+
+// New returns a logger writing to every output in cfg, and a Closer for the files
+// it opened
+func New(cfg Config) (*slog.Logger, io.Closer, error) {
+	level, err := ParseLevel(cfg.Level)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(cfg.Outputs) == 0 {
+		return nil, nil, errors.New("log_output must list at least one output")
+	}
+
+	var writers []io.Writer
+	var files closers
+	for i, output := range cfg.Outputs {
+		switch output.Type {
+		case "console":
+			writers = append(writers, os.Stdout)
+		case "file":
+			if output.Filename == "" {
+				files.Close()
+				return nil, nil, fmt.Errorf("log_output[%d]: file outputs need a filename", i)
+			}
+			file := &RotatingFile{
+				Filename:   output.Filename,
+				MaxSize:    int64(output.MaxSize) << 20,
+				MaxBackups: output.MaxBackups,
+				MaxAge:     daysToDuration(output.MaxAge),
+			}
+			writers = append(writers, file)
+			files = append(files, file)
+		default:
+			files.Close()
+			return nil, nil, fmt.Errorf("log_output[%d]: type must be console or file, got %q", i, output.Type)
+		}
+	}
+
+	w := io.MultiWriter(writers...)
+	opts := &slog.HandlerOptions{Level: level}
+	var handler slog.Handler
+	switch strings.ToLower(cfg.Format) {
+	case "json":
+		handler = slog.NewJSONHandler(w, opts)
+	case "text", "":
+		handler = slog.NewTextHandler(w, opts)
+	default:
+		files.Close()
+		return nil, nil, fmt.Errorf("log_format must be json or text, got %q", cfg.Format)
+	}
+	return slog.New(handler), files, nil
+}
+
+// Setup installs the logger described by cfg as the slog and log package default.
+// The returned Closer flushes and closes the log files once nothing logs any more.
+func Setup(cfg config.LogConfig) (io.Closer, error) {
+	logCfg := DefaultConfig()
+	if cfg.Config != "" {
+		loaded, err := LoadConfig(cfg.Config)
+		if err != nil {
+			return nil, err
+		}
+		logCfg = loaded
+	}
+	if cfg.Level != "" {
+		logCfg.Level = cfg.Level
+	}
+
+	logger, files, err := New(logCfg)
+	if err != nil {
+		return nil, err
+	}
+	slog.SetDefault(logger)
+	return files, nil
+}
+
+// closers closes every file output
+type closers []io.Closer
+
+func (c closers) Close() error {
+	var errs []error
+	for _, closer := range c {
+		errs = append(errs, closer.Close())
+	}
+	return errors.Join(errs...)
+}
+
+type contextKey struct{}
+
+type requestIDKey struct{}
+
+// NewContext returns a copy of ctx carrying logger
+func NewContext(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, contextKey{}, logger)
+}
+
+// FromContext returns the logger carried by ctx, or the default logger
+func FromContext(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(contextKey{}).(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
+
+// With returns a copy of ctx whose logger adds args to every record
+func With(ctx context.Context, args ...any) context.Context {
+	return NewContext(ctx, FromContext(ctx).With(args...))
+}
+
+// WithRequestID returns a copy of ctx carrying requestID, whose logger adds it to
+// every record
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return With(context.WithValue(ctx, requestIDKey{}, requestID), "request_id", requestID)
+}
+
+// RequestID returns the ID of the request ctx belongs to, or "" outside a request
+func RequestID(ctx context.Context) string {
+	requestID, _ := ctx.Value(requestIDKey{}).(string)
+	return requestID
+}
@@ -0,0 +1,179 @@
+package logging
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultMaxSize is the rotation size used when RotatingFile.MaxSize is zero
+const defaultMaxSize = 100 << 20
+
+// backupTimeFormat names rotated files so they sort oldest first
+const backupTimeFormat = "2006-01-02T15-04-05.000000000"
+
+// daysToDuration converts the max_age setting to a duration
+func daysToDuration(days int) time.Duration {
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// RotatingFile is an io.Writer appending to Filename. Once a write would take the
+// file past MaxSize it is renamed to name-<timestamp>.ext and a new file is started;
+// rotated files beyond MaxBackups or older than MaxAge are then removed.
+type RotatingFile struct {
+	Filename string
+	// MaxSize is the size in bytes at which the file is rotated; 0 means 100 MiB
+	MaxSize int64
+	// MaxBackups is how many rotated files to keep; 0 keeps them all
+	MaxBackups int
+	// MaxAge is how long to keep rotated files; 0 keeps them regardless of age
+	MaxAge time.Duration
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+}
+
+// Write appends p, opening or rotating the file first when needed
+func (f *RotatingFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.file == nil {
+		if err := f.open(); err != nil {
+			return 0, err
+		}
+	}
+	if f.size > 0 && f.size+int64(len(p)) > f.maxSize() {
+		if err := f.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+// Close closes the current file; a later Write reopens it
+func (f *RotatingFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.file == nil {
+		return nil
+	}
+	err := f.file.Close()
+	f.file = nil
+	return err
+}
+
+// Backups returns the rotated files, oldest first
+func (f *RotatingFile) Backups() ([]string, error) {
+	dir := filepath.Dir(f.Filename)
+	prefix, ext := f.backupPrefix(), filepath.Ext(f.Filename)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list log backups: %w", err)
+	}
+
+	var backups []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.Type().IsRegular() && strings.HasPrefix(name, prefix) && strings.HasSuffix(name, ext) {
+			stamp := strings.TrimSuffix(strings.TrimPrefix(name, prefix), ext)
+			if _, err := time.Parse(backupTimeFormat, stamp); err == nil {
+				backups = append(backups, filepath.Join(dir, name))
+			}
+		}
+	}
+	sort.Strings(backups)
+	return backups, nil
+}
+
+func (f *RotatingFile) maxSize() int64 {
+	if f.MaxSize > 0 {
+		return f.MaxSize
+	}
+	return defaultMaxSize
+}
+
+// backupPrefix is the file name rotated files start with
+func (f *RotatingFile) backupPrefix() string {
+	base := filepath.Base(f.Filename)
+	return strings.TrimSuffix(base, filepath.Ext(base)) + "-"
+}
+
+// open appends to Filename, creating it and its directory when missing
+func (f *RotatingFile) open() error {
+	if err := os.MkdirAll(filepath.Dir(f.Filename), 0o755); err != nil {
+		return fmt.Errorf("failed to create log directory: %w", err)
+	}
+	file, err := os.OpenFile(f.Filename, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open log file: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("failed to open log file: %w", err)
+	}
+	f.file, f.size = file, info.Size()
+	return nil
+}
+
+// rotate moves the current file aside, starts a new one and prunes old backups
+func (f *RotatingFile) rotate() error {
+	if err := f.file.Close(); err != nil {
+		return fmt.Errorf("failed to close log file: %w", err)
+	}
+	f.file = nil
+
+	backup := filepath.Join(filepath.Dir(f.Filename), f.backupPrefix()+time.Now().UTC().Format(backupTimeFormat)+filepath.Ext(f.Filename))
+	if err := os.Rename(f.Filename, backup); err != nil {
+		return fmt.Errorf("failed to rotate log file: %w", err)
+	}
+	if err := f.open(); err != nil {
+		return err
+	}
+	// A failed cleanup must not lose the record being written
+	if err := f.prune(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+	}
+	return nil
+}
+
+// prune removes backups beyond MaxBackups and those older than MaxAge
+func (f *RotatingFile) prune() error {
+	if f.MaxBackups <= 0 && f.MaxAge <= 0 {
+		return nil
+	}
+	backups, err := f.Backups()
+	if err != nil {
+		return err
+	}
+
+	var remove []string
+	if f.MaxBackups > 0 && len(backups) > f.MaxBackups {
+		remove = append(remove, backups[:len(backups)-f.MaxBackups]...)
+		backups = backups[len(backups)-f.MaxBackups:]
+	}
+	if f.MaxAge > 0 {
+		cutoff := time.Now().Add(-f.MaxAge)
+		for _, backup := range backups {
+			if info, err := os.Stat(backup); err == nil && info.ModTime().Before(cutoff) {
+				remove = append(remove, backup)
+			}
+		}
+	}
+
+	for _, backup := range remove {
+		if err := os.Remove(backup); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove old log file: %w", err)
+		}
+	}
+	return nil
+}
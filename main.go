@@ -1,34 +1,89 @@
 package main
 
 import (
+	"context"
 	"log"
-	"net/http"
+	"log/slog"
+	"os"
+	"os/signal"
 	"product-management/api"
 	"product-management/cache"
 	"product-management/config"
 	"product-management/db"
+	"product-management/logging"
+	"product-management/metrics"
+	"product-management/server"
+	"product-management/tracing"
+	"syscall"
 
 	"github.com/gorilla/mux"
 )
 
 func main() {
-	// Load configuration
-	config.LoadConfig()
+	// Load configuration; CONFIG_FILE optionally names a YAML or JSON file
+	cfg, err := config.Load(os.Getenv("CONFIG_FILE"), ".env")
+	migrating := len(os.Args) > 1 && os.Args[1] == "migrate"
+	if err == nil && !migrating {
+		// Migrations neither issue nor check session tokens
+		err = cfg.Auth.Validate()
+	}
+	if err != nil {
+		log.Fatalf("Error loading configuration: %v", err)
+	}
+	logFiles, err := logging.Setup(cfg.Log)
+	if err != nil {
+		log.Fatalf("Error setting up logging: %v", err)
+	}
+	stopTracing, err := tracing.Setup(context.Background(), cfg.Tracing, "")
+	if err != nil {
+		slog.Error("Error setting up tracing", "error", err)
+		os.Exit(1)
+	}
 
 	// Initialize database connection
-	db.InitDB()
+	db.InitDB(cfg.DB)
+	if err := metrics.RegisterDB("postgres", db.DB); err != nil {
+		slog.Warn("Failed to export database pool metrics", "error", err)
+	}
+
+	// `product-management migrate ...` manages the schema and exits
+	if migrating {
+		if err := runMigrate(context.Background(), os.Args[2:]); err != nil {
+			slog.Error("Migration failed", "error", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if cfg.DB.AutoMigrate {
+		applied, err := db.Migrate(context.Background())
+		if err != nil {
+			slog.Error("Error applying migrations", "error", err)
+			os.Exit(1)
+		}
+		slog.Info("Applied pending migrations", "count", len(applied))
+	}
 
 	// Initialize Redis client
-	cache.InitRedis()
+	cache.InitRedis(cfg.Redis)
 
-	// Set up router and routes
+	// Set up router and routes; /readyz follows the server's readiness flag
 	router := mux.NewRouter()
-	api.RegisterRoutes(router)
+	srv := server.New(router, server.OptionsFromConfig(cfg.Server))
+	api.RegisterRoutes(router, cfg, srv.Ready)
 
-	// Start the server
-	log.Println("Server is running on port 8080...")
-	err := http.ListenAndServe(":8080", router)
-	if err != nil {
-		log.Fatalf("Error starting server: %v", err)
+	// Serve until SIGINT or SIGTERM, then drain requests and close the pools in order
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	srv.OnShutdown("database pool", func(context.Context) error { return db.DB.Close() })
+	srv.OnShutdown("Redis client", func(context.Context) error { return cache.RedisClient.Close() })
+	srv.OnShutdown("trace exporter", stopTracing)
+	if err := srv.Run(ctx); err != nil {
+		slog.Error("Server shut down with errors", "error", err)
+		logFiles.Close()
+		os.Exit(1)
 	}
+	slog.Info("Server shut down")
+	logFiles.Close()
 }
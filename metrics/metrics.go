@@ -0,0 +1,132 @@
+// Package metrics holds the Prometheus metrics of the API and the image worker and
+// serves them on /metrics
+package metrics
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Cache results counted by CacheRequests
+const (
+	CacheHit   = "hit"
+	CacheMiss  = "miss"
+	CacheError = "error"
+)
+
+// Image processing stages timed by StageDuration
+const (
+	StageDownload = "download"
+	StageCompress = "compress"
+	StageUpload   = "upload"
+)
+
+// Outcomes counted by JobsPublished and timed by JobDuration
+const (
+	ResultSuccess = "success"
+	ResultFailure = "failure"
+)
+
+// Registry holds every metric served by Handler, along with Go runtime and
+// process metrics
+var Registry = prometheus.NewRegistry()
+
+var (
+	// RequestDuration times HTTP requests by method, mux route template and status
+	RequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "Latency of HTTP requests by route template.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	// CacheRequests counts product cache lookups by result
+	CacheRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "product_cache_requests_total",
+		Help: "Product cache lookups by result: hit, miss or error.",
+	}, []string{"result"})
+
+	// JobsPublished counts image jobs published to the queue by result
+	JobsPublished = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "image_jobs_published_total",
+		Help: "Image jobs published to the queue by result.",
+	}, []string{"result"})
+
+	// JobDuration times the worker's handling of one image job by result
+	JobDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "image_job_duration_seconds",
+		Help:    "Time the image worker spent on one job by result.",
+		Buckets: []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60},
+	}, []string{"result"})
+
+	// StageDuration times each successful step of processing an image
+	StageDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "image_processing_stage_duration_seconds",
+		Help:    "Time spent in each image processing stage: download, compress or upload.",
+		Buckets: []float64{0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30},
+	}, []string{"stage"})
+
+	// StageFailures counts image processing failures by the stage that failed
+	StageFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "image_processing_stage_failures_total",
+		Help: "Image processing failures by stage: download, compress or upload.",
+	}, []string{"stage"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		RequestDuration,
+		CacheRequests,
+		JobsPublished,
+		JobDuration,
+		StageDuration,
+		StageFailures,
+	)
+}
+
+// Handler serves every registered metric in the Prometheus text format
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry})
+}
+
+// RegisterDB exports the connection pool stats of db labelled with name.
+// Registering a name twice keeps the first pool.
+func RegisterDB(name string, db *sql.DB) error {
+	err := Registry.Register(collectors.NewDBStatsCollector(db, name))
+	var registered prometheus.AlreadyRegisteredError
+	if errors.As(err, &registered) {
+		return nil
+	}
+	return err
+}
+
+// ObserveRequest records one HTTP request
+func ObserveRequest(method, route string, status int, elapsed time.Duration) {
+	RequestDuration.WithLabelValues(method, route, strconv.Itoa(status)).Observe(elapsed.Seconds())
+}
+
+// ObserveStage records one run of an image processing stage, counting it as a
+// failure when err is not nil
+func ObserveStage(stage string, start time.Time, err error) {
+	if err != nil {
+		StageFailures.WithLabelValues(stage).Inc()
+		return
+	}
+	StageDuration.WithLabelValues(stage).Observe(time.Since(start).Seconds())
+}
+
+// Result returns ResultSuccess when err is nil and ResultFailure otherwise
+func Result(err error) string {
+	if err != nil {
+		return ResultFailure
+	}
+	return ResultSuccess
+}
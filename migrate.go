@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"product-management/db"
+	"strconv"
+	"text/tabwriter"
+)
+
+const migrateUsage = `usage: product-management migrate <command>
+
+commands:
+  up         apply every pending migration
+  down [n]   roll back the last n applied migrations (default 1)
+  status     list migrations and whether they have been applied
+  redo       roll back the last applied migration and apply it again`
+
+// runMigrate handles the migrate subcommand against the configured database
+func runMigrate(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("missing migrate command\n%s", migrateUsage)
+	}
+
+	migrations, err := db.Migrations()
+	if err != nil {
+		return err
+	}
+	migrator := db.NewMigrator(db.DB, migrations)
+
+	switch args[0] {
+	case "up":
+		applied, err := migrator.Up(ctx)
+		printMigrations("Applied", applied)
+		if err == nil && len(applied) == 0 {
+			fmt.Println("No pending migrations")
+		}
+		return err
+
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			steps, err = strconv.Atoi(args[1])
+			if err != nil || steps < 1 {
+				return fmt.Errorf("down expects a positive number of migrations, got %q", args[1])
+			}
+		}
+		rolledBack, err := migrator.Down(ctx, steps)
+		printMigrations("Rolled back", rolledBack)
+		return err
+
+	case "redo":
+		redone, err := migrator.Redo(ctx)
+		if redone != nil {
+			printMigrations("Redid", []db.Migration{*redone})
+		}
+		return err
+
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED AT")
+		for _, status := range statuses {
+			appliedAt := "pending"
+			if status.Applied {
+				appliedAt = status.AppliedAt.Format("2006-01-02 15:04:05 MST")
+			}
+			fmt.Fprintf(w, "%03d\t%s\t%s\n", status.Version, status.Name, appliedAt)
+		}
+		return w.Flush()
+
+	default:
+		return fmt.Errorf("unknown migrate command %q\n%s", args[0], migrateUsage)
+	}
+}
+
+// printMigrations reports each migration a command changed
+func printMigrations(action string, migrations []db.Migration) {
+	for _, migration := range migrations {
+		fmt.Printf("%s %03d_%s\n", action, migration.Version, migration.Name)
+	}
+}
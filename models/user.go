@@ -1,7 +1,26 @@
 package models
 
+// Roles a user can hold
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
 type User struct {
 	ID       int    `json:"id"`
+	Username string `json:"username"`
+	// Password holds the bcrypt hash and is never serialized
+	Password string `json:"-"`
+	Role     string `json:"role"`
+}
+
+// IsAdmin reports whether the user holds the admin role
+func (u *User) IsAdmin() bool {
+	return u != nil && u.Role == RoleAdmin
+}
+
+// Credentials is the payload accepted by registration and login
+type Credentials struct {
 	Username string `json:"username"`
 	Password string `json:"password"`
 }
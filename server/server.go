@@ -0,0 +1,141 @@
+// Package server runs the HTTP API and shuts it and its dependencies down in order
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"product-management/config"
+	"sync/atomic"
+	"time"
+)
+
+// Options configures the HTTP server and its shutdown
+type Options struct {
+	Addr         string
+	ReadTimeout  time.Duration
+	WriteTimeout time.Duration
+	IdleTimeout  time.Duration
+	// DrainDelay is how long Ready reports false before the listener closes
+	DrainDelay time.Duration
+	// ShutdownTimeout bounds draining in-flight requests and running the shutdown hooks
+	ShutdownTimeout time.Duration
+}
+
+// OptionsFromConfig returns the Options described by cfg
+func OptionsFromConfig(cfg config.ServerConfig) Options {
+	return Options{
+		Addr:            cfg.Addr(),
+		ReadTimeout:     cfg.ReadTimeout,
+		WriteTimeout:    cfg.WriteTimeout,
+		IdleTimeout:     cfg.IdleTimeout,
+		DrainDelay:      cfg.DrainDelay,
+		ShutdownTimeout: cfg.ShutdownTimeout,
+	}
+}
+
+// Hook is a named shutdown step, such as closing a connection pool
+type Hook struct {
+	Name string
+	Stop func(ctx context.Context) error
+}
+
+// Server is an http.Server with a readiness flag and ordered shutdown hooks
+type Server struct {
+	http  *http.Server
+	opts  Options
+	ready atomic.Bool
+	hooks []Hook
+}
+
+// New returns a Server that serves handler once Run or Serve is called
+func New(handler http.Handler, opts Options) *Server {
+	return &Server{
+		http: &http.Server{
+			Addr:         opts.Addr,
+			Handler:      handler,
+			ReadTimeout:  opts.ReadTimeout,
+			WriteTimeout: opts.WriteTimeout,
+			IdleTimeout:  opts.IdleTimeout,
+		},
+		opts: opts,
+	}
+}
+
+// Ready reports whether the server is serving and not shutting down
+func (s *Server) Ready() bool {
+	return s.ready.Load()
+}
+
+// OnShutdown registers a step to run once in-flight requests have drained. Steps
+// run in the order they were registered, so register dependents before what they use.
+func (s *Server) OnShutdown(name string, stop func(ctx context.Context) error) {
+	s.hooks = append(s.hooks, Hook{Name: name, Stop: stop})
+}
+
+// Run listens on Options.Addr and serves until ctx is cancelled, then shuts down
+func (s *Server) Run(ctx context.Context) error {
+	ln, err := net.Listen("tcp", s.opts.Addr)
+	if err != nil {
+		return errors.Join(fmt.Errorf("failed to listen on %s: %w", s.opts.Addr, err), s.stopHooks())
+	}
+	return s.Serve(ctx, ln)
+}
+
+// Serve serves on ln until ctx is cancelled or serving fails. It then marks the
+// server not ready, waits DrainDelay, stops accepting connections, waits for
+// in-flight requests to finish and runs the shutdown hooks.
+func (s *Server) Serve(ctx context.Context, ln net.Listener) error {
+	served := make(chan error, 1)
+	go func() { served <- s.http.Serve(ln) }()
+	s.ready.Store(true)
+	slog.Info("Server is listening", "addr", ln.Addr().String())
+
+	select {
+	case err := <-served:
+		// Serving failed before shutdown was requested
+		s.ready.Store(false)
+		return errors.Join(fmt.Errorf("server stopped: %w", err), s.stopHooks())
+	case <-ctx.Done():
+	}
+
+	s.ready.Store(false)
+	slog.Info("Shutting down: draining in-flight requests", "drain_delay", s.opts.DrainDelay)
+	time.Sleep(s.opts.DrainDelay)
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), s.opts.ShutdownTimeout)
+	defer cancel()
+
+	var drainErr error
+	if err := s.http.Shutdown(shutdownCtx); err != nil {
+		drainErr = fmt.Errorf("failed to drain in-flight requests: %w", err)
+		s.http.Close()
+	}
+	if err := <-served; !errors.Is(err, http.ErrServerClosed) {
+		drainErr = errors.Join(drainErr, err)
+	}
+	return errors.Join(drainErr, Shutdown(shutdownCtx, s.hooks...))
+}
+
+// stopHooks runs the shutdown hooks under a fresh ShutdownTimeout
+func (s *Server) stopHooks() error {
+	ctx, cancel := context.WithTimeout(context.Background(), s.opts.ShutdownTimeout)
+	defer cancel()
+	return Shutdown(ctx, s.hooks...)
+}
+
+// Shutdown runs hooks in order, carrying on past failures, and returns every error
+func Shutdown(ctx context.Context, hooks ...Hook) error {
+	var errs []error
+	for _, hook := range hooks {
+		if err := hook.Stop(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("failed to stop %s: %w", hook.Name, err))
+			continue
+		}
+		slog.Info("Stopped " + hook.Name)
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,61 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"product-management/models"
+)
+
+// ErrForbidden is returned when the caller may not act on a product
+var ErrForbidden = errors.New("forbidden")
+
+// CanModifyProduct is the single ownership policy for product mutations:
+// only the owning user or an admin may update, delete or re-process images.
+func CanModifyProduct(user *models.User, product *Product) error {
+	if user == nil || product == nil {
+		return ErrForbidden
+	}
+	if user.IsAdmin() || user.ID == product.UserID {
+		return nil
+	}
+	return ErrForbidden
+}
+
+// CanAssignOwner reports whether user may move a product to a different owner
+func CanAssignOwner(user *models.User, product *Product, ownerID int) error {
+	if ownerID == product.UserID || user.IsAdmin() {
+		return nil
+	}
+	return ErrForbidden
+}
+
+// AuthorizeProductMutation loads the caller and the product and applies CanModifyProduct.
+// It returns ErrUserNotFound, ErrProductNotFound or ErrForbidden when the mutation is not allowed.
+func AuthorizeProductMutation(ctx context.Context, products ProductRepository, users UserRepository, userID, productID int) (*Product, *models.User, error) {
+	user, err := users.GetByID(ctx, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	product, err := products.GetByID(ctx, productID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := CanModifyProduct(user, product); err != nil {
+		return nil, nil, err
+	}
+	return product, user, nil
+}
+
+// RequireAdmin loads the caller and returns ErrForbidden unless they hold the admin role
+func RequireAdmin(ctx context.Context, users UserRepository, userID int) (*models.User, error) {
+	user, err := users.GetByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !user.IsAdmin() {
+		return nil, ErrForbidden
+	}
+	return user, nil
+}
@@ -0,0 +1,172 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"product-management/logging"
+	"product-management/metrics"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"golang.org/x/sync/singleflight"
+)
+
+// ProductCache is the Redis cache of serialized products. A nil *ProductCache
+// caches nothing, so every read goes to the repository.
+type ProductCache struct {
+	client *redis.Client
+	ttl    time.Duration
+}
+
+// NewProductCache returns a cache keeping products in client for ttl, or nil when
+// client is nil
+func NewProductCache(client *redis.Client, ttl time.Duration) *ProductCache {
+	if client == nil {
+		return nil
+	}
+	return &ProductCache{client: client, ttl: ttl}
+}
+
+// productLoads collapses concurrent cache misses for the same product into one DB query
+var productLoads singleflight.Group
+
+// productCacheKey is the Redis key holding a serialized product
+func productCacheKey(id int) string {
+	return "product:" + strconv.Itoa(id)
+}
+
+// productGenerationKey is the Redis key counting the invalidations of a product
+func productGenerationKey(id int) string {
+	return productCacheKey(id) + ":gen"
+}
+
+// cacheIfCurrent stores a loaded product only if the product's generation is
+// still the one read before the load, so a load that raced an invalidation
+// cannot put the stale product back
+var cacheIfCurrent = redis.NewScript(`
+local gen = redis.call("GET", KEYS[2]) or ""
+if gen ~= ARGV[1] then
+	return 0
+end
+if tonumber(ARGV[3]) > 0 then
+	redis.call("SET", KEYS[1], ARGV[2], "PX", ARGV[3])
+else
+	redis.call("SET", KEYS[1], ARGV[2])
+end
+return 1
+`)
+
+// GetProductCached reads a product through the Redis cache. Misses are loaded
+// from the database once per key no matter how many callers are waiting, and
+// Redis errors fall back to the database so the cache never causes an outage.
+func GetProductCached(ctx context.Context, products ProductRepository, cache *ProductCache, id int) (*Product, error) {
+	if cache == nil {
+		return products.GetByID(ctx, id)
+	}
+
+	key := productCacheKey(id)
+	cached, err := cache.client.Get(ctx, key).Bytes()
+	switch {
+	case err == nil:
+		var product Product
+		if err := json.Unmarshal(cached, &product); err == nil {
+			metrics.CacheRequests.WithLabelValues(metrics.CacheHit).Inc()
+			return &product, nil
+		}
+		logging.FromContext(ctx).Warn("Discarding unreadable cache entry", "key", key)
+		metrics.CacheRequests.WithLabelValues(metrics.CacheMiss).Inc()
+	case errors.Is(err, redis.Nil):
+		metrics.CacheRequests.WithLabelValues(metrics.CacheMiss).Inc()
+	default:
+		logging.FromContext(ctx).Warn("Redis read failed", "key", key, "error", err)
+		metrics.CacheRequests.WithLabelValues(metrics.CacheError).Inc()
+	}
+
+	loaded, err, _ := productLoads.Do(key, func() (interface{}, error) {
+		// The load is shared, so one caller giving up must not fail the others
+		ctx := context.WithoutCancel(ctx)
+		gen, genErr := cache.client.Get(ctx, productGenerationKey(id)).Result()
+		if errors.Is(genErr, redis.Nil) {
+			gen, genErr = "", nil
+		}
+		product, err := products.GetByID(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if genErr == nil {
+			cacheLoadedProduct(ctx, cache, product, gen)
+		}
+		return product, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Each caller gets its own copy so shared results are never mutated
+	product := *loaded.(*Product)
+	return &product, nil
+}
+
+// CacheProduct stores a product in Redis for the cache's TTL
+func CacheProduct(ctx context.Context, cache *ProductCache, product *Product) {
+	if cache == nil {
+		return
+	}
+
+	data, err := json.Marshal(product)
+	if err != nil {
+		logging.FromContext(ctx).Error("Failed to encode product for cache", "product_id", product.ID, "error", err)
+		return
+	}
+
+	key := productCacheKey(product.ID)
+	if err := cache.client.Set(ctx, key, data, cache.ttl).Err(); err != nil {
+		logging.FromContext(ctx).Warn("Redis write failed", "key", key, "error", err)
+	}
+}
+
+// cacheLoadedProduct stores a product read from the database unless it was
+// invalidated since gen was read
+func cacheLoadedProduct(ctx context.Context, cache *ProductCache, product *Product, gen string) {
+	data, err := json.Marshal(product)
+	if err != nil {
+		logging.FromContext(ctx).Error("Failed to encode product for cache", "product_id", product.ID, "error", err)
+		return
+	}
+
+	key := productCacheKey(product.ID)
+	keys := []string{key, productGenerationKey(product.ID)}
+	if err := cacheIfCurrent.Run(ctx, cache.client, keys, gen, data, cache.ttl.Milliseconds()).Err(); err != nil {
+		logging.FromContext(ctx).Warn("Redis write failed", "key", key, "error", err)
+	}
+}
+
+// InvalidateProduct removes a product from the cache after it changes. It also
+// bumps the product's generation so a load already reading the old row does not
+// cache it afterwards.
+func InvalidateProduct(ctx context.Context, cache *ProductCache, id int) error {
+	if cache == nil {
+		return nil
+	}
+
+	key := productCacheKey(id)
+	genKey := productGenerationKey(id)
+	_, err := cache.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Incr(ctx, genKey)
+		if cache.ttl > 0 {
+			// The generation only has to outlive the loads in flight
+			pipe.PExpire(ctx, genKey, cache.ttl)
+		}
+		pipe.Del(ctx, key)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to invalidate %s: %w", key, err)
+	}
+	// Callers arriving from now on start a fresh load rather than join the old one
+	productLoads.Forget(key)
+	return nil
+}
@@ -0,0 +1,56 @@
+package models
+
+import "time"
+
+// Image processing states, per image and summarized per product
+const (
+	ImageStatusPending    = "pending"
+	ImageStatusProcessing = "processing"
+	ImageStatusDone       = "done"
+	ImageStatusFailed     = "failed"
+)
+
+// ImageStatus tracks the processing of one product image
+type ImageStatus struct {
+	ImageIndex    int       `json:"image_index"`
+	SourceURL     string    `json:"source_url"`
+	Status        string    `json:"status"`
+	Attempts      int       `json:"attempts"`
+	LastError     string    `json:"last_error,omitempty"`
+	CorrelationID string    `json:"correlation_id"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// ProductImageStatus is the processing state of every image of a product
+type ProductImageStatus struct {
+	ProductID int           `json:"product_id"`
+	Status    string        `json:"status"`
+	Images    []ImageStatus `json:"images"`
+}
+
+// newProductImageStatus summarizes the images of a product, sorted by index
+func newProductImageStatus(productID int, images []ImageStatus) *ProductImageStatus {
+	if images == nil {
+		images = []ImageStatus{}
+	}
+	return &ProductImageStatus{ProductID: productID, Status: SummarizeImageStatus(images), Images: images}
+}
+
+// SummarizeImageStatus reduces per-image states to one product state: failed if any
+// image failed, otherwise processing or pending while work remains, otherwise done
+func SummarizeImageStatus(images []ImageStatus) string {
+	summary := ImageStatusDone
+	for _, image := range images {
+		switch image.Status {
+		case ImageStatusFailed:
+			return ImageStatusFailed
+		case ImageStatusProcessing:
+			summary = ImageStatusProcessing
+		case ImageStatusPending:
+			if summary == ImageStatusDone {
+				summary = ImageStatusPending
+			}
+		}
+	}
+	return summary
+}
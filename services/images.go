@@ -0,0 +1,49 @@
+package models
+
+import (
+	"context"
+	imageprocessor "product-management/image-processor"
+	"product-management/logging"
+)
+
+// QueueImageProcessing publishes one image job per product image to queue and
+// marks each image as pending. Jobs carry the request ID and trace context found in ctx.
+func QueueImageProcessing(ctx context.Context, products ProductRepository, queue imageprocessor.JobQueue, productID int, images []string) error {
+	for index, imageURL := range images {
+		if err := QueueImage(ctx, products, queue, productID, index, imageURL); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// QueueImage publishes the job for the product image at index and marks it as pending
+func QueueImage(ctx context.Context, products ProductRepository, queue imageprocessor.JobQueue, productID, index int, imageURL string) error {
+	job := imageprocessor.NewImageJob(productID, index, imageURL)
+	job.RequestID = logging.RequestID(ctx)
+	if err := queue.Publish(ctx, job); err != nil {
+		return err
+	}
+	return RecordJobStatus(ctx, products, job, ImageStatusPending, nil)
+}
+
+// RecordJobStatus stores the state of the image a job refers to; attempts counts
+// the attempts that have finished
+func RecordJobStatus(ctx context.Context, products ProductRepository, job imageprocessor.ImageJob, status string, lastErr error) error {
+	attempts := job.Attempt - 1
+	if status == ImageStatusDone || status == ImageStatusFailed || lastErr != nil {
+		attempts = job.Attempt
+	}
+
+	image := ImageStatus{
+		ImageIndex:    job.ImageIndex,
+		SourceURL:     job.SourceURL,
+		Status:        status,
+		Attempts:      attempts,
+		CorrelationID: job.CorrelationID,
+	}
+	if lastErr != nil {
+		image.LastError = lastErr.Error()
+	}
+	return products.RecordImageStatus(ctx, job.ProductID, image)
+}
@@ -0,0 +1,517 @@
+package models
+
+import (
+	"context"
+	"maps"
+	imageprocessor "product-management/image-processor"
+	"product-management/models"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// MemoryProductRepository is a ProductRepository kept in process memory. It mirrors
+// the Postgres filters, sorting and keyset pagination so handlers can be exercised
+// without a database; search matches word prefixes without stemming.
+type MemoryProductRepository struct {
+	mu       sync.Mutex
+	nextID   int
+	products map[int]Product
+	images   map[int]map[int]ImageStatus
+	// renditions holds the renditions of each product's images by image index
+	renditions map[int]map[int]ProductImage
+}
+
+// NewMemoryProductRepository returns an empty in-memory ProductRepository
+func NewMemoryProductRepository() *MemoryProductRepository {
+	return &MemoryProductRepository{
+		products:   map[int]Product{},
+		images:     map[int]map[int]ImageStatus{},
+		renditions: map[int]map[int]ProductImage{},
+	}
+}
+
+// Create stores a copy of the product under the next ID
+func (r *MemoryProductRepository) Create(ctx context.Context, p *Product) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.nextID++
+	p.ID = r.nextID
+	p.CreatedAt = time.Now().UTC()
+	p.CompressedProductImages = []string{}
+	p.Images = imagesFor(p.ProductImages, nil)
+	r.products[p.ID] = cloneProduct(*p)
+	return nil
+}
+
+// GetByID returns a copy of the stored product
+func (r *MemoryProductRepository) GetByID(ctx context.Context, id int) (*Product, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	product, ok := r.products[id]
+	if !ok {
+		return nil, ErrProductNotFound
+	}
+	product = cloneProduct(product)
+	return &product, nil
+}
+
+// Update overwrites the mutable fields of the stored product identified by p.ID
+func (r *MemoryProductRepository) Update(ctx context.Context, p *Product) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, ok := r.products[p.ID]
+	if !ok {
+		return ErrProductNotFound
+	}
+	renditions, compressed := keepImages(stored.ProductImages, stored.CompressedProductImages, r.renditions[p.ID], p.ProductImages)
+	stored.UserID = p.UserID
+	stored.ProductName = p.ProductName
+	stored.ProductDescription = p.ProductDescription
+	stored.ProductImages = p.ProductImages
+	stored.ProductPrice = p.ProductPrice
+	stored.CompressedProductImages = compressed
+	stored.Images = imagesFor(stored.ProductImages, renditions)
+	r.renditions[p.ID] = renditions
+	r.products[p.ID] = cloneProduct(stored)
+	*p = cloneProduct(stored)
+	return nil
+}
+
+// keepImages returns the renditions and compressed copies of the previous images
+// that stay at the same position in sources, dropping the rest as the Postgres
+// update does
+func keepImages(previous, compressed []string, stored map[int]ProductImage, sources []string) (map[int]ProductImage, []string) {
+	kept := func(i int) bool { return i < len(previous) && i < len(sources) && previous[i] == sources[i] }
+
+	renditions := map[int]ProductImage{}
+	for i, image := range stored {
+		if kept(i) && image.SourceURL == sources[i] {
+			renditions[i] = image
+		}
+	}
+	keptCompressed := []string{}
+	last := -1
+	for i, url := range compressed {
+		if !kept(i) {
+			url = ""
+		}
+		if url != "" {
+			last = i
+		}
+		keptCompressed = append(keptCompressed, url)
+	}
+	return renditions, keptCompressed[:last+1]
+}
+
+// Delete removes a product along with its image states
+func (r *MemoryProductRepository) Delete(ctx context.Context, id int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.products[id]; !ok {
+		return ErrProductNotFound
+	}
+	delete(r.products, id)
+	delete(r.images, id)
+	delete(r.renditions, id)
+	return nil
+}
+
+// List returns one page of products matching filter
+func (r *MemoryProductRepository) List(ctx context.Context, filter ProductFilter, page PageRequest) (*ProductPage, error) {
+	rows := r.selectRows(filter, page)
+	products := make([]Product, len(rows))
+	for i, row := range rows {
+		products[i] = row.product
+	}
+	return page.newPage(products)
+}
+
+// Search returns one page of products matching filter.Search
+func (r *MemoryProductRepository) Search(ctx context.Context, filter ProductFilter, page PageRequest) (*SearchPage, error) {
+	if filter.Search == "" {
+		return nil, ErrInvalidSearch
+	}
+
+	rows := r.selectRows(filter, page)
+	terms := searchTerms(filter.Search)
+	results := make([]SearchResult, len(rows))
+	for i, row := range rows {
+		results[i] = SearchResult{
+			Product: row.product,
+			Rank:    row.rank,
+			Highlights: SearchHighlights{
+				ProductName:        markHighlights(highlightTerms(row.product.ProductName, terms)),
+				ProductDescription: markHighlights(highlightTerms(row.product.ProductDescription, terms)),
+			},
+		}
+	}
+	return page.newSearchPage(results)
+}
+
+// AddImage appends sourceURL to the stored product's images
+func (r *MemoryProductRepository) AddImage(ctx context.Context, productID int, sourceURL string) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	product, ok := r.products[productID]
+	if !ok {
+		return 0, ErrProductNotFound
+	}
+	product.ProductImages = append(append([]string{}, product.ProductImages...), sourceURL)
+	product.Images = imagesFor(product.ProductImages, r.renditions[productID])
+	r.products[productID] = product
+	return len(product.ProductImages) - 1, nil
+}
+
+// SetImageRenditions stores the renditions of the image at index if the product
+// still has sourceURL there, keeping those stored for the same source that
+// renditions does not replace
+func (r *MemoryProductRepository) SetImageRenditions(ctx context.Context, productID, index int, sourceURL, compressedURL string, renditions imageprocessor.Renditions) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	product, ok := r.products[productID]
+	if !ok || index < 0 || index >= len(product.ProductImages) || product.ProductImages[index] != sourceURL {
+		return ErrProductNotFound
+	}
+
+	if r.renditions[productID] == nil {
+		r.renditions[productID] = map[int]ProductImage{}
+	}
+	merged := imageprocessor.Renditions{}
+	if stored, ok := r.renditions[productID][index]; ok && stored.SourceURL == sourceURL {
+		maps.Copy(merged, stored.Renditions)
+	}
+	maps.Copy(merged, renditions)
+	r.renditions[productID][index] = ProductImage{SourceURL: sourceURL, Renditions: merged}
+	product.Images = imagesFor(product.ProductImages, r.renditions[productID])
+
+	if compressedURL != "" {
+		// Gaps left by images that are still processing read as empty strings, as in Postgres
+		compressed := append([]string{}, product.CompressedProductImages...)
+		for len(compressed) <= index {
+			compressed = append(compressed, "")
+		}
+		compressed[index] = compressedURL
+		product.CompressedProductImages = compressed
+	}
+	r.products[productID] = product
+	return nil
+}
+
+// AddCompressedImage stores compressedURL at the position of sourceURL in the
+// compressed images of every product referencing it, skipping those that
+// already have it there
+func (r *MemoryProductRepository) AddCompressedImage(ctx context.Context, sourceURL, compressedURL string) ([]int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var ids []int
+	for id, product := range r.products {
+		index := slices.Index(product.ProductImages, sourceURL)
+		if index < 0 || (index < len(product.CompressedProductImages) && product.CompressedProductImages[index] == compressedURL) {
+			continue
+		}
+		compressed := append([]string{}, product.CompressedProductImages...)
+		for len(compressed) <= index {
+			compressed = append(compressed, "")
+		}
+		compressed[index] = compressedURL
+		product.CompressedProductImages = compressed
+		r.products[id] = product
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	return ids, nil
+}
+
+// RecordImageStatus stores the processing state of one product image
+func (r *MemoryProductRepository) RecordImageStatus(ctx context.Context, productID int, image ImageStatus) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// Mirrors the foreign key on product_image_jobs
+	if _, ok := r.products[productID]; !ok {
+		return ErrProductNotFound
+	}
+	if r.images[productID] == nil {
+		r.images[productID] = map[int]ImageStatus{}
+	}
+	image.UpdatedAt = time.Now().UTC()
+	r.images[productID][image.ImageIndex] = image
+	return nil
+}
+
+// GetImageStatus returns the recorded states of a product's images, sorted by index
+func (r *MemoryProductRepository) GetImageStatus(ctx context.Context, productID int) (*ProductImageStatus, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var images []ImageStatus
+	for _, image := range r.images[productID] {
+		images = append(images, image)
+	}
+	sort.Slice(images, func(i, j int) bool { return images[i].ImageIndex < images[j].ImageIndex })
+	return newProductImageStatus(productID, images), nil
+}
+
+// memoryRow is a stored product with its rank for the current search
+type memoryRow struct {
+	product Product
+	rank    float64
+}
+
+// selectRows returns the products on the requested page plus one extra row, like
+// the LIMIT of the SQL queries, so newPage can tell whether another page exists
+func (r *MemoryProductRepository) selectRows(filter ProductFilter, page PageRequest) []memoryRow {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var after interface{}
+	if page.after != nil {
+		after, _ = page.after.sortValue()
+	}
+
+	terms := searchTerms(filter.Search)
+	var rows []memoryRow
+	for _, product := range r.products {
+		if !filter.matches(product) {
+			continue
+		}
+		row := memoryRow{product: cloneProduct(product)}
+		if len(terms) > 0 {
+			row.rank, _ = rankProduct(product, terms)
+		}
+		if page.after != nil && page.compare(page.position(row.product, row.rank), row.product.ID, after, page.after.ID) <= 0 {
+			continue
+		}
+		rows = append(rows, row)
+	}
+
+	sort.Slice(rows, func(i, j int) bool {
+		a, b := rows[i], rows[j]
+		return page.compare(page.position(a.product, a.rank), a.product.ID, page.position(b.product, b.rank), b.product.ID) < 0
+	})
+	if len(rows) > page.Limit+1 {
+		rows = rows[:page.Limit+1]
+	}
+	return rows
+}
+
+// compare orders two sort positions, ties broken by ID, in the direction of the page
+func (p PageRequest) compare(aValue interface{}, aID int, bValue interface{}, bID int) int {
+	result := compareValues(aValue, bValue)
+	if result == 0 {
+		result = compareOrdered(aID, bID)
+	}
+	if p.Order == "desc" {
+		result = -result
+	}
+	return result
+}
+
+// compareValues compares two sort values of the same type
+func compareValues(a, b interface{}) int {
+	switch a := a.(type) {
+	case int:
+		return compareOrdered(a, b.(int))
+	case float64:
+		return compareOrdered(a, b.(float64))
+	case string:
+		return compareOrdered(a, b.(string))
+	case time.Time:
+		return a.Compare(b.(time.Time))
+	}
+	return 0
+}
+
+func compareOrdered[T int | float64 | string](a, b T) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// matches applies the filter to a product the way ProductFilter.Apply does in SQL
+func (f ProductFilter) matches(p Product) bool {
+	switch {
+	case f.UserID != 0 && p.UserID != f.UserID,
+		f.MinPrice != nil && p.ProductPrice < *f.MinPrice,
+		f.MaxPrice != nil && p.ProductPrice > *f.MaxPrice,
+		f.NameContains != "" && !strings.Contains(strings.ToLower(p.ProductName), strings.ToLower(f.NameContains)),
+		f.HasImages != nil && *f.HasImages != (len(p.ProductImages) > 0),
+		f.CreatedAfter != nil && p.CreatedAt.Before(*f.CreatedAfter),
+		f.CreatedBefore != nil && !p.CreatedAt.Before(*f.CreatedBefore),
+		len(f.IDs) > 0 && !containsInt(f.IDs, p.ID):
+		return false
+	}
+	if terms := searchTerms(f.Search); len(terms) > 0 {
+		_, ok := rankProduct(p, terms)
+		return ok
+	}
+	return true
+}
+
+// searchTerms recovers the word prefixes from a tsquery built by ParseSearchQuery
+func searchTerms(search string) []string {
+	if search == "" {
+		return nil
+	}
+	terms := strings.Split(search, " & ")
+	for i, term := range terms {
+		terms[i] = strings.TrimSuffix(term, ":*")
+	}
+	return terms
+}
+
+// rankProduct reports whether every term prefixes a word of the product, weighting
+// name matches above description matches like the search_vector column
+func rankProduct(p Product, terms []string) (float64, bool) {
+	nameWords, descriptionWords := searchWords(p.ProductName), searchWords(p.ProductDescription)
+
+	rank := 0.0
+	for _, term := range terms {
+		nameHits, descriptionHits := countPrefixed(nameWords, term), countPrefixed(descriptionWords, term)
+		if nameHits == 0 && descriptionHits == 0 {
+			return 0, false
+		}
+		rank += float64(nameHits) + 0.4*float64(descriptionHits)
+	}
+	return rank, true
+}
+
+// highlightTerms wraps every word starting with one of terms in the highlight delimiters
+func highlightTerms(text string, terms []string) string {
+	var out strings.Builder
+	word := []rune{}
+	flush := func() {
+		if len(word) == 0 {
+			return
+		}
+		lower := strings.ToLower(string(word))
+		for _, term := range terms {
+			if strings.HasPrefix(lower, term) {
+				out.WriteString(highlightStart + string(word) + highlightStop)
+				word = word[:0]
+				return
+			}
+		}
+		out.WriteString(string(word))
+		word = word[:0]
+	}
+
+	for _, r := range text {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			word = append(word, r)
+			continue
+		}
+		flush()
+		out.WriteRune(r)
+	}
+	flush()
+	return out.String()
+}
+
+// searchWords splits text into lower-case words the way ParseSearchQuery splits queries
+func searchWords(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+func countPrefixed(words []string, prefix string) int {
+	count := 0
+	for _, word := range words {
+		if strings.HasPrefix(word, prefix) {
+			count++
+		}
+	}
+	return count
+}
+
+func containsInt(values []int, value int) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// cloneProduct copies a product so callers never share slices with the store
+func cloneProduct(p Product) Product {
+	if p.ProductImages != nil {
+		p.ProductImages = append([]string{}, p.ProductImages...)
+	}
+	if p.CompressedProductImages != nil {
+		p.CompressedProductImages = append([]string{}, p.CompressedProductImages...)
+	}
+	if p.Images != nil {
+		p.Images = append([]ProductImage{}, p.Images...)
+	}
+	return p
+}
+
+// MemoryUserRepository is a UserRepository kept in process memory
+type MemoryUserRepository struct {
+	mu     sync.Mutex
+	nextID int
+	users  map[int]models.User
+}
+
+// NewMemoryUserRepository returns an empty in-memory UserRepository
+func NewMemoryUserRepository() *MemoryUserRepository {
+	return &MemoryUserRepository{users: map[int]models.User{}}
+}
+
+// Create stores a copy of the user under the next ID unless the username is taken
+func (r *MemoryUserRepository) Create(ctx context.Context, user *models.User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, existing := range r.users {
+		if existing.Username == user.Username {
+			return ErrUsernameTaken
+		}
+	}
+	r.nextID++
+	user.ID = r.nextID
+	r.users[user.ID] = *user
+	return nil
+}
+
+// GetByID returns a copy of the stored user
+func (r *MemoryUserRepository) GetByID(ctx context.Context, id int) (*models.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user, ok := r.users[id]
+	if !ok {
+		return nil, ErrUserNotFound
+	}
+	return &user, nil
+}
+
+// GetByUsername returns a copy of the user with the given username
+func (r *MemoryUserRepository) GetByUsername(ctx context.Context, username string) (*models.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, user := range r.users {
+		if user.Username == username {
+			return &user, nil
+		}
+	}
+	return nil, ErrUserNotFound
+}
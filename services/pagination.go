@@ -0,0 +1,265 @@
+package models
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultPageLimit is used when a request does not set limit
+	DefaultPageLimit = 20
+	// MaxPageLimit caps how many products one page may return
+	MaxPageLimit = 100
+)
+
+// ErrInvalidCursor is returned for cursors that are malformed or belong to a different sort
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// SortRelevance orders search results by how well they match the query
+const SortRelevance = "relevance"
+
+// sortColumns maps the public sort names to product columns
+var sortColumns = map[string]string{
+	"id":         "id",
+	"price":      "product_price",
+	"name":       "product_name",
+	"created_at": "created_at",
+}
+
+// PageRequest describes which page of products to return and in what order
+type PageRequest struct {
+	Limit int
+	Sort  string
+	Order string
+	after *pageCursor
+}
+
+// Paging is the metadata returned alongside a page of products
+type Paging struct {
+	Limit      int    `json:"limit"`
+	Sort       string `json:"sort"`
+	Order      string `json:"order"`
+	HasMore    bool   `json:"has_more"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// ProductPage is the response envelope for product lists
+type ProductPage struct {
+	Data   []Product `json:"data"`
+	Paging Paging    `json:"paging"`
+}
+
+// pageCursor is the opaque position encoded into next_cursor
+type pageCursor struct {
+	Sort  string          `json:"sort"`
+	Order string          `json:"order"`
+	Value json.RawMessage `json:"value"`
+	ID    int             `json:"id"`
+}
+
+// ParsePageRequest validates the limit, sort, order and cursor query parameters.
+// Empty values fall back to DefaultPageLimit sorted by id ascending.
+func ParsePageRequest(limit, sort, order, cursor string) (PageRequest, error) {
+	return parsePageRequest(PageRequest{Limit: DefaultPageLimit, Sort: "id", Order: "asc"}, limit, sort, order, cursor)
+}
+
+// ParseSearchPageRequest is ParsePageRequest for search results, which also accept
+// sort=relevance and default to the best matches first
+func ParseSearchPageRequest(limit, sort, order, cursor string) (PageRequest, error) {
+	return parsePageRequest(PageRequest{Limit: DefaultPageLimit, Sort: SortRelevance, Order: "desc"}, limit, sort, order, cursor)
+}
+
+// parsePageRequest applies the query parameters on top of defaults; relevance is
+// only accepted when it is the default sort
+func parsePageRequest(page PageRequest, limit, sort, order, cursor string) (PageRequest, error) {
+	searching := page.Sort == SortRelevance
+
+	if limit != "" {
+		value, err := strconv.Atoi(limit)
+		if err != nil || value < 1 || value > MaxPageLimit {
+			return page, fmt.Errorf("limit must be between 1 and %d", MaxPageLimit)
+		}
+		page.Limit = value
+	}
+
+	if sort != "" {
+		switch _, ok := sortColumns[sort]; {
+		case ok:
+			// An explicit column sort starts ascending like a plain product list
+			page.Sort = sort
+			page.Order = "asc"
+		case searching && sort == SortRelevance:
+		case searching:
+			return page, fmt.Errorf("sort must be one of relevance, id, price, name or created_at")
+		default:
+			return page, fmt.Errorf("sort must be one of id, price, name or created_at")
+		}
+	}
+
+	if order != "" {
+		order = strings.ToLower(order)
+		if order != "asc" && order != "desc" {
+			return page, fmt.Errorf("order must be asc or desc")
+		}
+		page.Order = order
+	}
+
+	if cursor != "" {
+		after, err := decodeCursor(cursor)
+		if err != nil {
+			return page, err
+		}
+		if after.Sort != page.Sort || after.Order != page.Order {
+			return page, fmt.Errorf("%w: cursor was issued for sort=%s order=%s", ErrInvalidCursor, after.Sort, after.Order)
+		}
+		if _, err := after.sortValue(); err != nil {
+			return page, err
+		}
+		page.after = after
+	}
+
+	return page, nil
+}
+
+// applyKeyset adds the condition selecting rows after the cursor
+func (p PageRequest) applyKeyset(b *QueryBuilder) {
+	if p.after == nil {
+		return
+	}
+
+	operator := ">"
+	if p.Order == "desc" {
+		operator = "<"
+	}
+
+	if p.Sort == "id" {
+		b.Where("id "+operator+" ?", p.after.ID)
+		return
+	}
+
+	// Ties on the sort column are broken by id so every row has a unique position
+	value, _ := p.after.sortValue()
+	b.Where(fmt.Sprintf("(%s, id) %s (?, ?)", p.sortColumn(), operator), value, p.after.ID)
+}
+
+// sortColumn returns the column or search expression alias behind p.Sort
+func (p PageRequest) sortColumn() string {
+	if p.Sort == SortRelevance {
+		return searchRankColumn
+	}
+	return sortColumns[p.Sort]
+}
+
+// orderClause returns the ORDER BY matching the keyset
+func (p PageRequest) orderClause() string {
+	direction := strings.ToUpper(p.Order)
+	if p.Sort == "id" {
+		return " ORDER BY id " + direction
+	}
+	return fmt.Sprintf(" ORDER BY %s %s, id %s", p.sortColumn(), direction, direction)
+}
+
+// newPage trims the extra row fetched to detect another page and builds the envelope
+func (p PageRequest) newPage(products []Product) (*ProductPage, error) {
+	paging, n, err := p.paging(len(products), func(i int) (interface{}, int) {
+		return p.position(products[i], 0), products[i].ID
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &ProductPage{Data: products[:n], Paging: paging}, nil
+}
+
+// paging builds the metadata for fetched rows and reports how many of them belong on
+// the page; position returns the sort value and ID of the row at index i
+func (p PageRequest) paging(fetched int, position func(i int) (interface{}, int)) (Paging, int, error) {
+	paging := Paging{Limit: p.Limit, Sort: p.Sort, Order: p.Order}
+	if fetched <= p.Limit {
+		return paging, fetched, nil
+	}
+
+	paging.HasMore = true
+	value, id := position(p.Limit - 1)
+	cursor, err := p.encodeCursor(value, id)
+	if err != nil {
+		return paging, 0, err
+	}
+	paging.NextCursor = cursor
+	return paging, p.Limit, nil
+}
+
+// position returns the value of the sort column for a product; rank is only used
+// when sorting search results by relevance
+func (p PageRequest) position(product Product, rank float64) interface{} {
+	switch p.Sort {
+	case "price":
+		return product.ProductPrice
+	case "name":
+		return product.ProductName
+	case "created_at":
+		return product.CreatedAt
+	case SortRelevance:
+		return rank
+	default:
+		return product.ID
+	}
+}
+
+// encodeCursor captures the sort position of the last row on a page
+func (p PageRequest) encodeCursor(value interface{}, id int) (string, error) {
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	data, err := json.Marshal(pageCursor{Sort: p.Sort, Order: p.Order, Value: raw, ID: id})
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// decodeCursor parses an opaque next_cursor value
+func decodeCursor(cursor string) (*pageCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var after pageCursor
+	if err := json.Unmarshal(data, &after); err != nil || after.ID <= 0 {
+		return nil, ErrInvalidCursor
+	}
+	return &after, nil
+}
+
+// sortValue decodes the cursor value into the Go type of its sort column
+func (c *pageCursor) sortValue() (interface{}, error) {
+	var err error
+	var value interface{}
+	switch c.Sort {
+	case "price", SortRelevance:
+		var number float64
+		err = json.Unmarshal(c.Value, &number)
+		value = number
+	case "name":
+		var name string
+		err = json.Unmarshal(c.Value, &name)
+		value = name
+	case "created_at":
+		var createdAt time.Time
+		err = json.Unmarshal(c.Value, &createdAt)
+		value = createdAt
+	case "id":
+		value = c.ID
+	default:
+		err = ErrInvalidCursor
+	}
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	return value, nil
+}
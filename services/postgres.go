@@ -0,0 +1,312 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	imageprocessor "product-management/image-processor"
+	"product-management/models"
+	"product-management/tracing"
+	"strconv"
+
+	"github.com/lib/pq"
+)
+
+// PostgresProductRepository is the ProductRepository backed by the products and
+// product_image_jobs tables
+type PostgresProductRepository struct {
+	db *tracing.DB
+}
+
+// NewPostgresProductRepository returns a ProductRepository using db, tracing each query
+func NewPostgresProductRepository(db *sql.DB) *PostgresProductRepository {
+	return &PostgresProductRepository{db: tracing.WrapDB(db)}
+}
+
+// Create inserts a product and reads back its ID and creation time. Its images
+// start without renditions.
+func (r *PostgresProductRepository) Create(ctx context.Context, p *Product) error {
+	query := `INSERT INTO products (user_id, product_name, product_description, product_images, product_price)
+		VALUES ($1, $2, $3, $4, $5) RETURNING id, created_at`
+	err := r.db.QueryRowContext(ctx, query, p.UserID, p.ProductName, p.ProductDescription, pq.Array(p.ProductImages), p.ProductPrice).
+		Scan(&p.ID, &p.CreatedAt)
+	if err != nil {
+		return err
+	}
+	p.Images = imagesFor(p.ProductImages, nil)
+	return nil
+}
+
+// GetByID fetches a product by its ID
+func (r *PostgresProductRepository) GetByID(ctx context.Context, id int) (*Product, error) {
+	query := `SELECT ` + productColumns + ` FROM products WHERE id = $1`
+	product, err := scanProduct(r.db.QueryRowContext(ctx, query, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrProductNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch product: %w", err)
+	}
+	return &product, nil
+}
+
+// Update overwrites the stored product identified by p.ID and reads it back. The
+// renditions and compressed copies of images replaced or moved to another position
+// are dropped in the same statement.
+func (r *PostgresProductRepository) Update(ctx context.Context, p *Product) error {
+	// The subqueries see the row as it was before the update. Array positions are
+	// 1-based; image_renditions is keyed by the 0-based index.
+	query := `UPDATE products SET user_id = $1, product_name = $2, product_description = $3, product_images = $4, product_price = $5,
+			image_renditions = (
+				SELECT COALESCE(jsonb_object_agg(key, value), '{}')
+				FROM jsonb_each(image_renditions)
+				WHERE ($4::text[])[key::int + 1] = value->>'source_url' AND product_images[key::int + 1] = value->>'source_url'
+			),
+			compressed_product_images = (
+				SELECT COALESCE(array_agg(url ORDER BY idx) FILTER (WHERE idx <= last), '{}')
+				FROM (
+					SELECT idx, url, max(idx) FILTER (WHERE url <> '') OVER () AS last
+					FROM (
+						SELECT c.idx, CASE WHEN ($4::text[])[c.idx::int] = product_images[c.idx::int] THEN c.url END AS url
+						FROM unnest(compressed_product_images) WITH ORDINALITY AS c(url, idx)
+					) positions
+				) kept
+			)
+		WHERE id = $6
+		RETURNING ` + productColumns
+	row := r.db.QueryRowContext(ctx, query, p.UserID, p.ProductName, p.ProductDescription, pq.Array(p.ProductImages), p.ProductPrice, p.ID)
+	updated, err := scanProduct(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrProductNotFound
+	}
+	if err != nil {
+		return err
+	}
+	*p = updated
+	return nil
+}
+
+// Delete removes a product by its ID
+func (r *PostgresProductRepository) Delete(ctx context.Context, id int) error {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM products WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	return checkAffected(result)
+}
+
+// List fetches one page of products matching filter
+func (r *PostgresProductRepository) List(ctx context.Context, filter ProductFilter, page PageRequest) (*ProductPage, error) {
+	query, args := BuildProductQuery(filter, page)
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	products := []Product{}
+	for rows.Next() {
+		product, err := scanProduct(rows)
+		if err != nil {
+			return nil, err
+		}
+		products = append(products, product)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return page.newPage(products)
+}
+
+// Search fetches one page of products matching filter.Search, best matches first
+// unless page asks for another order
+func (r *PostgresProductRepository) Search(ctx context.Context, filter ProductFilter, page PageRequest) (*SearchPage, error) {
+	if filter.Search == "" {
+		return nil, ErrInvalidSearch
+	}
+
+	query, args := BuildSearchQuery(filter, page)
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := []SearchResult{}
+	for rows.Next() {
+		var result SearchResult
+		product, err := scanProduct(rows, &result.Rank, &result.Highlights.ProductName, &result.Highlights.ProductDescription)
+		if err != nil {
+			return nil, err
+		}
+		result.Product = product
+		result.Highlights.ProductName = markHighlights(result.Highlights.ProductName)
+		result.Highlights.ProductDescription = markHighlights(result.Highlights.ProductDescription)
+		results = append(results, result)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return page.newSearchPage(results)
+}
+
+// AddImage appends sourceURL to product_images in a single statement, so
+// concurrent uploads to one product each get their own index
+func (r *PostgresProductRepository) AddImage(ctx context.Context, productID int, sourceURL string) (int, error) {
+	query := `UPDATE products SET product_images = array_append(product_images, $2)
+		WHERE id = $1 RETURNING cardinality(product_images) - 1`
+	var index int
+	err := r.db.QueryRowContext(ctx, query, productID, sourceURL).Scan(&index)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, ErrProductNotFound
+	}
+	if err != nil {
+		return 0, err
+	}
+	return index, nil
+}
+
+// SetImageRenditions stores the renditions of the image at index, and
+// compressedURL in compressed_product_images, unless the product no longer
+// references sourceURL there. Renditions already stored for the same source are
+// kept unless renditions replaces them, so a job for some renditions leaves the
+// others in place.
+func (r *PostgresProductRepository) SetImageRenditions(ctx context.Context, productID, index int, sourceURL, compressedURL string, renditions imageprocessor.Renditions) error {
+	if renditions == nil {
+		renditions = imageprocessor.Renditions{}
+	}
+	encoded, err := json.Marshal(renditions)
+	if err != nil {
+		return fmt.Errorf("failed to encode image renditions: %w", err)
+	}
+
+	// Postgres arrays are 1-based; image_renditions is keyed by the 0-based index.
+	// An empty compressedURL keeps the current entry.
+	query := `UPDATE products SET
+			compressed_product_images[$2] = COALESCE(NULLIF($3, ''), compressed_product_images[$2]),
+			image_renditions = image_renditions || jsonb_build_object($4::text, jsonb_build_object(
+				'source_url', $6::text,
+				'renditions', CASE
+					WHEN image_renditions->$4::text->>'source_url' = $6::text
+						AND jsonb_typeof(image_renditions->$4::text->'renditions') = 'object'
+					THEN image_renditions->$4::text->'renditions'
+					ELSE '{}'::jsonb
+				END || $5::jsonb))
+		WHERE id = $1 AND product_images[$2] = $6`
+	result, err := r.db.ExecContext(ctx, query, productID, index+1, compressedURL, strconv.Itoa(index), string(encoded), sourceURL)
+	if err != nil {
+		return err
+	}
+	return checkAffected(result)
+}
+
+// AddCompressedImage stores compressedURL in compressed_product_images at the
+// position of sourceURL in every product referencing it. Products already holding
+// it there are left alone, so a redelivered job changes nothing.
+func (r *PostgresProductRepository) AddCompressedImage(ctx context.Context, sourceURL, compressedURL string) ([]int, error) {
+	query := `UPDATE products SET compressed_product_images[array_position(product_images, $1)] = $2
+		WHERE $1 = ANY(product_images)
+			AND compressed_product_images[array_position(product_images, $1)] IS DISTINCT FROM $2
+		RETURNING id`
+	rows, err := r.db.QueryContext(ctx, query, sourceURL, compressedURL)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// RecordImageStatus upserts one row of product_image_jobs
+func (r *PostgresProductRepository) RecordImageStatus(ctx context.Context, productID int, image ImageStatus) error {
+	query := `INSERT INTO product_image_jobs (product_id, image_index, source_url, status, attempts, last_error, correlation_id, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, now())
+		ON CONFLICT (product_id, image_index) DO UPDATE SET
+			source_url = EXCLUDED.source_url, status = EXCLUDED.status, attempts = EXCLUDED.attempts,
+			last_error = EXCLUDED.last_error, correlation_id = EXCLUDED.correlation_id, updated_at = now()`
+	_, err := r.db.ExecContext(ctx, query, productID, image.ImageIndex, image.SourceURL, image.Status, image.Attempts, image.LastError, image.CorrelationID)
+	return err
+}
+
+// GetImageStatus reads the product_image_jobs rows of a product
+func (r *PostgresProductRepository) GetImageStatus(ctx context.Context, productID int) (*ProductImageStatus, error) {
+	query := `SELECT image_index, source_url, status, attempts, last_error, correlation_id, updated_at
+		FROM product_image_jobs WHERE product_id = $1 ORDER BY image_index`
+	rows, err := r.db.QueryContext(ctx, query, productID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var images []ImageStatus
+	for rows.Next() {
+		var image ImageStatus
+		if err := rows.Scan(&image.ImageIndex, &image.SourceURL, &image.Status, &image.Attempts, &image.LastError, &image.CorrelationID, &image.UpdatedAt); err != nil {
+			return nil, err
+		}
+		images = append(images, image)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return newProductImageStatus(productID, images), nil
+}
+
+// PostgresUserRepository is the UserRepository backed by the users table
+type PostgresUserRepository struct {
+	db *tracing.DB
+}
+
+// NewPostgresUserRepository returns a UserRepository using db, tracing each query
+func NewPostgresUserRepository(db *sql.DB) *PostgresUserRepository {
+	return &PostgresUserRepository{db: tracing.WrapDB(db)}
+}
+
+// Create inserts a user, mapping a unique violation on username to ErrUsernameTaken
+func (r *PostgresUserRepository) Create(ctx context.Context, user *models.User) error {
+	query := `INSERT INTO users (username, password, role) VALUES ($1, $2, $3) RETURNING id`
+	err := r.db.QueryRowContext(ctx, query, user.Username, user.Password, user.Role).Scan(&user.ID)
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+		return ErrUsernameTaken
+	}
+	return err
+}
+
+// GetByID fetches a user by its ID
+func (r *PostgresUserRepository) GetByID(ctx context.Context, id int) (*models.User, error) {
+	query := `SELECT id, username, password, role FROM users WHERE id = $1`
+	return scanUser(r.db.QueryRowContext(ctx, query, id))
+}
+
+// GetByUsername fetches a user, including the password hash, by username
+func (r *PostgresUserRepository) GetByUsername(ctx context.Context, username string) (*models.User, error) {
+	query := `SELECT id, username, password, role FROM users WHERE username = $1`
+	return scanUser(r.db.QueryRowContext(ctx, query, username))
+}
+
+// scanUser reads a single user row, mapping a missing row to ErrUserNotFound
+func scanUser(row *sql.Row) (*models.User, error) {
+	var user models.User
+	err := row.Scan(&user.ID, &user.Username, &user.Password, &user.Role)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch user: %w", err)
+	}
+	return &user, nil
+}
@@ -0,0 +1,117 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// QueryBuilder composes AND-ed conditions whose placeholders are numbered in the
+// order their arguments are added, so any subset of filters yields valid SQL
+type QueryBuilder struct {
+	conditions []string
+	args       []interface{}
+}
+
+// Arg records a value and returns its placeholder
+func (b *QueryBuilder) Arg(value interface{}) string {
+	b.args = append(b.args, value)
+	return fmt.Sprintf("$%d", len(b.args))
+}
+
+// Where adds a condition; each ? in condition is replaced by the placeholder of the matching value
+func (b *QueryBuilder) Where(condition string, values ...interface{}) {
+	parts := strings.Split(condition, "?")
+	if len(parts)-1 != len(values) {
+		panic(fmt.Sprintf("condition %q has %d placeholders but %d values", condition, len(parts)-1, len(values)))
+	}
+
+	var sql strings.Builder
+	sql.WriteString(parts[0])
+	for i, value := range values {
+		sql.WriteString(b.Arg(value))
+		sql.WriteString(parts[i+1])
+	}
+	b.conditions = append(b.conditions, sql.String())
+}
+
+// WhereClause returns " WHERE ..." for the conditions added so far, or "" if there are none
+func (b *QueryBuilder) WhereClause() string {
+	if len(b.conditions) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(b.conditions, " AND ")
+}
+
+// Args returns the values for every placeholder handed out so far
+func (b *QueryBuilder) Args() []interface{} {
+	return b.args
+}
+
+// ProductFilter narrows a product list; zero values and nil pointers are ignored
+type ProductFilter struct {
+	UserID        int
+	MinPrice      *float64
+	MaxPrice      *float64
+	NameContains  string
+	HasImages     *bool
+	CreatedAfter  *time.Time
+	CreatedBefore *time.Time
+	IDs           []int
+	// Search is a tsquery built by ParseSearchQuery
+	Search string
+}
+
+// Apply adds a condition for every filter that is set
+func (f ProductFilter) Apply(b *QueryBuilder) {
+	if f.UserID != 0 {
+		b.Where("user_id = ?", f.UserID)
+	}
+	if f.MinPrice != nil {
+		b.Where("product_price >= ?", *f.MinPrice)
+	}
+	if f.MaxPrice != nil {
+		b.Where("product_price <= ?", *f.MaxPrice)
+	}
+	if f.NameContains != "" {
+		b.Where(`product_name ILIKE ? ESCAPE '\'`, "%"+escapeLike(f.NameContains)+"%")
+	}
+	if f.HasImages != nil {
+		if *f.HasImages {
+			b.Where("coalesce(cardinality(product_images), 0) > 0")
+		} else {
+			b.Where("coalesce(cardinality(product_images), 0) = 0")
+		}
+	}
+	if f.CreatedAfter != nil {
+		b.Where("created_at >= ?", *f.CreatedAfter)
+	}
+	if f.CreatedBefore != nil {
+		b.Where("created_at < ?", *f.CreatedBefore)
+	}
+	if len(f.IDs) > 0 {
+		b.Where("id = ANY(?)", pq.Array(f.IDs))
+	}
+	if f.Search != "" {
+		b.Where("search_vector @@ to_tsquery('"+searchConfig+"', ?)", f.Search)
+	}
+}
+
+// BuildProductQuery returns the SQL and arguments selecting one page of filtered products
+func BuildProductQuery(filter ProductFilter, page PageRequest) (string, []interface{}) {
+	var b QueryBuilder
+	filter.Apply(&b)
+	page.applyKeyset(&b)
+
+	query := `SELECT ` + productColumns + ` FROM products` + b.WhereClause() + page.orderClause()
+	// Fetch one extra row to learn whether another page exists
+	query += " LIMIT " + b.Arg(page.Limit+1)
+	return query, b.Args()
+}
+
+// escapeLike escapes the LIKE wildcards in a user-supplied search term
+func escapeLike(term string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(term)
+}
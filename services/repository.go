@@ -0,0 +1,47 @@
+package models
+
+import (
+	"context"
+	imageprocessor "product-management/image-processor"
+	"product-management/models"
+)
+
+// ProductRepository stores products and the processing state of their images.
+// Lookups of a missing product return ErrProductNotFound.
+type ProductRepository interface {
+	// Create stores a new product and fills in its ID and CreatedAt
+	Create(ctx context.Context, product *Product) error
+	GetByID(ctx context.Context, id int) (*Product, error)
+	// Update overwrites every field except ID, CompressedProductImages, Images and
+	// CreatedAt, then fills product in as stored. Images left at the same position
+	// keep their renditions and compressed copy; those of the others are dropped.
+	Update(ctx context.Context, product *Product) error
+	Delete(ctx context.Context, id int) error
+	// List returns one page of products matching filter
+	List(ctx context.Context, filter ProductFilter, page PageRequest) (*ProductPage, error)
+	// Search returns one page of products matching filter.Search, ranked by relevance
+	Search(ctx context.Context, filter ProductFilter, page PageRequest) (*SearchPage, error)
+
+	// AddImage appends sourceURL to the product's images and returns its index
+	AddImage(ctx context.Context, productID int, sourceURL string) (int, error)
+	// SetImageRenditions stores the renditions of the image at index, with
+	// compressedURL as its entry in CompressedProductImages unless it is empty, as
+	// long as the product still references sourceURL at that position
+	SetImageRenditions(ctx context.Context, productID, index int, sourceURL, compressedURL string, renditions imageprocessor.Renditions) error
+	// AddCompressedImage records the processed copy of sourceURL at the image's
+	// position in CompressedProductImages on every product that references it, and
+	// returns the IDs of the products it changed; recording it again changes nothing
+	AddCompressedImage(ctx context.Context, sourceURL, compressedURL string) ([]int, error)
+	// RecordImageStatus upserts the processing state of one product image
+	RecordImageStatus(ctx context.Context, productID int, image ImageStatus) error
+	// GetImageStatus returns the processing state of every image of a product
+	GetImageStatus(ctx context.Context, productID int) (*ProductImageStatus, error)
+}
+
+// UserRepository stores users. Lookups of a missing user return ErrUserNotFound.
+type UserRepository interface {
+	// Create stores a new user and fills in its ID, or returns ErrUsernameTaken
+	Create(ctx context.Context, user *models.User) error
+	GetByID(ctx context.Context, id int) (*models.User, error)
+	GetByUsername(ctx context.Context, username string) (*models.User, error)
+}
@@ -0,0 +1,116 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"strings"
+	"unicode"
+)
+
+const (
+	// MaxSearchLength caps the length of a search query in bytes
+	MaxSearchLength = 200
+	// MaxSearchTerms caps how many words a search query may contain
+	MaxSearchTerms = 10
+
+	// searchConfig is the text search configuration used by the search_vector column
+	searchConfig = "english"
+	// searchRankColumn is the alias of the rank computed for every search match
+	searchRankColumn = "search_rank"
+
+	// highlightStart and highlightStop delimit matches in ts_headline output; they are
+	// private-use characters so the snippet can be HTML-escaped before adding <mark> tags
+	highlightStart = "\uE000"
+	highlightStop  = "\uE001"
+)
+
+// ErrInvalidSearch is returned for search queries without any searchable words
+var ErrInvalidSearch = errors.New("invalid search query")
+
+// nameHeadline and descriptionHeadline configure the snippets returned for name and description matches
+var (
+	nameHeadline        = fmt.Sprintf("StartSel=%s, StopSel=%s, HighlightAll=true", highlightStart, highlightStop)
+	descriptionHeadline = fmt.Sprintf("StartSel=%s, StopSel=%s, MaxWords=30, MinWords=10, MaxFragments=2, FragmentDelimiter=\" ... \"", highlightStart, highlightStop)
+)
+
+// SearchHighlights holds HTML snippets in which matching words are wrapped in <mark>
+type SearchHighlights struct {
+	ProductName        string `json:"product_name"`
+	ProductDescription string `json:"product_description"`
+}
+
+// SearchResult is a product matching a search query
+type SearchResult struct {
+	Product
+	Rank       float64          `json:"rank"`
+	Highlights SearchHighlights `json:"highlights"`
+}
+
+// SearchPage is the response envelope for search results
+type SearchPage struct {
+	Data   []SearchResult `json:"data"`
+	Paging Paging         `json:"paging"`
+}
+
+// ParseSearchQuery turns free text into a tsquery that matches every word as a
+// prefix, so partially typed words still find results. Only letters and digits are
+// kept, which leaves no tsquery operators for callers to inject.
+func ParseSearchQuery(q string) (string, error) {
+	if len(q) > MaxSearchLength {
+		return "", fmt.Errorf("%w: q must be at most %d characters", ErrInvalidSearch, MaxSearchLength)
+	}
+
+	terms := strings.FieldsFunc(strings.ToLower(q), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	if len(terms) == 0 {
+		return "", fmt.Errorf("%w: q must contain at least one word", ErrInvalidSearch)
+	}
+	if len(terms) > MaxSearchTerms {
+		return "", fmt.Errorf("%w: q must contain at most %d words", ErrInvalidSearch, MaxSearchTerms)
+	}
+
+	for i, term := range terms {
+		terms[i] = term + ":*"
+	}
+	return strings.Join(terms, " & "), nil
+}
+
+// BuildSearchQuery returns the SQL and arguments selecting one page of ranked products
+// matching filter.Search along with the rest of filter
+func BuildSearchQuery(filter ProductFilter, page PageRequest) (string, []interface{}) {
+	var b QueryBuilder
+	from := fmt.Sprintf(` FROM products, to_tsquery('%s', %s) AS search_query, ts_rank_cd(search_vector, search_query) AS %s`,
+		searchConfig, b.Arg(filter.Search), searchRankColumn)
+	b.Where("search_vector @@ search_query")
+
+	// The tsquery is already bound above
+	filter.Search = ""
+	filter.Apply(&b)
+	page.applyKeyset(&b)
+
+	query := `SELECT ` + productColumns + `, ` + searchRankColumn +
+		fmt.Sprintf(`, ts_headline('%s', coalesce(product_name, ''), search_query, %s)`, searchConfig, b.Arg(nameHeadline)) +
+		fmt.Sprintf(`, ts_headline('%s', coalesce(product_description, ''), search_query, %s)`, searchConfig, b.Arg(descriptionHeadline)) +
+		from + b.WhereClause() + page.orderClause()
+	// Fetch one extra row to learn whether another page exists
+	query += " LIMIT " + b.Arg(page.Limit+1)
+	return query, b.Args()
+}
+
+// newSearchPage trims the extra row fetched to detect another page and builds the envelope
+func (p PageRequest) newSearchPage(results []SearchResult) (*SearchPage, error) {
+	paging, n, err := p.paging(len(results), func(i int) (interface{}, int) {
+		return p.position(results[i].Product, results[i].Rank), results[i].ID
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &SearchPage{Data: results[:n], Paging: paging}, nil
+}
+
+// markHighlights escapes a ts_headline snippet and turns its match delimiters into <mark> tags
+func markHighlights(snippet string) string {
+	return strings.NewReplacer(highlightStart, "<mark>", highlightStop, "</mark>").Replace(html.EscapeString(snippet))
+}
@@ -2,9 +2,23 @@ package models
 
 import (
 	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
+	imageprocessor "product-management/image-processor"
+	"time"
+
+	"github.com/lib/pq"
 )
 
+// productColumns lists the columns read by scanProduct. compressed_product_images
+// reports gaps left by out-of-order image jobs as empty strings.
+const productColumns = `id, user_id, product_name, product_description, product_images, product_price,
+	array_replace(compressed_product_images, NULL, ''), image_renditions, created_at`
+
+// ErrProductNotFound is returned when no product matches the requested ID
+var ErrProductNotFound = errors.New("product not found")
+
 // Product struct represents the product model
 type Product struct {
 	ID                 int      `json:"id"`
@@ -13,55 +27,66 @@ type Product struct {
 	ProductDescription string   `json:"product_description"`
 	ProductImages      []string `json:"product_images"`
 	ProductPrice       float64  `json:"product_price"`
+	// CompressedProductImages holds the primary rendition of each image; it predates
+	// Images and is kept for older clients
+	CompressedProductImages []string `json:"compressed_product_images"`
+	// Images lists the renditions of each of ProductImages in the same order. Both
+	// are filled in by the image worker.
+	Images    []ProductImage `json:"images"`
+	CreatedAt time.Time      `json:"created_at"`
 }
 
-// Save method saves the product to the database
-func (p *Product) Save(db *sql.DB) error {
-	query := `INSERT INTO products (user_id, product_name, product_description, product_images, product_price)
-		VALUES ($1, $2, $3, $4, $5) RETURNING id`
-	return db.QueryRow(query, p.UserID, p.ProductName, p.ProductDescription, p.ProductImages, p.ProductPrice).Scan(&p.ID)
+// ProductImage is one source image of a product with the renditions produced so
+// far; Renditions is empty until the image has been processed
+type ProductImage struct {
+	SourceURL  string                    `json:"source_url"`
+	Renditions imageprocessor.Renditions `json:"renditions"`
 }
 
-// GetProductByID fetches a product by its ID
-func GetProductByID(db *sql.DB, id string) (*Product, error) {
-	var product Product
-	query := `SELECT id, user_id, product_name, product_description, product_images, product_price FROM products WHERE id = $1`
-	err := db.QueryRow(query, id).Scan(&product.ID, &product.UserID, &product.ProductName, &product.ProductDescription, &product.ProductImages, &product.ProductPrice)
-	if err != nil {
-		return nil, fmt.Errorf("product not found: %v", err)
+// imagesFor lists sources with the renditions stored by image index
+func imagesFor(sources []string, stored map[int]ProductImage) []ProductImage {
+	images := make([]ProductImage, len(sources))
+	for i, source := range sources {
+		images[i] = ProductImage{SourceURL: source, Renditions: imageprocessor.Renditions{}}
+		if image, ok := stored[i]; ok && image.SourceURL == source && image.Renditions != nil {
+			images[i].Renditions = image.Renditions
+		}
 	}
-	return &product, nil
+	return images
 }
 
-// GetProducts fetches all products, optionally filtered by user_id, price_min, and price_max
-func GetProducts(db *sql.DB, userID string, minPrice, maxPrice float64) ([]Product, error) {
-	var products []Product
-	query := `SELECT id, user_id, product_name, product_description, product_images, product_price FROM products WHERE 1=1`
+// rowScanner is satisfied by *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
 
-	// Add filters to the query
-	if userID != "" {
-		query += " AND user_id = $1"
-	}
-	if minPrice > 0 {
-		query += " AND product_price >= $2"
+// scanProduct reads one row selected with productColumns, followed by any extra columns
+func scanProduct(row rowScanner, extra ...interface{}) (Product, error) {
+	var product Product
+	var renditions []byte
+	dest := []interface{}{&product.ID, &product.UserID, &product.ProductName, &product.ProductDescription,
+		pq.Array(&product.ProductImages), &product.ProductPrice, pq.Array(&product.CompressedProductImages), &renditions, &product.CreatedAt}
+	if err := row.Scan(append(dest, extra...)...); err != nil {
+		return product, err
 	}
-	if maxPrice > 0 {
-		query += " AND product_price <= $3"
+
+	// image_renditions maps image indexes to the source they were rendered from
+	stored := map[int]ProductImage{}
+	if err := json.Unmarshal(renditions, &stored); err != nil {
+		return product, fmt.Errorf("failed to decode image renditions of product %d: %w", product.ID, err)
 	}
+	product.Images = imagesFor(product.ProductImages, stored)
+	return product, nil
+}
 
-	rows, err := db.Query(query, userID, minPrice, maxPrice)
+// checkAffected maps a statement that touched no rows to ErrProductNotFound
+func checkAffected(result sql.Result) error {
+	rows, err := result.RowsAffected()
 	if err != nil {
-		return nil, err
+		return err
 	}
-	defer rows.Close()
-
-	for rows.Next() {
-		var product Product
-		if err := rows.Scan(&product.ID, &product.UserID, &product.ProductName, &product.ProductDescription, &product.ProductImages, &product.ProductPrice); err != nil {
-			return nil, err
-		}
-		products = append(products, product)
+	if rows == 0 {
+		return ErrProductNotFound
 	}
-
-	return products, nil
+	return nil
 }
@@ -0,0 +1,66 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"product-management/config"
+	"strconv"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// ErrInvalidToken is returned when a session token cannot be verified
+var ErrInvalidToken = errors.New("invalid or expired token")
+
+// Tokens signs and verifies session tokens
+type Tokens struct {
+	secret []byte
+	ttl    time.Duration
+}
+
+// NewTokens returns Tokens signing with cfg.Secret. With an empty secret no token
+// can be issued and none is accepted.
+func NewTokens(cfg config.AuthConfig) *Tokens {
+	return &Tokens{secret: []byte(cfg.Secret), ttl: cfg.TokenTTL}
+}
+
+// Issue signs a session token for the given user
+func (t *Tokens) Issue(userID int) (string, time.Time, error) {
+	if len(t.secret) == 0 {
+		return "", time.Time{}, errors.New("AUTH_SECRET is not configured")
+	}
+
+	expiresAt := time.Now().Add(t.ttl)
+	claims := jwt.RegisteredClaims{
+		Subject:   strconv.Itoa(userID),
+		IssuedAt:  jwt.NewNumericDate(time.Now()),
+		ExpiresAt: jwt.NewNumericDate(expiresAt),
+	}
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(t.secret)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to sign token: %w", err)
+	}
+	return token, expiresAt, nil
+}
+
+// Parse verifies a session token and returns the user ID it was issued for
+func (t *Tokens) Parse(token string) (int, error) {
+	if len(t.secret) == 0 {
+		return 0, ErrInvalidToken
+	}
+
+	var claims jwt.RegisteredClaims
+	_, err := jwt.ParseWithClaims(token, &claims, func(*jwt.Token) (interface{}, error) {
+		return t.secret, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithExpirationRequired())
+	if err != nil {
+		return 0, ErrInvalidToken
+	}
+
+	userID, err := strconv.Atoi(claims.Subject)
+	if err != nil || userID <= 0 {
+		return 0, ErrInvalidToken
+	}
+	return userID, nil
+}
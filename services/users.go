@@ -0,0 +1,82 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"product-management/models"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	// maxUsernameLength matches the VARCHAR(100) username column
+	maxUsernameLength = 100
+	minPasswordLength = 8
+	// maxPasswordLength is the most bcrypt will hash; longer passwords are refused
+	// rather than silently truncated or failing in the hash
+	maxPasswordLength = 72
+)
+
+// dummyHash is compared against when the username is unknown, so a failed login
+// takes as long whether or not the user exists
+const dummyHash = "$2a$10$E8Xo/p4Hey71mkLFbYaevOWZMAesJGe8dh6R.x8Oex8FQx/0Us6OO"
+
+var (
+	// ErrUserNotFound is returned when no user matches the lookup
+	ErrUserNotFound = errors.New("user not found")
+	// ErrUsernameTaken is returned when registering a username that already exists
+	ErrUsernameTaken = errors.New("username already taken")
+	// ErrInvalidCredentials is returned when a login does not match a stored user
+	ErrInvalidCredentials = errors.New("invalid username or password")
+)
+
+// ValidateCredentials checks the shape of a registration request
+func ValidateCredentials(creds models.Credentials) error {
+	username := strings.TrimSpace(creds.Username)
+	if username == "" {
+		return errors.New("username is required")
+	}
+	if utf8.RuneCountInString(username) > maxUsernameLength {
+		return fmt.Errorf("username must be at most %d characters", maxUsernameLength)
+	}
+	if len(creds.Password) < minPasswordLength {
+		return fmt.Errorf("password must be at least %d characters", minPasswordLength)
+	}
+	if len(creds.Password) > maxPasswordLength {
+		return fmt.Errorf("password must be at most %d bytes", maxPasswordLength)
+	}
+	return nil
+}
+
+// CreateUser hashes the password and stores a new user
+func CreateUser(ctx context.Context, users UserRepository, creds models.Credentials) (*models.User, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(creds.Password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash password: %w", err)
+	}
+
+	user := models.User{Username: strings.TrimSpace(creds.Username), Password: string(hash), Role: models.RoleUser}
+	if err := users.Create(ctx, &user); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// Authenticate returns the user matching the credentials or ErrInvalidCredentials
+func Authenticate(ctx context.Context, users UserRepository, creds models.Credentials) (*models.User, error) {
+	user, err := users.GetByUsername(ctx, strings.TrimSpace(creds.Username))
+	if errors.Is(err, ErrUserNotFound) {
+		bcrypt.CompareHashAndPassword([]byte(dummyHash), []byte(creds.Password))
+		return nil, ErrInvalidCredentials
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(creds.Password)); err != nil {
+		return nil, ErrInvalidCredentials
+	}
+	return user, nil
+}
@@ -0,0 +1,137 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// LocalStore is the ObjectStore keeping objects as files under a directory. The
+// content type is not stored; Get guesses it from the key's extension.
+type LocalStore struct {
+	URLSigner
+	dir string
+}
+
+// NewLocalStore returns a LocalStore under dir, creating it if needed, that links
+// objects from baseURL, or as file:// URLs when it is empty, and signs links with secret
+func NewLocalStore(dir, baseURL, secret string) (*LocalStore, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve storage directory: %w", err)
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create storage directory: %w", err)
+	}
+	if baseURL == "" {
+		baseURL = (&url.URL{Scheme: "file", Path: filepath.ToSlash(dir)}).String()
+	}
+	return &LocalStore{URLSigner: URLSigner{baseURL: baseURL, secret: []byte(secret)}, dir: dir}, nil
+}
+
+// path returns the file holding the object under key
+func (s *LocalStore) path(key string) (string, error) {
+	if err := checkKey(key); err != nil {
+		return "", err
+	}
+	return filepath.Join(s.dir, filepath.FromSlash(key)), nil
+}
+
+// Put writes body to a temporary file and renames it into place, so readers never
+// see a partial object
+func (s *LocalStore) Put(ctx context.Context, key string, body io.Reader, contentType string) error {
+	name, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+		return fmt.Errorf("failed to store object %s: %w", key, err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(name), ".upload-*")
+	if err != nil {
+		return fmt.Errorf("failed to store object %s: %w", key, err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := io.Copy(tmp, body); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to store object %s: %w", key, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to store object %s: %w", key, err)
+	}
+	if err := os.Rename(tmp.Name(), name); err != nil {
+		return fmt.Errorf("failed to store object %s: %w", key, err)
+	}
+	return nil
+}
+
+// Get opens the file holding the object under key
+func (s *LocalStore) Get(ctx context.Context, key string) (io.ReadCloser, ObjectInfo, error) {
+	name, err := s.path(key)
+	if err != nil {
+		return nil, ObjectInfo{}, err
+	}
+	file, err := os.Open(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ObjectInfo{}, fmt.Errorf("%w: %s", ErrNotFound, key)
+	}
+	if err != nil {
+		return nil, ObjectInfo{}, fmt.Errorf("failed to open object %s: %w", key, err)
+	}
+	stat, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, ObjectInfo{}, fmt.Errorf("failed to open object %s: %w", key, err)
+	}
+	if stat.IsDir() {
+		file.Close()
+		return nil, ObjectInfo{}, fmt.Errorf("%w: %s", ErrNotFound, key)
+	}
+
+	info := ObjectInfo{
+		Key:         key,
+		ContentType: mime.TypeByExtension(filepath.Ext(name)),
+		Size:        stat.Size(),
+		ModTime:     stat.ModTime(),
+	}
+	return file, info, nil
+}
+
+// Delete removes the file holding the object under key
+func (s *LocalStore) Delete(ctx context.Context, key string) error {
+	name, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(name); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to delete object %s: %w", key, err)
+	}
+	return nil
+}
+
+// URL returns the link to the object under key
+func (s *LocalStore) URL(key string) string {
+	return joinURL(s.baseURL, key)
+}
+
+// SignedURL returns a link allowing method on key until ttl has passed
+func (s *LocalStore) SignedURL(ctx context.Context, key, method string, ttl time.Duration) (string, error) {
+	return s.sign(key, method, 0, time.Now().Add(ttl))
+}
+
+// SignedUploadURL returns a link allowing a PUT of exactly size bytes to key
+// until ttl has passed
+func (s *LocalStore) SignedUploadURL(ctx context.Context, key string, size int64, ttl time.Duration) (string, error) {
+	if size <= 0 {
+		return "", fmt.Errorf("upload size must be positive, got %d", size)
+	}
+	return s.sign(key, "PUT", size, time.Now().Add(ttl))
+}
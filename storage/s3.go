@@ -0,0 +1,202 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"product-management/config"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+)
+
+// S3Store is the ObjectStore backed by an S3 bucket or an S3-compatible store
+// such as MinIO. Credentials come from the usual AWS environment variables,
+// shared config files or instance role.
+type S3Store struct {
+	cfg      config.S3Config
+	client   *s3.S3
+	uploader *s3manager.Uploader
+}
+
+// NewS3Store returns an S3Store for the bucket described by cfg. The session is
+// created once and shared by every call.
+func NewS3Store(cfg config.S3Config) (*S3Store, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	awsConfig := &aws.Config{
+		Region:           aws.String(cfg.Region),
+		S3ForcePathStyle: aws.Bool(cfg.ForcePathStyle),
+	}
+	if cfg.Endpoint != "" {
+		awsConfig.Endpoint = aws.String(cfg.Endpoint)
+	}
+	sess, err := session.NewSession(awsConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create AWS session: %w", err)
+	}
+
+	client := s3.New(sess)
+	return &S3Store{
+		cfg:      cfg,
+		client:   client,
+		uploader: s3manager.NewUploaderWithClient(client),
+	}, nil
+}
+
+// Put streams body to the bucket, in parts when it is large
+func (s *S3Store) Put(ctx context.Context, key string, body io.Reader, contentType string) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+	input := &s3manager.UploadInput{
+		Bucket: aws.String(s.cfg.Bucket),
+		Key:    aws.String(key),
+		Body:   body,
+	}
+	if contentType != "" {
+		input.ContentType = aws.String(contentType)
+	}
+	if s.cfg.ACL != "" {
+		input.ACL = aws.String(s.cfg.ACL)
+	}
+	if _, err := s.uploader.UploadWithContext(ctx, input); err != nil {
+		return fmt.Errorf("failed to upload %s to S3: %w", key, err)
+	}
+	return nil
+}
+
+// Get opens the object under key
+func (s *S3Store) Get(ctx context.Context, key string) (io.ReadCloser, ObjectInfo, error) {
+	out, err := s.client.GetObjectWithContext(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.cfg.Bucket),
+		Key:    aws.String(key),
+	})
+	if isNotFound(err) {
+		return nil, ObjectInfo{}, fmt.Errorf("%w: %s", ErrNotFound, key)
+	}
+	if err != nil {
+		return nil, ObjectInfo{}, fmt.Errorf("failed to get %s from S3: %w", key, err)
+	}
+
+	info := ObjectInfo{
+		Key:         key,
+		ContentType: aws.StringValue(out.ContentType),
+		Size:        aws.Int64Value(out.ContentLength),
+		ModTime:     aws.TimeValue(out.LastModified),
+	}
+	return out.Body, info, nil
+}
+
+// Delete removes the object under key; S3 does not report missing objects
+func (s *S3Store) Delete(ctx context.Context, key string) error {
+	_, err := s.client.DeleteObjectWithContext(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(s.cfg.Bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete %s from S3: %w", key, err)
+	}
+	return nil
+}
+
+// URL returns the link to the object under key: below PublicURL when it is set,
+// otherwise in the bucket on the configured endpoint or on AWS
+func (s *S3Store) URL(key string) string {
+	switch {
+	case s.cfg.PublicURL != "":
+		return joinURL(s.cfg.PublicURL, key)
+	case s.cfg.Endpoint != "" && s.cfg.ForcePathStyle:
+		return joinURL(joinURL(s.cfg.Endpoint, s.cfg.Bucket), key)
+	case s.cfg.Endpoint != "":
+		endpoint, err := url.Parse(s.cfg.Endpoint)
+		if err != nil {
+			return joinURL(joinURL(s.cfg.Endpoint, s.cfg.Bucket), key)
+		}
+		endpoint.Host = s.cfg.Bucket + "." + endpoint.Host
+		return joinURL(endpoint.String(), key)
+	default:
+		return joinURL(fmt.Sprintf("https://%s.s3.%s.amazonaws.com", s.cfg.Bucket, s.cfg.Region), key)
+	}
+}
+
+// SignedURL presigns a GET or PUT of the object under key. A presigned PUT
+// carries the configured ACL, so the uploader must send the same x-amz-acl header.
+func (s *S3Store) SignedURL(ctx context.Context, key, method string, ttl time.Duration) (string, error) {
+	if err := checkKey(key); err != nil {
+		return "", err
+	}
+	if err := checkMethod(method); err != nil {
+		return "", err
+	}
+
+	var req *request.Request
+	if method == http.MethodPut {
+		input := &s3.PutObjectInput{Bucket: aws.String(s.cfg.Bucket), Key: aws.String(key)}
+		if s.cfg.ACL != "" {
+			input.ACL = aws.String(s.cfg.ACL)
+		}
+		req, _ = s.client.PutObjectRequest(input)
+	} else {
+		req, _ = s.client.GetObjectRequest(&s3.GetObjectInput{Bucket: aws.String(s.cfg.Bucket), Key: aws.String(key)})
+	}
+	req.SetContext(ctx)
+
+	signed, err := req.Presign(ttl)
+	if err != nil {
+		return "", fmt.Errorf("failed to presign %s of %s: %w", method, key, err)
+	}
+	return signed, nil
+}
+
+// SignedUploadURL presigns a PUT of exactly size bytes to key. Content-Length is
+// one of the signed headers, so S3 refuses an upload of any other size.
+func (s *S3Store) SignedUploadURL(ctx context.Context, key string, size int64, ttl time.Duration) (string, error) {
+	if err := checkKey(key); err != nil {
+		return "", err
+	}
+	if size <= 0 {
+		return "", fmt.Errorf("upload size must be positive, got %d", size)
+	}
+
+	input := &s3.PutObjectInput{Bucket: aws.String(s.cfg.Bucket), Key: aws.String(key), ContentLength: aws.Int64(size)}
+	if s.cfg.ACL != "" {
+		input.ACL = aws.String(s.cfg.ACL)
+	}
+	req, _ := s.client.PutObjectRequest(input)
+	req.SetContext(ctx)
+
+	signed, err := req.Presign(ttl)
+	if err != nil {
+		return "", fmt.Errorf("failed to presign upload of %s: %w", key, err)
+	}
+	return signed, nil
+}
+
+// UploadHeaders returns the x-amz-acl header presigned PUTs are signed with
+func (s *S3Store) UploadHeaders() map[string]string {
+	if s.cfg.ACL == "" {
+		return nil
+	}
+	return map[string]string{"x-amz-acl": s.cfg.ACL}
+}
+
+// isNotFound reports whether err is S3 saying the object does not exist
+func isNotFound(err error) bool {
+	var awsErr awserr.RequestFailure
+	if errors.As(err, &awsErr) && awsErr.StatusCode() == http.StatusNotFound {
+		return true
+	}
+	var codeErr awserr.Error
+	return errors.As(err, &codeErr) && codeErr.Code() == s3.ErrCodeNoSuchKey
+}
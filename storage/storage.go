@@ -0,0 +1,103 @@
+// Package storage stores processed images in S3, on the local filesystem or in
+// memory behind a single ObjectStore interface
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"path"
+	"product-management/config"
+	"strings"
+	"time"
+)
+
+// Backends accepted by StorageConfig.Backend
+const (
+	BackendS3     = "s3"
+	BackendLocal  = "local"
+	BackendMemory = "memory"
+)
+
+var (
+	// ErrNotFound is returned when no object is stored under a key
+	ErrNotFound = errors.New("object not found")
+	// ErrInvalidKey is returned for keys that are empty, absolute or climb out of
+	// the store with ..
+	ErrInvalidKey = errors.New("invalid object key")
+)
+
+// ObjectInfo describes a stored object
+type ObjectInfo struct {
+	Key         string
+	ContentType string
+	Size        int64
+	ModTime     time.Time
+}
+
+// ObjectStore stores objects under slash-separated keys such as
+// compressed/3f2a.jpg
+type ObjectStore interface {
+	// Put stores body under key, replacing any object already there
+	Put(ctx context.Context, key string, body io.Reader, contentType string) error
+	// Get opens the object under key; the caller closes the returned body. It
+	// returns ErrNotFound when there is no such object.
+	Get(ctx context.Context, key string) (io.ReadCloser, ObjectInfo, error)
+	// Delete removes the object under key; deleting a missing object is not an error
+	Delete(ctx context.Context, key string) error
+	// URL returns the permanent link to the object under key
+	URL(key string) string
+	// SignedURL returns a link allowing method, GET or PUT, on the object under key
+	// until ttl has passed
+	SignedURL(ctx context.Context, key, method string, ttl time.Duration) (string, error)
+	// SignedUploadURL returns a link allowing a PUT of exactly size bytes to key
+	// until ttl has passed; the uploader must send that Content-Length
+	SignedUploadURL(ctx context.Context, key string, size int64, ttl time.Duration) (string, error)
+}
+
+// Verifier is implemented by stores whose signed links are checked by this service
+// rather than by the storage backend, so the API has to accept them itself
+type Verifier interface {
+	// Verify reports whether query, taken from a link handed out by SignedURL,
+	// allows method on key now
+	Verify(key, method string, query url.Values) error
+}
+
+// UploadHeaderer is implemented by stores whose signed PUT links are only honored
+// when the upload carries particular headers
+type UploadHeaderer interface {
+	// UploadHeaders returns the headers every signed PUT must send
+	UploadHeaders() map[string]string
+}
+
+// New returns the ObjectStore selected by cfg.Backend; s3cfg configures the S3 backend
+func New(cfg config.StorageConfig, s3cfg config.S3Config) (ObjectStore, error) {
+	switch cfg.Backend {
+	case BackendS3:
+		return NewS3Store(s3cfg)
+	case BackendLocal:
+		return NewLocalStore(cfg.Dir, cfg.BaseURL, cfg.SigningSecret)
+	case BackendMemory:
+		return NewMemoryStore(cfg.BaseURL, cfg.SigningSecret), nil
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q", cfg.Backend)
+	}
+}
+
+// checkKey rejects keys that could address anything outside the store
+func checkKey(key string) error {
+	if key == "" || strings.HasPrefix(key, "/") || strings.Contains(key, `\`) || path.Clean(key) != key || key == ".." || strings.HasPrefix(key, "../") {
+		return fmt.Errorf("%w: %q", ErrInvalidKey, key)
+	}
+	return nil
+}
+
+// checkMethod rejects methods SignedURL cannot sign
+func checkMethod(method string) error {
+	if method != "GET" && method != "PUT" {
+		return fmt.Errorf("cannot sign %s requests; only GET and PUT are supported", method)
+	}
+	return nil
+}
@@ -1,19 +1,32 @@
 package tests
 
 import (
-	"bytes"
+	"context"
+	"database/sql"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
-	"product-management/api/handlers"
+	"product-management/api"
+	imageprocessor "product-management/image-processor"
 	"product-management/models"
+	services "product-management/services"
+	"product-management/tests/harness"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gorilla/mux"
 )
 
 func TestCreateProduct(t *testing.T) {
+	h := harness.New(t)
+	ownerID := h.CreateUser("owner", models.RoleUser)
+
 	// Define a test product
 	product := models.Product{
-		UserID:             1,
 		ProductName:        "Test Product",
 		ProductDescription: "A description of the test product",
 		ProductImages:      []string{"http://example.com/image1.jpg"},
@@ -26,133 +39,493 @@ func TestCreateProduct(t *testing.T) {
 		t.Fatalf("Error marshalling product: %v", err)
 	}
 
-	// Create a new HTTP request
-	req := httptest.NewRequest("POST", "/products", bytes.NewReader(productJSON))
-	req.Header.Set("Content-Type", "application/json")
-
-	// Create a new ResponseRecorder to capture the response
-	rr := httptest.NewRecorder()
-
-	// Create a mock handler for the CreateProduct function
-	handler := http.HandlerFunc(handlers.CreateProduct)
-
-	// Serve the request
-	handler.ServeHTTP(rr, req)
+	// Create the product as the authenticated owner
+	var returnedProduct models.Product
+	h.DoJSON("POST", "/products", string(productJSON), ownerID, http.StatusCreated, &returnedProduct)
 
-	// Check the response code
-	if rr.Code != http.StatusCreated {
-		t.Errorf("Expected status %v, but got %v", http.StatusCreated, rr.Code)
+	// Check if the returned product contains the correct data
+	if returnedProduct.ProductName != product.ProductName {
+		t.Errorf("Expected product name %v, but got %v", product.ProductName, returnedProduct.ProductName)
+	}
+	if returnedProduct.UserID != ownerID {
+		t.Errorf("Expected user ID %v, but got %v", ownerID, returnedProduct.UserID)
 	}
 
-	// Check if the returned product contains the correct data
-	var returnedProduct models.Product
-	err = json.NewDecoder(rr.Body).Decode(&returnedProduct)
+	// Every image is queued for the worker and marked pending
+	jobs := h.Queue.Jobs()
+	if len(jobs) != 1 || jobs[0].ProductID != returnedProduct.ID || jobs[0].SourceURL != product.ProductImages[0] {
+		t.Errorf("Unexpected queued jobs: %+v", jobs)
+	}
+	status, err := h.Products.GetImageStatus(context.Background(), returnedProduct.ID)
 	if err != nil {
-		t.Fatalf("Error decoding response body: %v", err)
+		t.Fatalf("Error reading image status: %v", err)
 	}
-
-	if returnedProduct.ProductName != product.ProductName {
-		t.Errorf("Expected product name %v, but got %v", product.ProductName, returnedProduct.ProductName)
+	if status.Status != services.ImageStatusPending {
+		t.Errorf("Expected image status %v, but got %v", services.ImageStatusPending, status.Status)
 	}
 }
+
 func TestGetProduct(t *testing.T) {
-	// Mock product data for the test
-	product := models.Product{
-		ID:                 1,
-		UserID:             1,
+	h := harness.New(t)
+	ownerID := h.CreateUser("owner", models.RoleUser)
+
+	// Store the product the request should return
+	product := services.Product{
+		UserID:             ownerID,
 		ProductName:        "Test Product",
 		ProductDescription: "Test product description",
 		ProductImages:      []string{"http://example.com/image1.jpg"},
 		ProductPrice:       100.00,
 	}
-
-	// Mock database query to return the test product (You can mock db.DB.QueryRow here)
-	// Here, we'll just assume this product is returned from the database
-
-	// Create a new HTTP request for GET /products/{id}
-	req := httptest.NewRequest("GET", "/products/1", nil)
-
-	// Create a new ResponseRecorder to capture the response
-	rr := httptest.NewRecorder()
-
-	// Mock the handler for GetProduct
-	handler := http.HandlerFunc(handlers.GetProduct)
-
-	// Serve the request
-	handler.ServeHTTP(rr, req)
-
-	// Check the response code
-	if rr.Code != http.StatusOK {
-		t.Errorf("Expected status %v, but got %v", http.StatusOK, rr.Code)
+	if err := h.Products.Create(context.Background(), &product); err != nil {
+		t.Fatalf("Error creating product: %v", err)
 	}
 
-	// Check the returned product data
+	// Fetch it by ID without a token
 	var returnedProduct models.Product
-	err := json.NewDecoder(rr.Body).Decode(&returnedProduct)
-	if err != nil {
-		t.Fatalf("Error decoding response body: %v", err)
-	}
+	h.DoJSON("GET", fmt.Sprintf("/products/%d", product.ID), "", 0, http.StatusOK, &returnedProduct)
 
+	// Check the returned product data
 	if returnedProduct.ProductName != product.ProductName {
 		t.Errorf("Expected product name %v, but got %v", product.ProductName, returnedProduct.ProductName)
 	}
 }
+
 func TestGetAllProducts(t *testing.T) {
-	// Mock product data for the test
-	products := []models.Product{
+	h := harness.New(t)
+	ownerID := h.CreateUser("owner", models.RoleUser)
+
+	// Store the products the list should return
+	products := []services.Product{
 		{
-			ID:                 1,
-			UserID:             1,
+			UserID:             ownerID,
 			ProductName:        "Test Product 1",
 			ProductDescription: "Description for test product 1",
 			ProductImages:      []string{"http://example.com/image1.jpg"},
 			ProductPrice:       50.00,
 		},
 		{
-			ID:                 2,
-			UserID:             1,
+			UserID:             ownerID,
 			ProductName:        "Test Product 2",
 			ProductDescription: "Description for test product 2",
 			ProductImages:      []string{"http://example.com/image2.jpg"},
 			ProductPrice:       150.00,
 		},
 	}
+	for i := range products {
+		if err := h.Products.Create(context.Background(), &products[i]); err != nil {
+			t.Fatalf("Error creating product: %v", err)
+		}
+	}
 
-	// Mock database query to return the list of products (You can mock db.DB.Query here)
-	// In this case, we'll assume the mock query would return the above products
+	// Products are listed in pages, oldest first by default
+	var page services.ProductPage
+	h.DoJSON("GET", "/products", "", 0, http.StatusOK, &page)
 
-	// Create a new HTTP request for GET /products
-	req := httptest.NewRequest("GET", "/products", nil)
+	// Validate if the returned products match the stored products
+	if len(page.Data) != len(products) {
+		t.Fatalf("Expected %d products, but got %d", len(products), len(page.Data))
+	}
+	for i, product := range products {
+		if page.Data[i].ProductName != product.ProductName {
+			t.Errorf("Expected product name %v, but got %v", product.ProductName, page.Data[i].ProductName)
+		}
+	}
+	if page.Paging.HasMore {
+		t.Errorf("Expected a single page, but got %+v", page.Paging)
+	}
+}
+
+// newMockRouter wires the product handlers against a sqlmock database
+func newMockRouter(t *testing.T) (*mux.Router, sqlmock.Sqlmock) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error creating sqlmock: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	products := services.NewPostgresProductRepository(db)
+	users := services.NewPostgresUserRepository(db)
+
+	router := api.NewRouter(api.Dependencies{Products: products, Users: users, Queue: imageprocessor.NewMemoryQueue(), Tokens: testTokens})
+	return router, mock
+}
+
+// authorizedRequest builds a request carrying a session token for userID
+func authorizedRequest(t *testing.T, method, path, body string, userID int) *http.Request {
+	token, _, err := testTokens.Issue(userID)
+	if err != nil {
+		t.Fatalf("Error issuing token: %v", err)
+	}
+
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer "+token)
+	return req
+}
+
+// expectCaller mocks the lookup of the authenticated user
+func expectCaller(mock sqlmock.Sqlmock, userID int, role string) {
+	mock.ExpectQuery("SELECT id, username, password, role FROM users WHERE id = \\$1").
+		WithArgs(userID).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username", "password", "role"}).AddRow(userID, "caller", "hash", role))
+}
 
-	// Create a new ResponseRecorder to capture the response
+// expectProduct mocks the lookup of an existing product owned by ownerID
+func expectProduct(mock sqlmock.Sqlmock, productID, ownerID int) {
+	mock.ExpectQuery("SELECT (.+) FROM products WHERE id = \\$1").
+		WithArgs(productID).
+		WillReturnRows(productRows().
+			AddRow(productID, ownerID, "Typo Prodcut", "Original description", "{http://example.com/image1.jpg}", 100.0, "{}", "{}", time.Now()))
+}
+
+// productRows returns an empty result set with the columns services reads for a product
+func productRows() *sqlmock.Rows {
+	return sqlmock.NewRows([]string{"id", "user_id", "product_name", "product_description", "product_images", "product_price", "compressed_product_images", "image_renditions", "created_at"})
+}
+
+func TestUpdateProduct(t *testing.T) {
+	router, mock := newMockRouter(t)
+
+	expectCaller(mock, 1, "user")
+	expectProduct(mock, 1, 1)
+	mock.ExpectQuery("UPDATE products SET").
+		WithArgs(1, "Renamed Product", "New description", sqlmock.AnyArg(), 75.5, 1).
+		WillReturnRows(productRows().AddRow(1, 1, "Renamed Product", "New description", "{}", 75.5, "{}", "{}", time.Now()))
+
+	body := `{"product_name": "Renamed Product", "product_description": "New description", "product_images": [], "product_price": 75.5}`
 	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, authorizedRequest(t, "PUT", "/products/1", body, 1))
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status %v, but got %v: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+
+	var returnedProduct models.Product
+	if err := json.NewDecoder(rr.Body).Decode(&returnedProduct); err != nil {
+		t.Fatalf("Error decoding response body: %v", err)
+	}
+	if returnedProduct.ID != 1 || returnedProduct.UserID != 1 || returnedProduct.ProductName != "Renamed Product" {
+		t.Errorf("Unexpected product returned: %+v", returnedProduct)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unmet database expectations: %v", err)
+	}
+}
+
+func TestUpdateProductErrors(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		path     string
+		body     string
+		setup    func(mock sqlmock.Sqlmock)
+		expected int
+	}{
+		{
+			name:     "invalid id",
+			path:     "/products/abc",
+			body:     `{"product_name": "x"}`,
+			expected: http.StatusBadRequest,
+		},
+		{
+			name:     "invalid payload",
+			path:     "/products/1",
+			body:     `{"product_name": `,
+			expected: http.StatusBadRequest,
+		},
+		{
+			name:     "mismatched id",
+			path:     "/products/1",
+			body:     `{"id": 2, "product_name": "x"}`,
+			expected: http.StatusBadRequest,
+		},
+		{
+			name: "not found",
+			path: "/products/42",
+			body: `{"product_name": "x"}`,
+			setup: func(mock sqlmock.Sqlmock) {
+				expectCaller(mock, 1, "user")
+				mock.ExpectQuery("SELECT (.+) FROM products").WillReturnError(sql.ErrNoRows)
+			},
+			expected: http.StatusNotFound,
+		},
+		{
+			name: "database failure",
+			path: "/products/1",
+			body: `{"product_name": "x"}`,
+			setup: func(mock sqlmock.Sqlmock) {
+				expectCaller(mock, 1, "user")
+				expectProduct(mock, 1, 1)
+				mock.ExpectQuery("UPDATE products SET").WillReturnError(errors.New("connection reset"))
+			},
+			expected: http.StatusInternalServerError,
+		},
+	}
 
-	// Mock the handler for GetAllProducts
-	handler := http.HandlerFunc(handlers.GetAllProducts)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router, mock := newMockRouter(t)
+			if tt.setup != nil {
+				tt.setup(mock)
+			}
 
-	// Serve the request
-	handler.ServeHTTP(rr, req)
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, authorizedRequest(t, "PUT", tt.path, tt.body, 1))
+
+			if rr.Code != tt.expected {
+				t.Errorf("Expected status %v, but got %v: %s", tt.expected, rr.Code, rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestPatchProduct(t *testing.T) {
+	router, mock := newMockRouter(t)
+
+	expectCaller(mock, 1, "user")
+	expectProduct(mock, 1, 1)
+	mock.ExpectQuery("UPDATE products SET").
+		WithArgs(1, "Typo Product", "Original description", sqlmock.AnyArg(), 100.0, 1).
+		WillReturnRows(productRows().AddRow(1, 1, "Typo Product", "Original description", "{http://example.com/image1.jpg}", 100.0, "{}", "{}", time.Now()))
+
+	req := authorizedRequest(t, "PATCH", "/products/1", `{"product_name": "Typo Product"}`, 1)
+	req.Header.Set("Content-Type", "application/merge-patch+json")
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
 
-	// Check the response code
 	if rr.Code != http.StatusOK {
-		t.Errorf("Expected status %v, but got %v", http.StatusOK, rr.Code)
+		t.Fatalf("Expected status %v, but got %v: %s", http.StatusOK, rr.Code, rr.Body.String())
 	}
 
-	// Check the returned products data
-	var returnedProducts []models.Product
-	err := json.NewDecoder(rr.Body).Decode(&returnedProducts)
-	if err != nil {
+	var returnedProduct models.Product
+	if err := json.NewDecoder(rr.Body).Decode(&returnedProduct); err != nil {
 		t.Fatalf("Error decoding response body: %v", err)
 	}
+	if returnedProduct.ProductName != "Typo Product" {
+		t.Errorf("Expected product name %v, but got %v", "Typo Product", returnedProduct.ProductName)
+	}
+	if len(returnedProduct.ProductImages) != 1 {
+		t.Errorf("Expected untouched product images, but got %v", returnedProduct.ProductImages)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unmet database expectations: %v", err)
+	}
+}
 
-	// Validate if the returned products match the mocked products
-	if len(returnedProducts) != len(products) {
-		t.Errorf("Expected %d products, but got %d", len(products), len(returnedProducts))
+func TestPatchProductErrors(t *testing.T) {
+	existing := func(mock sqlmock.Sqlmock) {
+		expectCaller(mock, 1, "user")
+		expectProduct(mock, 1, 1)
 	}
 
-	for i, product := range products {
-		if returnedProducts[i].ProductName != product.ProductName {
-			t.Errorf("Expected product name %v, but got %v", product.ProductName, returnedProducts[i].ProductName)
-		}
+	tests := []struct {
+		name     string
+		path     string
+		body     string
+		setup    func(mock sqlmock.Sqlmock)
+		expected int
+	}{
+		{
+			name:     "invalid id",
+			path:     "/products/0",
+			body:     `{}`,
+			expected: http.StatusBadRequest,
+		},
+		{
+			name: "not found",
+			path: "/products/9",
+			body: `{"product_price": 5}`,
+			setup: func(mock sqlmock.Sqlmock) {
+				expectCaller(mock, 1, "user")
+				mock.ExpectQuery("SELECT (.+) FROM products").WillReturnError(sql.ErrNoRows)
+			},
+			expected: http.StatusNotFound,
+		},
+		{name: "unknown field", path: "/products/1", body: `{"colour": "red"}`, setup: existing, expected: http.StatusBadRequest},
+		{name: "wrong type", path: "/products/1", body: `{"product_price": "cheap"}`, setup: existing, expected: http.StatusBadRequest},
+		{name: "id change", path: "/products/1", body: `{"id": 7}`, setup: existing, expected: http.StatusBadRequest},
+		{
+			name: "database failure",
+			path: "/products/1",
+			body: `{"product_price": 5}`,
+			setup: func(mock sqlmock.Sqlmock) {
+				expectCaller(mock, 1, "user")
+				mock.ExpectQuery("SELECT (.+) FROM products").WillReturnError(errors.New("connection reset"))
+			},
+			expected: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router, mock := newMockRouter(t)
+			if tt.setup != nil {
+				tt.setup(mock)
+			}
+
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, authorizedRequest(t, "PATCH", tt.path, tt.body, 1))
+
+			if rr.Code != tt.expected {
+				t.Errorf("Expected status %v, but got %v: %s", tt.expected, rr.Code, rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestDeleteProduct(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		path     string
+		setup    func(mock sqlmock.Sqlmock)
+		expected int
+	}{
+		{
+			name: "deleted",
+			path: "/products/1",
+			setup: func(mock sqlmock.Sqlmock) {
+				expectCaller(mock, 1, "user")
+				expectProduct(mock, 1, 1)
+				mock.ExpectExec("DELETE FROM products").WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+			expected: http.StatusNoContent,
+		},
+		{
+			name:     "invalid id",
+			path:     "/products/-3",
+			expected: http.StatusBadRequest,
+		},
+		{
+			name: "not found",
+			path: "/products/2",
+			setup: func(mock sqlmock.Sqlmock) {
+				expectCaller(mock, 1, "user")
+				mock.ExpectQuery("SELECT (.+) FROM products").WithArgs(2).WillReturnError(sql.ErrNoRows)
+			},
+			expected: http.StatusNotFound,
+		},
+		{
+			name: "database failure",
+			path: "/products/1",
+			setup: func(mock sqlmock.Sqlmock) {
+				expectCaller(mock, 1, "user")
+				expectProduct(mock, 1, 1)
+				mock.ExpectExec("DELETE FROM products").WillReturnError(errors.New("connection reset"))
+			},
+			expected: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router, mock := newMockRouter(t)
+			if tt.setup != nil {
+				tt.setup(mock)
+			}
+
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, authorizedRequest(t, "DELETE", tt.path, "", 1))
+
+			if rr.Code != tt.expected {
+				t.Errorf("Expected status %v, but got %v: %s", tt.expected, rr.Code, rr.Body.String())
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("Unmet database expectations: %v", err)
+			}
+		})
+	}
+}
+
+func TestProductMutationsRequireOwnership(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		method   string
+		path     string
+		body     string
+		role     string
+		after    func(mock sqlmock.Sqlmock)
+		expected int
+	}{
+		{name: "update by other user", method: "PUT", path: "/products/1", body: `{"product_name": "x"}`, role: "user", expected: http.StatusForbidden},
+		{name: "patch by other user", method: "PATCH", path: "/products/1", body: `{"product_name": "x"}`, role: "user", expected: http.StatusForbidden},
+		{name: "delete by other user", method: "DELETE", path: "/products/1", role: "user", expected: http.StatusForbidden},
+		{name: "process images by other user", method: "POST", path: "/products/1/images/process", role: "user", expected: http.StatusForbidden},
+		{
+			name:   "delete by admin",
+			method: "DELETE",
+			path:   "/products/1",
+			role:   "admin",
+			after: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec("DELETE FROM products").WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+			expected: http.StatusNoContent,
+		},
+		{
+			name:   "admin transfers ownership",
+			method: "PATCH",
+			path:   "/products/1",
+			body:   `{"user_id": 5}`,
+			role:   "admin",
+			after: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery("UPDATE products SET").WithArgs(5, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), 1).
+					WillReturnRows(productRows().AddRow(1, 5, "Typo Prodcut", "Original description", "{http://example.com/image1.jpg}", 100.0, "{}", "{}", time.Now()))
+			},
+			expected: http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router, mock := newMockRouter(t)
+			// Product 1 belongs to user 1; the caller is user 2
+			expectCaller(mock, 2, tt.role)
+			expectProduct(mock, 1, 1)
+			if tt.after != nil {
+				tt.after(mock)
+			}
+
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, authorizedRequest(t, tt.method, tt.path, tt.body, 2))
+
+			if rr.Code != tt.expected {
+				t.Errorf("Expected status %v, but got %v: %s", tt.expected, rr.Code, rr.Body.String())
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("Unmet database expectations: %v", err)
+			}
+		})
+	}
+}
+
+func TestOwnerCannotTransferProduct(t *testing.T) {
+	router, mock := newMockRouter(t)
+
+	expectCaller(mock, 1, "user")
+	expectProduct(mock, 1, 1)
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, authorizedRequest(t, "PUT", "/products/1", `{"user_id": 2, "product_name": "x"}`, 1))
+
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("Expected status %v, but got %v: %s", http.StatusForbidden, rr.Code, rr.Body.String())
+	}
+}
+
+func TestProductMutationsRequireToken(t *testing.T) {
+
+	for _, method := range []string{"PUT", "PATCH", "DELETE"} {
+		t.Run(method, func(t *testing.T) {
+			router, _ := newMockRouter(t)
+
+			req := httptest.NewRequest(method, "/products/1", strings.NewReader(`{}`))
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			if rr.Code != http.StatusUnauthorized {
+				t.Errorf("Expected status %v, but got %v", http.StatusUnauthorized, rr.Code)
+			}
+		})
 	}
 }
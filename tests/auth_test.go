@@ -0,0 +1,209 @@
+package tests
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	services "product-management/services"
+	"product-management/tests/harness"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// testTokens signs session tokens with the same settings as the harness, so
+// authorizedRequest works against both harness and sqlmock routers
+var testTokens = services.NewTokens(harness.AuthConfig)
+
+// hashedPasswordArg matches a bcrypt hash of the expected plaintext password
+type hashedPasswordArg struct {
+	password string
+}
+
+func (a hashedPasswordArg) Match(v driver.Value) bool {
+	hash, ok := v.(string)
+	return ok && hash != a.password && bcrypt.CompareHashAndPassword([]byte(hash), []byte(a.password)) == nil
+}
+
+func TestRegisterUser(t *testing.T) {
+	router, mock := newMockRouter(t)
+
+	mock.ExpectQuery("INSERT INTO users").
+		WithArgs("alice", hashedPasswordArg{password: "correct horse"}, "user").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(7))
+
+	req := httptest.NewRequest("POST", "/users", strings.NewReader(`{"username": "alice", "password": "correct horse"}`))
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected status %v, but got %v: %s", http.StatusCreated, rr.Code, rr.Body.String())
+	}
+	if strings.Contains(rr.Body.String(), "password") || strings.Contains(rr.Body.String(), "correct horse") {
+		t.Errorf("Response must not echo the password: %s", rr.Body.String())
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unmet database expectations: %v", err)
+	}
+}
+
+func TestRegisterUserErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		setup    func(mock sqlmock.Sqlmock)
+		expected int
+	}{
+		{name: "invalid payload", body: `{"username": `, expected: http.StatusBadRequest},
+		{name: "missing username", body: `{"password": "long enough"}`, expected: http.StatusBadRequest},
+		{name: "short password", body: `{"username": "bob", "password": "short"}`, expected: http.StatusBadRequest},
+		{name: "long username", body: `{"username": "` + strings.Repeat("b", 101) + `", "password": "long enough"}`, expected: http.StatusBadRequest},
+		{name: "long password", body: `{"username": "bob", "password": "` + strings.Repeat("a", 73) + `"}`, expected: http.StatusBadRequest},
+		{
+			name: "duplicate username",
+			body: `{"username": "bob", "password": "long enough"}`,
+			setup: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery("INSERT INTO users").WillReturnError(&pq.Error{Code: "23505"})
+			},
+			expected: http.StatusConflict,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router, mock := newMockRouter(t)
+			if tt.setup != nil {
+				tt.setup(mock)
+			}
+
+			req := httptest.NewRequest("POST", "/users", strings.NewReader(tt.body))
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expected {
+				t.Errorf("Expected status %v, but got %v: %s", tt.expected, rr.Code, rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestLogin(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("correct horse"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("Error hashing password: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		body     string
+		expected int
+	}{
+		{name: "valid credentials", body: `{"username": "alice", "password": "correct horse"}`, expected: http.StatusOK},
+		{name: "wrong password", body: `{"username": "alice", "password": "battery staple"}`, expected: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router, mock := newMockRouter(t)
+			mock.ExpectQuery("SELECT id, username, password, role FROM users").
+				WithArgs("alice").
+				WillReturnRows(sqlmock.NewRows([]string{"id", "username", "password", "role"}).AddRow(7, "alice", string(hash), "user"))
+
+			req := httptest.NewRequest("POST", "/auth/login", strings.NewReader(tt.body))
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expected {
+				t.Fatalf("Expected status %v, but got %v: %s", tt.expected, rr.Code, rr.Body.String())
+			}
+			if tt.expected != http.StatusOK {
+				return
+			}
+
+			var body struct {
+				Token string `json:"token"`
+			}
+			if err := json.NewDecoder(rr.Body).Decode(&body); err != nil {
+				t.Fatalf("Error decoding response body: %v", err)
+			}
+			userID, err := testTokens.Parse(body.Token)
+			if err != nil || userID != 7 {
+				t.Errorf("Expected a token for user 7, got user %v (err %v)", userID, err)
+			}
+		})
+	}
+}
+
+func TestLoginUnknownUser(t *testing.T) {
+	router, mock := newMockRouter(t)
+	mock.ExpectQuery("SELECT id, username, password, role FROM users").WillReturnRows(sqlmock.NewRows([]string{"id", "username", "password", "role"}))
+
+	req := httptest.NewRequest("POST", "/auth/login", strings.NewReader(`{"username": "nobody", "password": "whatever1"}`))
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %v, but got %v", http.StatusUnauthorized, rr.Code)
+	}
+}
+
+func TestCreateProductUsesAuthenticatedUser(t *testing.T) {
+	router, mock := newMockRouter(t)
+
+	token, _, err := testTokens.Issue(7)
+	if err != nil {
+		t.Fatalf("Error issuing token: %v", err)
+	}
+
+	mock.ExpectQuery("INSERT INTO products").
+		WithArgs(7, "Owned Product", "", sqlmock.AnyArg(), 10.0).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow(3, time.Now()))
+
+	req := httptest.NewRequest("POST", "/products", strings.NewReader(`{"user_id": 99, "product_name": "Owned Product", "product_price": 10}`))
+	// The scheme is case-insensitive
+	req.Header.Set("Authorization", "bearer "+token)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected status %v, but got %v: %s", http.StatusCreated, rr.Code, rr.Body.String())
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unmet database expectations: %v", err)
+	}
+}
+
+func TestCreateProductRequiresToken(t *testing.T) {
+
+	tests := []struct {
+		name   string
+		header string
+	}{
+		{name: "missing header", header: ""},
+		{name: "wrong scheme", header: "Basic YWxpY2U6c2VjcmV0"},
+		{name: "scheme without token", header: "Bearer "},
+		{name: "tampered token", header: "Bearer not.a.token"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router, _ := newMockRouter(t)
+
+			req := httptest.NewRequest("POST", "/products", strings.NewReader(`{"product_name": "x"}`))
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			if rr.Code != http.StatusUnauthorized {
+				t.Errorf("Expected status %v, but got %v", http.StatusUnauthorized, rr.Code)
+			}
+		})
+	}
+}
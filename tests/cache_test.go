@@ -0,0 +1,198 @@
+package tests
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"product-management/api"
+	imageprocessor "product-management/image-processor"
+	services "product-management/services"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/gorilla/mux"
+)
+
+// newCachedRouter wires the product handlers against sqlmock and an in-process Redis
+func newCachedRouter(t *testing.T) (*mux.Router, sqlmock.Sqlmock, *miniredis.Miniredis) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error creating sqlmock: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	products := services.NewPostgresProductRepository(db)
+	users := services.NewPostgresUserRepository(db)
+
+	router := api.NewRouter(api.Dependencies{
+		Products: products,
+		Users:    users,
+		Cache:    client,
+		CacheTTL: time.Minute,
+		Queue:    imageprocessor.NewMemoryQueue(),
+		Tokens:   testTokens,
+	})
+	return router, mock, server
+}
+
+func TestGetProductReadsThroughCache(t *testing.T) {
+	router, mock, server := newCachedRouter(t)
+	expectProduct(mock, 1, 1)
+
+	for i := 0; i < 3; i++ {
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, httptest.NewRequest("GET", "/products/1", nil))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Request %d: expected status %v, but got %v: %s", i, http.StatusOK, rr.Code, rr.Body.String())
+		}
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unmet database expectations: %v", err)
+	}
+	if !server.Exists("product:1") {
+		t.Fatalf("Expected product:1 to be cached")
+	}
+	if ttl := server.TTL("product:1"); ttl != time.Minute {
+		t.Errorf("Expected a TTL of %v, got %v", time.Minute, ttl)
+	}
+}
+
+func TestGetProductCollapsesConcurrentMisses(t *testing.T) {
+	router, mock, _ := newCachedRouter(t)
+	mock.ExpectQuery("SELECT (.+) FROM products WHERE id = \\$1").
+		WillDelayFor(100 * time.Millisecond).
+		WillReturnRows(productRows().AddRow(1, 1, "Hot Product", "", "{}", 1.0, "{}", "{}", time.Now()))
+
+	var wg sync.WaitGroup
+	codes := make([]int, 20)
+	for i := range codes {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, httptest.NewRequest("GET", "/products/1", nil))
+			codes[i] = rr.Code
+		}(i)
+	}
+	wg.Wait()
+
+	for i, code := range codes {
+		if code != http.StatusOK {
+			t.Errorf("Request %d: expected status %v, but got %v", i, http.StatusOK, code)
+		}
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unmet database expectations: %v", err)
+	}
+}
+
+func TestProductMutationsInvalidateCache(t *testing.T) {
+
+	tests := []struct {
+		name   string
+		method string
+		body   string
+		expect func(mock sqlmock.Sqlmock)
+	}{
+		{
+			name:   "update",
+			method: "PUT",
+			body:   `{"product_name": "Renamed"}`,
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery("UPDATE products SET").WillReturnRows(productRows().AddRow(1, 1, "Renamed", "", "{}", 1.0, "{}", "{}", time.Now()))
+			},
+		},
+		{
+			name:   "patch",
+			method: "PATCH",
+			body:   `{"product_price": 12}`,
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery("UPDATE products SET").WillReturnRows(productRows().AddRow(1, 1, "Renamed", "", "{}", 1.0, "{}", "{}", time.Now()))
+			},
+		},
+		{
+			name:   "delete",
+			method: "DELETE",
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec("DELETE FROM products").WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router, mock, server := newCachedRouter(t)
+			server.Set("product:1", `{"id": 1, "product_name": "Stale"}`)
+
+			expectCaller(mock, 1, "user")
+			expectProduct(mock, 1, 1)
+			tt.expect(mock)
+
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, authorizedRequest(t, tt.method, "/products/1", tt.body, 1))
+			if rr.Code >= 300 {
+				t.Fatalf("Expected success, but got %v: %s", rr.Code, rr.Body.String())
+			}
+			if server.Exists("product:1") {
+				t.Errorf("Expected product:1 to be invalidated")
+			}
+		})
+	}
+}
+
+func TestInvalidationDuringLoadIsNotOverwritten(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error creating sqlmock: %v", err)
+	}
+	defer db.Close()
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	defer client.Close()
+	cache := services.NewProductCache(client, time.Minute)
+	products := services.NewPostgresProductRepository(db)
+
+	mock.ExpectQuery("SELECT (.+) FROM products WHERE id = \\$1").
+		WillDelayFor(100 * time.Millisecond).
+		WillReturnRows(productRows().AddRow(1, 1, "Old Name", "", "{}", 1.0, "{}", "{}", time.Now()))
+
+	loaded := make(chan error)
+	go func() {
+		_, err := services.GetProductCached(context.Background(), products, cache, 1)
+		loaded <- err
+	}()
+	// Invalidate while the load is still reading the old row
+	time.Sleep(30 * time.Millisecond)
+	if err := services.InvalidateProduct(context.Background(), cache, 1); err != nil {
+		t.Fatalf("Error invalidating product: %v", err)
+	}
+	if err := <-loaded; err != nil {
+		t.Fatalf("Error loading product: %v", err)
+	}
+
+	if server.Exists("product:1") {
+		t.Errorf("Expected the load that raced the invalidation not to be cached")
+	}
+}
+
+func TestGetProductFallsBackWhenRedisIsDown(t *testing.T) {
+	router, mock, server := newCachedRouter(t)
+	server.Close()
+	expectProduct(mock, 1, 1)
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("GET", "/products/1", nil))
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("Expected status %v, but got %v: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+}
@@ -0,0 +1,234 @@
+package tests
+
+import (
+	"os"
+	"path/filepath"
+	"product-management/config"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeFile writes contents to name in a fresh temporary directory and returns its path
+func writeFile(t *testing.T, name, contents string) string {
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(contents), 0o600); err != nil {
+		t.Fatalf("Error writing %s: %v", name, err)
+	}
+	return path
+}
+
+func TestLoadDefaults(t *testing.T) {
+	cfg, err := config.Load("", "")
+	if err != nil {
+		t.Fatalf("Error loading defaults: %v", err)
+	}
+	if !reflect.DeepEqual(*cfg, config.Default()) {
+		t.Errorf("Expected the defaults, but got %+v", cfg)
+	}
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	file := writeFile(t, "config.yaml", `
+server:
+  port: 9000
+  read_timeout: 5s
+db:
+  host: db.internal
+  name: from_file
+redis:
+  host: redis.internal
+`)
+	envFile := writeFile(t, ".env", "DB_NAME=from_dotenv\nREDIS_HOST=redis.dotenv\n")
+	t.Setenv("REDIS_HOST", "redis.env")
+
+	cfg, err := config.Load(file, envFile)
+	if err != nil {
+		t.Fatalf("Error loading config: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		got      interface{}
+		expected interface{}
+	}{
+		{name: "default", got: cfg.Redis.Port, expected: 6379},
+		{name: "file over default", got: cfg.Server.Port, expected: 9000},
+		{name: "file duration", got: cfg.Server.ReadTimeout, expected: 5 * time.Second},
+		{name: "file only", got: cfg.DB.Host, expected: "db.internal"},
+		{name: ".env over file", got: cfg.DB.Name, expected: "from_dotenv"},
+		{name: "environment over .env", got: cfg.Redis.Host, expected: "redis.env"},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.expected {
+			t.Errorf("%s: expected %v, but got %v", tt.name, tt.expected, tt.got)
+		}
+	}
+}
+
+func TestLoadJSONFile(t *testing.T) {
+	file := writeFile(t, "config.json", `{"amqp": {"url": "amqps://broker:5671/"}, "image": {"primary_rendition": "card", "download_timeout": "10s",
+		"renditions": [{"name": "card", "width": 640, "fit": "fit", "format": "png"}]}}`)
+
+	cfg, err := config.Load(file, "")
+	if err != nil {
+		t.Fatalf("Error loading config: %v", err)
+	}
+	if cfg.AMQP.URL != "amqps://broker:5671/" || cfg.Image.DownloadTimeout != 10*time.Second {
+		t.Errorf("Unexpected config: %+v", cfg)
+	}
+	expected := []config.RenditionConfig{{Name: "card", Width: 640, Fit: config.FitInside, Format: "png"}}
+	if !reflect.DeepEqual(cfg.Image.Renditions, expected) {
+		t.Errorf("Expected the file's renditions to replace the defaults, but got %+v", cfg.Image.Renditions)
+	}
+}
+
+func TestLoadEnvironmentAliases(t *testing.T) {
+	t.Setenv("CACHE_HOST", "cache.internal")
+	t.Setenv("PORT", "3000")
+	t.Setenv("AWS_REGION", "eu-west-1")
+
+	cfg, err := config.Load("", "")
+	if err != nil {
+		t.Fatalf("Error loading config: %v", err)
+	}
+	if cfg.Redis.Host != "cache.internal" || cfg.Server.Port != 3000 || cfg.S3.Region != "eu-west-1" {
+		t.Errorf("Expected the aliases to be honoured, but got %+v", cfg)
+	}
+
+	t.Setenv("REDIS_HOST", "redis.internal")
+	cfg, err = config.Load("", "")
+	if err != nil {
+		t.Fatalf("Error loading config: %v", err)
+	}
+	if cfg.Redis.Host != "redis.internal" {
+		t.Errorf("Expected REDIS_HOST to win over CACHE_HOST, but got %q", cfg.Redis.Host)
+	}
+}
+
+func TestLoadMissingEnvFile(t *testing.T) {
+	if _, err := config.Load("", filepath.Join(t.TempDir(), ".env")); err != nil {
+		t.Errorf("Expected a missing .env file to be ignored, but got %v", err)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		file     string
+		contents string
+		env      map[string]string
+		expected []string
+	}{
+		{
+			name:     "unknown key",
+			file:     "config.yaml",
+			contents: "server:\n  prot: 9000\n",
+			expected: []string{"field prot not found"},
+		},
+		{
+			name:     "unsupported extension",
+			file:     "config.toml",
+			contents: "",
+			expected: []string{"extension must be .yaml, .yml or .json"},
+		},
+		{
+			name:     "unparseable variable",
+			env:      map[string]string{"SERVER_PORT": "eighty", "SHUTDOWN_TIMEOUT": "soon"},
+			expected: []string{"server.port (SERVER_PORT) is invalid", "server.shutdown_timeout (SHUTDOWN_TIMEOUT) is invalid"},
+		},
+		{
+			name: "invalid renditions",
+			file: "config.yaml",
+			contents: `
+image:
+  primary_rendition: thumb
+  renditions:
+    - {name: thumb, width: 100, fit: fill, format: jpeg, quality: 80}
+    - {name: Thumb/2, fit: fit, format: gif}
+    - {name: thumb, width: 100, height: 100, fit: stretch, format: png, alternates: [webp, avif, webp]}
+`,
+			expected: []string{
+				"image.renditions[0].width and height must both be set to fill",
+				`image.renditions[1].name must be lowercase letters, digits, - or _, got "Thumb/2"`,
+				"image.renditions[1].width or height must be set",
+				`image.renditions[1].format must be jpeg, png or webp, got "gif"`,
+				`image.renditions[2].fit must be fit or fill, got "stretch"`,
+				`image.renditions[2].name "thumb" is used twice`,
+				`image.renditions[2].alternates[1] must be jpeg, png or webp, got "avif"`,
+				"image.renditions[2].alternates[2] repeats format webp",
+			},
+		},
+		{
+			name: "every invalid setting",
+			env: map[string]string{
+				"SERVER_PORT":             "70000",
+				"DB_SSLMODE":              "sometimes",
+				"AMQP_URL":                "http://broker",
+				"IMAGE_PRIMARY_RENDITION": "poster",
+				"TRACING_EXPORTER":        "jaeger",
+				"TRACING_SAMPLE_RATIO":    "1.5",
+				"STORAGE_BACKEND":         "ftp",
+			},
+			expected: []string{
+				"invalid configuration",
+				"server.port (SERVER_PORT) must be between 1 and 65535, got 70000",
+				`db.sslmode (DB_SSLMODE) must be one of`,
+				"amqp.url (AMQP_URL) must be an amqp:// or amqps:// URL",
+				`image.primary_rendition (IMAGE_PRIMARY_RENDITION) must name one of the renditions, got "poster"`,
+				`tracing.exporter (TRACING_EXPORTER) must be none, stdout or otlp, got "jaeger"`,
+				"tracing.sample_ratio (TRACING_SAMPLE_RATIO) must be between 0 and 1, got 1.5",
+				`storage.backend (STORAGE_BACKEND) must be s3, local or memory, got "ftp"`,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for key, value := range tt.env {
+				t.Setenv(key, value)
+			}
+			var file string
+			if tt.file != "" {
+				file = writeFile(t, tt.file, tt.contents)
+			}
+
+			_, err := config.Load(file, "")
+			if err == nil {
+				t.Fatalf("Expected an error")
+			}
+			for _, expected := range tt.expected {
+				if !strings.Contains(err.Error(), expected) {
+					t.Errorf("Expected the error to contain %q, but got:\n%v", expected, err)
+				}
+			}
+		})
+	}
+}
+
+func TestAuthConfigValidate(t *testing.T) {
+	// Only the API checks the secret, so the worker and migrations load without it
+	t.Setenv("AUTH_SECRET", "")
+	cfg, err := config.Load("", "")
+	if err != nil {
+		t.Fatalf("Error loading config without AUTH_SECRET: %v", err)
+	}
+	if err := cfg.Auth.Validate(); err == nil || !strings.Contains(err.Error(), "auth.secret (AUTH_SECRET) is required") {
+		t.Errorf("Expected the secret to be required, but got %v", err)
+	}
+	cfg.Auth.Secret = "secret"
+	if err := cfg.Auth.Validate(); err != nil {
+		t.Errorf("Expected a secret to be enough, but got %v", err)
+	}
+}
+
+func TestS3ConfigValidate(t *testing.T) {
+	err := config.S3Config{}.Validate()
+	if err == nil || !strings.Contains(err.Error(), "s3.bucket (S3_BUCKET) is required") || !strings.Contains(err.Error(), "s3.region (S3_REGION) is required") {
+		t.Errorf("Expected bucket and region to be required, but got %v", err)
+	}
+	if err := (config.S3Config{Bucket: "images", Region: "us-east-1"}).Validate(); err != nil {
+		t.Errorf("Expected a complete S3 config to be valid, but got %v", err)
+	}
+}
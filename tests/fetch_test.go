@@ -0,0 +1,205 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"product-management/config"
+	imageprocessor "product-management/image-processor"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// localImageConfig is the default image configuration allowed to fetch from the
+// test servers on the loopback interface
+func localImageConfig() config.ImageConfig {
+	imagecfg := config.Default().Image
+	imagecfg.AllowPrivateNetworks = true
+	return imagecfg
+}
+
+// encodePNG returns a width by height PNG
+func encodePNG(t *testing.T, width, height int) []byte {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, width, height))); err != nil {
+		t.Fatalf("Error encoding PNG: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// truncatedPNG returns a PNG whose header is intact but whose pixel data is cut
+// short, so it passes the fetcher's checks and fails to decode
+func truncatedPNG(t *testing.T) []byte {
+	return encodePNG(t, 64, 64)[:40]
+}
+
+func TestIsInternalAddr(t *testing.T) {
+	tests := map[string]bool{
+		"127.0.0.1":        true,
+		"10.1.2.3":         true,
+		"172.16.0.1":       true,
+		"192.168.1.1":      true,
+		"169.254.169.254":  true,
+		"100.64.0.1":       true,
+		"0.0.0.0":          true,
+		"224.0.0.1":        true,
+		"::1":              true,
+		"::ffff:127.0.0.1": true,
+		"fd00::1":          true,
+		"fe80::1":          true,
+		"64:ff9b::a00:1":   true,
+		// 6to4 and Teredo for 10.1.2.3
+		"2002:a01:203::1":                      true,
+		"2001:0:4136:e378:8000:63bf:f5fe:fdfc": true,
+		"93.184.216.34":                        false,
+		"2606:4700::1111":                      false,
+	}
+	for address, internal := range tests {
+		if got := imageprocessor.IsInternalAddr(netip.MustParseAddr(address)); got != internal {
+			t.Errorf("%s: expected internal %v, but got %v", address, internal, got)
+		}
+	}
+}
+
+func TestFetcherRefusesInternalAddresses(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Write(encodePNG(t, 8, 8))
+	}))
+	defer server.Close()
+
+	fetcher := imageprocessor.NewFetcher(config.Default().Image)
+	port := server.URL[strings.LastIndex(server.URL, ":")+1:]
+	for _, sourceURL := range []string{server.URL + "/a.png", "http://localhost:" + port + "/a.png", "http://[::ffff:127.0.0.1]:" + port + "/a.png"} {
+		if _, err := fetcher.Fetch(context.Background(), sourceURL); !errors.Is(err, imageprocessor.ErrBlockedAddress) {
+			t.Errorf("%s: expected ErrBlockedAddress, but got %v", sourceURL, err)
+		}
+	}
+	if _, err := fetcher.Fetch(context.Background(), "file:///etc/passwd"); err == nil {
+		t.Errorf("Expected a file URL to be refused")
+	}
+	if requests != 0 {
+		t.Errorf("Expected no request to reach the server, but got %d", requests)
+	}
+}
+
+func TestFetcherLimits(t *testing.T) {
+	image := encodePNG(t, 64, 64)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ok.png", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Write(image)
+	})
+	mux.HandleFunc("/redirect/", func(w http.ResponseWriter, r *http.Request) {
+		hops, _ := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/redirect/"))
+		if hops == 0 {
+			http.Redirect(w, r, "/ok.png", http.StatusFound)
+			return
+		}
+		http.Redirect(w, r, fmt.Sprintf("/redirect/%d", hops-1), http.StatusFound)
+	})
+	mux.HandleFunc("/ftp.png", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "ftp://example.com/a.png", http.StatusFound)
+	})
+	mux.HandleFunc("/declared-large.png", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "4096")
+		w.Write(bytes.Repeat([]byte{0}, 4096))
+	})
+	mux.HandleFunc("/streamed-large.png", func(w http.ResponseWriter, r *http.Request) {
+		w.Write(image)
+		w.(http.Flusher).Flush()
+		w.Write(bytes.Repeat([]byte{0}, 4096))
+	})
+	mux.HandleFunc("/page.png", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write(image)
+	})
+	mux.HandleFunc("/mislabelled.png", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		w.Write([]byte("<html><body>not an image</body></html>"))
+	})
+	mux.HandleFunc("/bomb.png", func(w http.ResponseWriter, r *http.Request) {
+		w.Write(encodePNG(t, 200, 100))
+	})
+	mux.HandleFunc("/unavailable.png", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	mux.HandleFunc("/slow.png", func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+		w.Write(image)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	imagecfg := localImageConfig()
+	imagecfg.MaxBytes = 2048
+	imagecfg.MaxPixels = 10000
+	imagecfg.MaxRedirects = 2
+	imagecfg.DownloadTimeout = 100 * time.Millisecond
+	fetcher := imageprocessor.NewFetcher(imagecfg)
+
+	tests := []struct {
+		path      string
+		expected  error
+		message   string
+		transient bool
+	}{
+		{path: "/ok.png"},
+		{path: "/redirect/1"},
+		{path: "/redirect/2", message: "stopped after 2 redirects"},
+		{path: "/ftp.png", message: "redirect to a ftp URL is not allowed"},
+		{path: "/missing.png", message: "status code 404"},
+		{path: "/unavailable.png", message: "status code 503", transient: true},
+		{path: "/declared-large.png", expected: imageprocessor.ErrImageTooLarge},
+		{path: "/streamed-large.png", expected: imageprocessor.ErrImageTooLarge},
+		{path: "/page.png", expected: imageprocessor.ErrNotAnImage},
+		{path: "/mislabelled.png", expected: imageprocessor.ErrNotAnImage},
+		{path: "/bomb.png", expected: imageprocessor.ErrImageTooLarge, message: "200x100 is over the limit of 10000 pixels"},
+		{path: "/slow.png", message: "Client.Timeout", transient: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			data, err := fetcher.Fetch(context.Background(), server.URL+tt.path)
+			if tt.expected == nil && tt.message == "" {
+				if err != nil || !bytes.Equal(data, image) {
+					t.Errorf("Expected the image, but got %d bytes and %v", len(data), err)
+				}
+				return
+			}
+			if tt.expected != nil && !errors.Is(err, tt.expected) {
+				t.Errorf("Expected %v, but got %v", tt.expected, err)
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.message) {
+				t.Errorf("Expected an error containing %q, but got %v", tt.message, err)
+			}
+			if imageprocessor.IsPermanent(err) == tt.transient {
+				t.Errorf("Expected permanent=%t, but got %v", !tt.transient, err)
+			}
+		})
+	}
+}
+
+func TestCheckImage(t *testing.T) {
+	if format, err := imageprocessor.CheckImage(encodePNG(t, 10, 10), 100); err != nil || format != "png" {
+		t.Errorf("Expected a valid png, but got %q, %v", format, err)
+	}
+	if _, err := imageprocessor.CheckImage(truncatedPNG(t), 64*64); err != nil {
+		t.Errorf("Expected only the header to be checked, but got %v", err)
+	}
+	if _, err := imageprocessor.CheckImage(encodePNG(t, 10, 11), 100); !errors.Is(err, imageprocessor.ErrImageTooLarge) {
+		t.Errorf("Expected ErrImageTooLarge, but got %v", err)
+	}
+	// A PNG signature followed by garbage sniffs as PNG but has no readable header
+	if _, err := imageprocessor.CheckImage([]byte("\x89PNG\r\n\x1a\nnot really"), 100); !errors.Is(err, imageprocessor.ErrNotAnImage) {
+		t.Errorf("Expected ErrNotAnImage, but got %v", err)
+	}
+}
@@ -0,0 +1,179 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+	"net/http"
+	"net/http/httptest"
+	"product-management/api"
+	"product-management/config"
+	imageprocessor "product-management/image-processor"
+	"product-management/models"
+	services "product-management/services"
+	"product-management/storage"
+	"product-management/tests/harness"
+	"strings"
+	"testing"
+
+	"github.com/HugoSmits86/nativewebp"
+)
+
+func TestProcessImageDecodesGIFAndWebP(t *testing.T) {
+	source := image.NewPaletted(image.Rect(0, 0, 400, 300), []color.Color{color.White, color.RGBA{G: 180, A: 255}})
+	for x := 0; x < 400; x++ {
+		source.SetColorIndex(x, x%300, 1)
+	}
+	var gifData, webpData bytes.Buffer
+	if err := gif.Encode(&gifData, source, nil); err != nil {
+		t.Fatalf("Error encoding GIF: %v", err)
+	}
+	// Renditions reach the encoder as NRGBA images, so the source is encoded the same way
+	nrgba := image.NewNRGBA(source.Bounds())
+	draw.Draw(nrgba, nrgba.Bounds(), source, image.Point{}, draw.Src)
+	if err := nativewebp.Encode(&webpData, nrgba, nil); err != nil {
+		t.Fatalf("Error encoding WebP: %v", err)
+	}
+	sources := map[string][]byte{"/photo.gif": gifData.Bytes(), "/photo.webp": webpData.Bytes()}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(sources[r.URL.Path])
+	}))
+	defer server.Close()
+
+	imagecfg := localImageConfig()
+	imagecfg.Renditions = []config.RenditionConfig{
+		{Name: "card", Width: 200, Fit: config.FitInside, Format: config.FormatJPEG, Alternates: []string{config.FormatWebP, config.FormatPNG}, Quality: 80},
+	}
+	store := storage.NewMemoryStore("https://cdn.example.com", "")
+	processor := imageprocessor.NewProcessor(store, imagecfg)
+
+	for path := range sources {
+		t.Run(path, func(t *testing.T) {
+			renditions, err := processor.ProcessImage(context.Background(), server.URL+path)
+			if err != nil {
+				t.Fatalf("Error processing image: %v", err)
+			}
+			card := renditions["card"]
+			if card.Format != config.FormatJPEG || card.Width != 200 || card.Height != 150 || len(card.Alternates) != 2 {
+				t.Fatalf("Expected a 200x150 JPEG with two alternates, but got %+v", card)
+			}
+
+			for format, encoding := range card.Encodings() {
+				if encoding.Key != imageprocessor.RenditionKey(server.URL+path, "card", format) || encoding.URL != "https://cdn.example.com/"+encoding.Key {
+					t.Errorf("%s: unexpected encoding %+v", format, encoding)
+				}
+				body, info, err := store.Get(context.Background(), encoding.Key)
+				if err != nil {
+					t.Fatalf("%s: error reading encoding: %v", format, err)
+				}
+				stored, decoded, err := image.Decode(body)
+				body.Close()
+				if err != nil {
+					t.Fatalf("%s: error decoding encoding: %v", format, err)
+				}
+				if decoded != format || info.ContentType != imageprocessor.ContentType(format) || info.Size != int64(encoding.Bytes) || stored.Bounds().Dx() != 200 {
+					t.Errorf("%s: expected a 200 pixel wide %s, but got %s (%s) %v of %d bytes", format, format, decoded, info.ContentType, stored.Bounds(), info.Size)
+				}
+			}
+		})
+	}
+}
+
+// seedRenditions stores a rendition of the product's first image in three formats of
+// distinct sizes and records it on the product
+func seedRenditions(t *testing.T, products *services.MemoryProductRepository, store storage.ObjectStore, productID int, sourceURL string) imageprocessor.Rendition {
+	rendition := imageprocessor.Rendition{Width: 160, Height: 160, Format: config.FormatJPEG, Alternates: map[string]imageprocessor.Encoding{}}
+	for format, size := range map[string]int{config.FormatJPEG: 1000, config.FormatWebP: 600, config.FormatPNG: 2000} {
+		key := imageprocessor.RenditionKey(sourceURL, "thumbnail", format)
+		if err := store.Put(context.Background(), key, strings.NewReader(strings.Repeat(format[:1], size)), imageprocessor.ContentType(format)); err != nil {
+			t.Fatalf("Error storing %s: %v", format, err)
+		}
+		encoding := imageprocessor.Encoding{URL: store.URL(key), Key: key, Bytes: size}
+		if format == rendition.Format {
+			rendition.URL, rendition.Key, rendition.Bytes = encoding.URL, encoding.Key, encoding.Bytes
+		} else {
+			rendition.Alternates[format] = encoding
+		}
+	}
+	renditions := imageprocessor.Renditions{"thumbnail": rendition}
+	if err := products.SetImageRenditions(context.Background(), productID, 0, sourceURL, "", renditions); err != nil {
+		t.Fatalf("Error storing renditions: %v", err)
+	}
+	return rendition
+}
+
+func TestServeRenditionNegotiatesFormat(t *testing.T) {
+	h := harness.New(t)
+	ownerID := h.CreateUser("owner", models.RoleUser)
+	var product services.Product
+	h.DoJSON("POST", "/products", `{"product_name":"Lamp","product_price":40,"product_images":["http://example.com/a.jpg"]}`, ownerID, http.StatusCreated, &product)
+	seedRenditions(t, h.Products, h.Store, product.ID, "http://example.com/a.jpg")
+	path := fmt.Sprintf("/products/%d/images/0/thumbnail", product.ID)
+
+	tests := []struct {
+		name     string
+		accept   string
+		status   int
+		expected string
+	}{
+		{name: "no Accept header takes the smallest", accept: "", status: http.StatusOK, expected: config.FormatWebP},
+		{name: "browser", accept: "image/avif,image/webp,image/apng,image/svg+xml,image/*,*/*;q=0.8", status: http.StatusOK, expected: config.FormatWebP},
+		{name: "only jpeg", accept: "image/jpeg", status: http.StatusOK, expected: config.FormatJPEG},
+		{name: "higher quality wins over size", accept: "image/png, image/*;q=0.5", status: http.StatusOK, expected: config.FormatPNG},
+		{name: "refused format", accept: "image/webp;q=0, image/*", status: http.StatusOK, expected: config.FormatJPEG},
+		{name: "invalid quality is ignored", accept: "image/webp;q=high, image/png", status: http.StatusOK, expected: config.FormatPNG},
+		{name: "nothing acceptable", accept: "text/html", status: http.StatusNotAcceptable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", path, nil)
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+			rr := httptest.NewRecorder()
+			h.Router.ServeHTTP(rr, req)
+
+			if rr.Code != tt.status {
+				t.Fatalf("Expected status %v, but got %v: %s", tt.status, rr.Code, rr.Body.String())
+			}
+			if rr.Header().Get("Vary") != "Accept" {
+				t.Errorf("Expected Vary: Accept, but got %q", rr.Header().Get("Vary"))
+			}
+			if tt.status != http.StatusOK {
+				return
+			}
+			if got := rr.Header().Get("Content-Type"); got != imageprocessor.ContentType(tt.expected) {
+				t.Errorf("Expected %s, but got %s", imageprocessor.ContentType(tt.expected), got)
+			}
+			if body := rr.Body.String(); !strings.HasPrefix(body, tt.expected[:1]) || rr.Header().Get("Content-Length") != fmt.Sprint(len(body)) {
+				t.Errorf("Expected the stored %s, but got %d bytes starting %q", tt.expected, len(body), body[:1])
+			}
+		})
+	}
+
+	for _, missing := range []string{"/products/%d/images/1/thumbnail", "/products/%d/images/0/poster", "/products/%d9/images/0/thumbnail"} {
+		h.DoJSON("GET", fmt.Sprintf(missing, product.ID), "", 0, http.StatusNotFound, nil)
+	}
+}
+
+func TestServeRenditionRedirectsWithoutStore(t *testing.T) {
+	products := services.NewMemoryProductRepository()
+	product := services.Product{UserID: 1, ProductName: "Lamp", ProductPrice: 40, ProductImages: []string{"http://example.com/a.jpg"}}
+	if err := products.Create(context.Background(), &product); err != nil {
+		t.Fatalf("Error creating product: %v", err)
+	}
+	rendition := seedRenditions(t, products, storage.NewMemoryStore("https://cdn.example.com", ""), product.ID, "http://example.com/a.jpg")
+	router := api.NewRouter(api.Dependencies{Products: products, Users: services.NewMemoryUserRepository()})
+
+	req := httptest.NewRequest("GET", fmt.Sprintf("/products/%d/images/0/thumbnail", product.ID), nil)
+	req.Header.Set("Accept", "image/jpeg")
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusFound || rr.Header().Get("Location") != rendition.URL {
+		t.Errorf("Expected a redirect to %s, but got %v to %q", rendition.URL, rr.Code, rr.Header().Get("Location"))
+	}
+}
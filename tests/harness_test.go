@@ -0,0 +1,154 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	imageprocessor "product-management/image-processor"
+	"product-management/models"
+	services "product-management/services"
+	"product-management/tests/harness"
+	"slices"
+	"testing"
+)
+
+func TestHarnessImagePipeline(t *testing.T) {
+	h := harness.New(t)
+	ownerID := h.CreateUser("owner", models.RoleUser)
+	adminID := h.CreateUser("admin", models.RoleAdmin)
+
+	var product services.Product
+	body := `{"product_name":"Lamp","product_price":40,"product_images":["http://example.com/ok.jpg","http://example.com/broken.jpg"]}`
+	h.DoJSON("POST", "/products", body, ownerID, http.StatusCreated, &product)
+	if jobs := h.Queue.Jobs(); len(jobs) != 2 {
+		t.Fatalf("Expected 2 queued jobs, but got %+v", jobs)
+	}
+
+	// Stand in for the image worker: the first image compresses, the second always fails
+	handle := func(ctx context.Context, job imageprocessor.ImageJob) error {
+		if job.ImageIndex == 1 {
+			return errors.New("decode failed")
+		}
+		if err := h.Products.SetImageRenditions(ctx, job.ProductID, job.ImageIndex, job.SourceURL, "/compressed/ok.jpg", nil); err != nil {
+			return err
+		}
+		return services.RecordJobStatus(ctx, h.Products, job, services.ImageStatusDone, nil)
+	}
+	onFailure := func(ctx context.Context, job imageprocessor.ImageJob, err error, deadLettered bool) {
+		status := services.ImageStatusPending
+		if deadLettered {
+			status = services.ImageStatusFailed
+		}
+		if err := services.RecordJobStatus(ctx, h.Products, job, status, err); err != nil {
+			t.Errorf("Error recording status: %v", err)
+		}
+	}
+	if delivered := h.Queue.Drain(handle, onFailure); delivered != 1+imageprocessor.MaxAttempts {
+		t.Errorf("Expected %d deliveries, but got %d", 1+imageprocessor.MaxAttempts, delivered)
+	}
+
+	var status services.ProductImageStatus
+	h.DoJSON("GET", fmt.Sprintf("/products/%d/images/status", product.ID), "", ownerID, http.StatusOK, &status)
+	if status.Status != services.ImageStatusFailed || len(status.Images) != 2 {
+		t.Fatalf("Unexpected image status: %+v", status)
+	}
+	if broken := status.Images[1]; broken.Attempts != imageprocessor.MaxAttempts || broken.LastError != "decode failed" {
+		t.Errorf("Unexpected status for the failing image: %+v", broken)
+	}
+
+	var letters []imageprocessor.DeadLetter
+	h.DoJSON("GET", "/admin/image-jobs/dead-letters", "", adminID, http.StatusOK, &letters)
+	if len(letters) != 1 || letters[0].Job == nil || letters[0].Job.ImageIndex != 1 {
+		t.Fatalf("Unexpected dead letters: %+v", letters)
+	}
+
+	var replay struct {
+		Replayed int `json:"replayed"`
+		Skipped  int `json:"skipped"`
+	}
+	h.DoJSON("POST", "/admin/image-jobs/dead-letters/replay", "", adminID, http.StatusOK, &replay)
+	if replay.Replayed != 1 || replay.Skipped != 0 {
+		t.Errorf("Unexpected replay result: %+v", replay)
+	}
+	if jobs := h.Queue.Jobs(); len(jobs) != 1 || jobs[0].Attempt != 1 {
+		t.Errorf("Expected the replayed job back on the queue with a fresh budget, but got %+v", jobs)
+	}
+	h.DoJSON("GET", fmt.Sprintf("/products/%d/images/status", product.ID), "", ownerID, http.StatusOK, &status)
+	if status.Images[1].Status != services.ImageStatusPending {
+		t.Errorf("Expected the replayed image to be pending, but got %+v", status.Images[1])
+	}
+}
+
+func TestHarnessCachesProducts(t *testing.T) {
+	h := harness.New(t)
+	ownerID := h.CreateUser("owner", models.RoleUser)
+
+	var product services.Product
+	h.DoJSON("POST", "/products", `{"product_name":"Chair","product_price":80}`, ownerID, http.StatusCreated, &product)
+	key := fmt.Sprintf("product:%d", product.ID)
+	path := fmt.Sprintf("/products/%d", product.ID)
+
+	h.DoJSON("GET", path, "", 0, http.StatusOK, nil)
+	if !h.Redis.Exists(key) {
+		t.Fatalf("Expected %s to be cached after a read", key)
+	}
+
+	h.DoJSON("PATCH", path, `{"product_price":75}`, ownerID, http.StatusOK, nil)
+	if h.Redis.Exists(key) {
+		t.Errorf("Expected %s to be invalidated after an update", key)
+	}
+
+	var fetched services.Product
+	h.DoJSON("GET", path, "", 0, http.StatusOK, &fetched)
+	if fetched.ProductPrice != 75 {
+		t.Errorf("Expected the updated price, but got %+v", fetched)
+	}
+}
+
+func TestHarnessPermanentFailureSkipsRetries(t *testing.T) {
+	h := harness.New(t)
+	ownerID := h.CreateUser("owner", models.RoleUser)
+	h.DoJSON("POST", "/products", `{"product_name":"Lamp","product_price":40,"product_images":["http://example.com/gone.jpg"]}`, ownerID, http.StatusCreated, nil)
+
+	handle := func(ctx context.Context, job imageprocessor.ImageJob) error {
+		return imageprocessor.Permanent(errors.New("status code 404"))
+	}
+	var deadLettered bool
+	onFailure := func(ctx context.Context, job imageprocessor.ImageJob, err error, dead bool) {
+		deadLettered = dead
+	}
+	if delivered := h.Queue.Drain(handle, onFailure); delivered != 1 {
+		t.Errorf("Expected a single delivery, but got %d", delivered)
+	}
+	if !deadLettered {
+		t.Errorf("Expected the job to be dead-lettered on its first failure")
+	}
+	letters, _ := h.Queue.ListDeadLetters(10)
+	if len(letters) != 1 || letters[0].LastError != "status code 404" {
+		t.Errorf("Unexpected dead letters: %+v", letters)
+	}
+}
+
+func TestHarnessLegacyJobRetriesWithBackoff(t *testing.T) {
+	h := harness.New(t)
+	if err := h.Queue.PublishLegacy(context.Background(), "http://example.com/a.jpg"); err != nil {
+		t.Fatalf("Error publishing legacy job: %v", err)
+	}
+
+	var attempts []int
+	handle := func(ctx context.Context, job imageprocessor.ImageJob) error {
+		attempts = append(attempts, job.Attempt)
+		return errors.New("status code 503")
+	}
+	if delivered := h.Queue.Drain(handle, nil); delivered != imageprocessor.MaxAttempts {
+		t.Errorf("Expected %d deliveries, but got %d", imageprocessor.MaxAttempts, delivered)
+	}
+	if !slices.Equal(attempts, []int{1, 2, 3, 4}) {
+		t.Errorf("Expected each retry to count as an attempt, but got %v", attempts)
+	}
+	letters, _ := h.Queue.ListDeadLetters(10)
+	if len(letters) != 1 || letters[0].ContentType != "text/plain" || letters[0].Job == nil || !letters[0].Job.IsLegacy() {
+		t.Errorf("Expected the legacy job to be dead-lettered as it was, but got %+v", letters)
+	}
+}
@@ -0,0 +1,126 @@
+package tests
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"product-management/api"
+	"product-management/health"
+	imageprocessor "product-management/image-processor"
+	services "product-management/services"
+	"product-management/tests/harness"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+// readiness is the body of /readyz
+type readiness struct {
+	Status  string   `json:"status"`
+	Ready   bool     `json:"ready"`
+	Failing []string `json:"failing"`
+}
+
+func TestHealthz(t *testing.T) {
+	h := harness.New(t)
+	h.Redis.Close()
+
+	var body map[string]string
+	h.DoJSON("GET", "/healthz", "", 0, http.StatusOK, &body)
+	if body["status"] != health.StatusOK {
+		t.Errorf("Expected liveness to ignore dependencies, but got %v", body)
+	}
+}
+
+func TestReadyzReportsFailingDependencies(t *testing.T) {
+	h := harness.New(t)
+
+	var ready readiness
+	h.DoJSON("GET", "/readyz", "", 0, http.StatusOK, &ready)
+	if ready.Status != health.StatusOK || !ready.Ready || len(ready.Failing) != 0 {
+		t.Fatalf("Unexpected readiness: %+v", ready)
+	}
+
+	h.Redis.Close()
+	h.DoJSON("GET", "/readyz", "", 0, http.StatusServiceUnavailable, &ready)
+	if ready.Status != health.StatusUnavailable || !reflect.DeepEqual(ready.Failing, []string{"redis"}) {
+		t.Errorf("Expected redis to be reported as failing, but got %+v", ready)
+	}
+
+	if err := h.Redis.Restart(); err != nil {
+		t.Fatalf("Error restarting Redis: %v", err)
+	}
+	h.DoJSON("GET", "/readyz", "", 0, http.StatusOK, &ready)
+
+	var report health.Report
+	h.DoJSON("GET", "/status", "", 0, http.StatusOK, &report)
+	if report.Status != health.StatusOK || len(report.Dependencies) != 2 {
+		t.Fatalf("Unexpected status report: %+v", report)
+	}
+	redis := report.Dependencies[0]
+	if redis.Name != "redis" || !redis.Healthy || redis.Error != "" || redis.LastError == "" || redis.LastErrorAt == nil {
+		t.Errorf("Expected redis to be healthy again and keep its last error, but got %+v", redis)
+	}
+	if redis.Stats == nil {
+		t.Errorf("Expected redis pool stats")
+	}
+}
+
+func TestReadyzFailsWhileDraining(t *testing.T) {
+	h := harness.New(t)
+	h.SetReady(false)
+
+	var ready readiness
+	h.DoJSON("GET", "/readyz", "", 0, http.StatusServiceUnavailable, &ready)
+	if ready.Ready || len(ready.Failing) != 0 {
+		t.Errorf("Expected only the readiness flag to fail, but got %+v", ready)
+	}
+}
+
+func TestStatusReportsPostgresPool(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.MonitorPingsOption(true))
+	if err != nil {
+		t.Fatalf("Error creating sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	router := api.NewRouter(api.Dependencies{
+		Products:           services.NewPostgresProductRepository(db),
+		Users:              services.NewPostgresUserRepository(db),
+		Queue:              imageprocessor.NewMemoryQueue(),
+		Tokens:             testTokens,
+		DB:                 db,
+		HealthCheckTimeout: time.Second,
+	})
+	mock.ExpectPing().WillReturnError(errors.New("connection refused"))
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("GET", "/status", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status %v, but got %v: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+	var report health.Report
+	if err := json.NewDecoder(rr.Body).Decode(&report); err != nil {
+		t.Fatalf("Error decoding response body: %v", err)
+	}
+	if report.Status != health.StatusUnavailable || len(report.Dependencies) != 2 {
+		t.Fatalf("Unexpected status report: %+v", report)
+	}
+	postgres := report.Dependencies[0]
+	if postgres.Name != "postgres" || postgres.Healthy || postgres.Error != "connection refused" {
+		t.Errorf("Expected postgres to be reported as failing, but got %+v", postgres)
+	}
+	stats, ok := postgres.Stats.(map[string]interface{})
+	if !ok || stats["open_connections"] == nil || stats["wait_count"] == nil {
+		t.Errorf("Expected postgres pool stats, but got %+v", postgres.Stats)
+	}
+	if rabbitmq := report.Dependencies[1]; rabbitmq.Name != "rabbitmq" || !rabbitmq.Healthy {
+		t.Errorf("Expected the queue to be healthy, but got %+v", rabbitmq)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unmet database expectations: %v", err)
+	}
+}
@@ -0,0 +1,84 @@
+package tests
+
+import (
+	"errors"
+	imageprocessor "product-management/image-processor"
+	"strings"
+	"testing"
+)
+
+func TestImageJobRoundTrip(t *testing.T) {
+	job := imageprocessor.NewImageJob(4, 2, "https://example.com/image.png")
+	if job.CorrelationID == "" {
+		t.Fatalf("Expected a correlation ID to be generated")
+	}
+
+	body, contentType, err := imageprocessor.EncodeImageJob(job)
+	if err != nil {
+		t.Fatalf("Error encoding job: %v", err)
+	}
+
+	parsed, err := imageprocessor.ParseImageJob(contentType, body)
+	if err != nil {
+		t.Fatalf("Error parsing job: %v", err)
+	}
+	if parsed.ProductID != 4 || parsed.ImageIndex != 2 || parsed.SourceURL != job.SourceURL || parsed.CorrelationID != job.CorrelationID {
+		t.Errorf("Parsed job %+v does not match %+v", parsed, job)
+	}
+	if parsed.IsLegacy() {
+		t.Errorf("Expected a versioned job")
+	}
+}
+
+func TestParseLegacyImageMessage(t *testing.T) {
+	job, err := imageprocessor.ParseImageJob("text/plain", []byte("http://example.com/image.jpg"))
+	if err != nil {
+		t.Fatalf("Error parsing legacy message: %v", err)
+	}
+	if !job.IsLegacy() || job.SourceURL != "http://example.com/image.jpg" {
+		t.Errorf("Expected a legacy job for the URL, got %+v", job)
+	}
+}
+
+func TestParseImageJobErrors(t *testing.T) {
+	valid := `{"version": 1, "product_id": 1, "image_index": 0, "source_url": "https://example.com/a.jpg", "attempt": 1, "renditions": ["compressed"], "correlation_id": "abc"}`
+	contentType := "application/vnd.product-management.image-job+json; version=1"
+
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		unsupported bool
+	}{
+		{name: "malformed json", contentType: contentType, body: `{"version": `},
+		{name: "missing product", contentType: contentType, body: `{"version": 1, "source_url": "https://example.com/a.jpg", "attempt": 1, "renditions": ["compressed"], "correlation_id": "abc"}`},
+		{name: "negative index", contentType: contentType, body: `{"version": 1, "product_id": 1, "image_index": -1, "source_url": "https://example.com/a.jpg", "attempt": 1, "renditions": ["compressed"], "correlation_id": "abc"}`},
+		{name: "relative url", contentType: contentType, body: `{"version": 1, "product_id": 1, "source_url": "/a.jpg", "attempt": 1, "renditions": ["compressed"], "correlation_id": "abc"}`},
+		{name: "missing correlation id", contentType: contentType, body: `{"version": 1, "product_id": 1, "source_url": "https://example.com/a.jpg", "attempt": 1, "renditions": ["compressed"]}`},
+		{name: "legacy non-url", contentType: "text/plain", body: "not a url"},
+		{name: "newer version", contentType: contentType, body: `{"version": 2, "product_id": 1, "source_url": "https://example.com/a.jpg", "attempt": 1, "renditions": ["compressed"], "correlation_id": "abc"}`, unsupported: true},
+		{name: "empty rendition", contentType: contentType, body: `{"version": 1, "product_id": 1, "source_url": "https://example.com/a.jpg", "attempt": 1, "renditions": [""], "correlation_id": "abc"}`},
+		{name: "unknown content type", contentType: "application/xml", body: valid, unsupported: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := imageprocessor.ParseImageJob(tt.contentType, []byte(tt.body))
+			if err == nil {
+				t.Fatalf("Expected an error")
+			}
+			if errors.Is(err, imageprocessor.ErrUnsupportedJob) != tt.unsupported {
+				t.Errorf("Expected unsupported=%t, got error %v", tt.unsupported, err)
+			}
+		})
+	}
+
+	if _, err := imageprocessor.ParseImageJob(contentType, []byte(valid)); err != nil {
+		t.Errorf("Expected the valid job to parse, got %v", err)
+	}
+	// Uploaded images are linked with the store's own scheme
+	uploaded := strings.Replace(valid, "https://example.com/a.jpg", "file:///var/images/uploads/1/a.png", 1)
+	if _, err := imageprocessor.ParseImageJob(contentType, []byte(uploaded)); err != nil {
+		t.Errorf("Expected a job for an uploaded image to parse, got %v", err)
+	}
+}
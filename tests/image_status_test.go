@@ -0,0 +1,117 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	imageprocessor "product-management/image-processor"
+	services "product-management/services"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestRetryDelayBacksOffExponentially(t *testing.T) {
+	expected := map[int]time.Duration{
+		1: 0,
+		2: imageprocessor.RetryBaseDelay,
+		3: 2 * imageprocessor.RetryBaseDelay,
+		4: 4 * imageprocessor.RetryBaseDelay,
+	}
+	for attempt, delay := range expected {
+		if got := imageprocessor.RetryDelay(attempt); got != delay {
+			t.Errorf("RetryDelay(%d) = %v, expected %v", attempt, got, delay)
+		}
+	}
+}
+
+func TestSummarizeImageStatus(t *testing.T) {
+	tests := []struct {
+		name     string
+		statuses []string
+		expected string
+	}{
+		{name: "no images", statuses: nil, expected: services.ImageStatusDone},
+		{name: "all done", statuses: []string{"done", "done"}, expected: services.ImageStatusDone},
+		{name: "some pending", statuses: []string{"done", "pending"}, expected: services.ImageStatusPending},
+		{name: "processing wins over pending", statuses: []string{"pending", "processing"}, expected: services.ImageStatusProcessing},
+		{name: "failed wins", statuses: []string{"processing", "failed", "done"}, expected: services.ImageStatusFailed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var images []services.ImageStatus
+			for _, status := range tt.statuses {
+				images = append(images, services.ImageStatus{Status: status})
+			}
+			if got := services.SummarizeImageStatus(images); got != tt.expected {
+				t.Errorf("Expected %v, but got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestGetImageStatus(t *testing.T) {
+	router, mock := newMockRouter(t)
+
+	expectCaller(mock, 1, "user")
+	expectProduct(mock, 1, 1)
+	mock.ExpectQuery("SELECT (.+) FROM product_image_jobs WHERE product_id = \\$1").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"image_index", "source_url", "status", "attempts", "last_error", "correlation_id", "updated_at"}).
+			AddRow(0, "http://example.com/a.jpg", "done", 1, "", "abc", time.Now()).
+			AddRow(1, "http://example.com/b.jpg", "failed", 4, "failed to download image: status code 404", "def", time.Now()))
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, authorizedRequest(t, "GET", "/products/1/images/status", "", 1))
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status %v, but got %v: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+
+	var status services.ProductImageStatus
+	if err := json.NewDecoder(rr.Body).Decode(&status); err != nil {
+		t.Fatalf("Error decoding response body: %v", err)
+	}
+	if status.Status != services.ImageStatusFailed || len(status.Images) != 2 || status.Images[1].LastError == "" {
+		t.Errorf("Unexpected image status: %+v", status)
+	}
+}
+
+func TestDeadLetterEndpointsRequireAdmin(t *testing.T) {
+
+	tests := []struct {
+		method string
+		path   string
+	}{
+		{method: "GET", path: "/admin/image-jobs/dead-letters"},
+		{method: "POST", path: "/admin/image-jobs/dead-letters/replay"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			router, mock := newMockRouter(t)
+			expectCaller(mock, 2, "user")
+
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, authorizedRequest(t, tt.method, tt.path, "", 2))
+
+			if rr.Code != http.StatusForbidden {
+				t.Errorf("Expected status %v, but got %v", http.StatusForbidden, rr.Code)
+			}
+		})
+	}
+}
+
+func TestDeadLetterLimitValidation(t *testing.T) {
+	router, mock := newMockRouter(t)
+	expectCaller(mock, 2, "admin")
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, authorizedRequest(t, "GET", "/admin/image-jobs/dead-letters?limit=0", "", 2))
+
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %v, but got %v", http.StatusBadRequest, rr.Code)
+	}
+}
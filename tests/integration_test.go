@@ -5,9 +5,9 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
-	"net/http/httptest"
-	"product-management/api/handlers"
 	"product-management/models"
+	services "product-management/services"
+	"product-management/tests/harness"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -18,7 +18,6 @@ func TestIntegration(t *testing.T) {
 
 	// Step 1: Create a product
 	product := models.Product{
-		UserID:             1,
 		ProductName:        "Test Product",
 		ProductDescription: "This is a test product for integration testing.",
 		ProductImages:      []string{"http://example.com/image.jpg"},
@@ -31,21 +30,28 @@ func TestIntegration(t *testing.T) {
 		t.Fatalf("Error marshalling product: %v", err)
 	}
 
+	// Boot the full API and sign in as the product owner
+	h := harness.New(t)
+	ownerID := h.CreateUser("owner", models.RoleUser)
+	server := h.Server()
+
 	// Create a new HTTP request for POST /products
-	req := httptest.NewRequest("POST", "/products", bytes.NewReader(productJSON))
+	req, err := http.NewRequest("POST", server.URL+"/products", bytes.NewReader(productJSON))
+	if err != nil {
+		t.Fatalf("Error building request: %v", err)
+	}
 	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+h.Token(ownerID))
 
-	// Create a new ResponseRecorder to capture the response
-	rr := httptest.NewRecorder()
-
-	// Create the mock handler for the CreateProduct function
-	handler := http.HandlerFunc(handlers.CreateProduct)
-
-	// Serve the request
-	handler.ServeHTTP(rr, req)
+	// Send the request over HTTP
+	rr, err := server.Client().Do(req)
+	if err != nil {
+		t.Fatalf("Error creating product: %v", err)
+	}
+	defer rr.Body.Close()
 
 	// Step 2: Validate that the product was created successfully
-	assert.Equal(t, http.StatusCreated, rr.Code, "Expected status %v, but got %v", http.StatusCreated, rr.Code)
+	assert.Equal(t, http.StatusCreated, rr.StatusCode, "Expected status %v, but got %v", http.StatusCreated, rr.StatusCode)
 
 	var createdProduct models.Product
 	err = json.NewDecoder(rr.Body).Decode(&createdProduct)
@@ -56,17 +62,17 @@ func TestIntegration(t *testing.T) {
 	// Make sure the product data returned is correct
 	assert.Equal(t, product.ProductName, createdProduct.ProductName)
 	assert.Equal(t, product.ProductDescription, createdProduct.ProductDescription)
+	assert.Equal(t, ownerID, createdProduct.UserID)
 
 	// Step 3: Now test getting the created product using its ID
-	getReq := httptest.NewRequest("GET", fmt.Sprintf("/products/%d", createdProduct.ID), nil)
-	getRR := httptest.NewRecorder()
-
-	// Handler for GetProduct
-	getHandler := http.HandlerFunc(handlers.GetProduct)
-	getHandler.ServeHTTP(getRR, getReq)
+	getRR, err := server.Client().Get(fmt.Sprintf("%s/products/%d", server.URL, createdProduct.ID))
+	if err != nil {
+		t.Fatalf("Error fetching product: %v", err)
+	}
+	defer getRR.Body.Close()
 
 	// Validate the GetProduct response
-	assert.Equal(t, http.StatusOK, getRR.Code, "Expected status %v, but got %v", http.StatusOK, getRR.Code)
+	assert.Equal(t, http.StatusOK, getRR.StatusCode, "Expected status %v, but got %v", http.StatusOK, getRR.StatusCode)
 
 	var fetchedProduct models.Product
 	err = json.NewDecoder(getRR.Body).Decode(&fetchedProduct)
@@ -79,23 +85,22 @@ func TestIntegration(t *testing.T) {
 	assert.Equal(t, createdProduct.ProductDescription, fetchedProduct.ProductDescription)
 
 	// Step 4: Test fetching all products to make sure the newly created product is included
-	allProductsReq := httptest.NewRequest("GET", "/products", nil)
-	allProductsRR := httptest.NewRecorder()
-
-	// Handler for GetAllProducts
-	allProductsHandler := http.HandlerFunc(handlers.GetAllProducts)
-	allProductsHandler.ServeHTTP(allProductsRR, allProductsReq)
+	allProductsRR, err := server.Client().Get(server.URL + "/products")
+	if err != nil {
+		t.Fatalf("Error listing products: %v", err)
+	}
+	defer allProductsRR.Body.Close()
 
 	// Validate the GetAllProducts response
-	assert.Equal(t, http.StatusOK, allProductsRR.Code, "Expected status %v, but got %v", http.StatusOK, allProductsRR.Code)
+	assert.Equal(t, http.StatusOK, allProductsRR.StatusCode, "Expected status %v, but got %v", http.StatusOK, allProductsRR.StatusCode)
 
-	var allProducts []models.Product
+	var allProducts services.ProductPage
 	err = json.NewDecoder(allProductsRR.Body).Decode(&allProducts)
 	if err != nil {
 		t.Fatalf("Error decoding response body: %v", err)
 	}
 
 	// Check that the created product is included in the list of all products
-	assert.Len(t, allProducts, 1, "Expected 1 product, but got %v", len(allProducts))
-	assert.Equal(t, createdProduct.ProductName, allProducts[0].ProductName)
+	assert.Len(t, allProducts.Data, 1, "Expected 1 product, but got %v", len(allProducts.Data))
+	assert.Equal(t, createdProduct.ProductName, allProducts.Data[0].ProductName)
 }
@@ -0,0 +1,209 @@
+package tests
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"product-management/config"
+	"product-management/logging"
+	"product-management/models"
+	services "product-management/services"
+	"product-management/tests/harness"
+	"strings"
+	"testing"
+	"time"
+)
+
+// captureLogs sends the default logger's JSON records to the returned buffer until t finishes
+func captureLogs(t *testing.T) *bytes.Buffer {
+	var buf bytes.Buffer
+	previous := slog.Default()
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})))
+	t.Cleanup(func() { slog.SetDefault(previous) })
+	return &buf
+}
+
+// logRecords decodes every JSON record in buf
+func logRecords(t *testing.T, buf *bytes.Buffer) []map[string]interface{} {
+	var records []map[string]interface{}
+	scanner := bufio.NewScanner(buf)
+	for scanner.Scan() {
+		var record map[string]interface{}
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			t.Fatalf("Error decoding log record %q: %v", scanner.Text(), err)
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+func TestLoadRepositoryLoggingConfig(t *testing.T) {
+	cfg, err := logging.LoadConfig(filepath.Join("..", "logs", "logs.json"))
+	if err != nil {
+		t.Fatalf("Error loading logs.json: %v", err)
+	}
+	if cfg.Level != "info" || cfg.Format != "json" || len(cfg.Outputs) != 2 {
+		t.Fatalf("Unexpected logging config: %+v", cfg)
+	}
+	file := cfg.Outputs[0]
+	if file.Type != "file" || file.Filename != "logs/app.log" || file.MaxSize != 10 || file.MaxBackups != 3 || file.MaxAge != 30 {
+		t.Errorf("Unexpected file output: %+v", file)
+	}
+}
+
+func TestLoggingConfigErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		contents string
+		expected string
+	}{
+		{name: "unknown key", contents: `{"log_levle": "info"}`, expected: "unknown field"},
+		{name: "bad level", contents: `{"log_level": "loud", "log_output": [{"type": "console"}]}`, expected: "log_level must be"},
+		{name: "bad format", contents: `{"log_level": "info", "log_format": "xml", "log_output": [{"type": "console"}]}`, expected: "log_format must be json or text"},
+		{name: "no outputs", contents: `{"log_level": "info"}`, expected: "at least one output"},
+		{name: "file without name", contents: `{"log_level": "info", "log_output": [{"type": "file"}]}`, expected: "need a filename"},
+		{name: "unknown output", contents: `{"log_level": "info", "log_output": [{"type": "syslog"}]}`, expected: "type must be console or file"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := logging.Setup(config.LogConfig{Config: writeFile(t, "logs.json", tt.contents)})
+			if err == nil || !strings.Contains(err.Error(), tt.expected) {
+				t.Errorf("Expected an error containing %q, but got %v", tt.expected, err)
+			}
+		})
+	}
+}
+
+func TestLoggerWritesJSONToFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	logger, files, err := logging.New(logging.Config{
+		Level:   "warn",
+		Format:  "json",
+		Outputs: []logging.Output{{Type: "file", Filename: path}},
+	})
+	if err != nil {
+		t.Fatalf("Error building logger: %v", err)
+	}
+	logger.Info("dropped")
+	logger.Warn("kept", "product_id", 7)
+	if err := files.Close(); err != nil {
+		t.Fatalf("Error closing log files: %v", err)
+	}
+
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Error reading log file: %v", err)
+	}
+	records := logRecords(t, bytes.NewBuffer(contents))
+	if len(records) != 1 || records[0]["msg"] != "kept" || records[0]["level"] != "WARN" || records[0]["product_id"] != float64(7) {
+		t.Errorf("Expected only the warning, but got %v", records)
+	}
+}
+
+func TestRotatingFileHonoursSizeAndBackups(t *testing.T) {
+	dir := t.TempDir()
+	file := &logging.RotatingFile{Filename: filepath.Join(dir, "app.log"), MaxSize: 100, MaxBackups: 2}
+	defer file.Close()
+
+	line := strings.Repeat("x", 39) + "\n"
+	for i := 0; i < 10; i++ {
+		if _, err := file.Write([]byte(line)); err != nil {
+			t.Fatalf("Error writing: %v", err)
+		}
+	}
+
+	backups, err := file.Backups()
+	if err != nil {
+		t.Fatalf("Error listing backups: %v", err)
+	}
+	if len(backups) != 2 {
+		t.Fatalf("Expected 2 backups, but got %v", backups)
+	}
+	for _, name := range append(backups, file.Filename) {
+		info, err := os.Stat(name)
+		if err != nil {
+			t.Fatalf("Error reading %s: %v", name, err)
+		}
+		if info.Size() > 100 {
+			t.Errorf("Expected %s to stay within 100 bytes, but it has %d", name, info.Size())
+		}
+	}
+}
+
+func TestRotatingFileRemovesOldBackups(t *testing.T) {
+	dir := t.TempDir()
+	file := &logging.RotatingFile{Filename: filepath.Join(dir, "app.log"), MaxSize: 10, MaxAge: 24 * time.Hour}
+	defer file.Close()
+
+	stale := filepath.Join(dir, "app-2020-01-01T00-00-00.000000000.log")
+	if err := os.WriteFile(stale, []byte("old\n"), 0o644); err != nil {
+		t.Fatalf("Error writing stale backup: %v", err)
+	}
+	old := time.Now().Add(-48 * time.Hour)
+	if err := os.Chtimes(stale, old, old); err != nil {
+		t.Fatalf("Error ageing stale backup: %v", err)
+	}
+	unrelated := filepath.Join(dir, "app-notes.log")
+	if err := os.WriteFile(unrelated, nil, 0o644); err != nil {
+		t.Fatalf("Error writing unrelated file: %v", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, err := file.Write([]byte("0123456789")); err != nil {
+			t.Fatalf("Error writing: %v", err)
+		}
+	}
+
+	if _, err := os.Stat(stale); !os.IsNotExist(err) {
+		t.Errorf("Expected the stale backup to be removed, but got %v", err)
+	}
+	if _, err := os.Stat(unrelated); err != nil {
+		t.Errorf("Expected files that are not backups to be kept, but got %v", err)
+	}
+	backups, err := file.Backups()
+	if err != nil || len(backups) != 1 {
+		t.Errorf("Expected the fresh backup to be kept, but got %v (err %v)", backups, err)
+	}
+}
+
+func TestRequestLoggerCarriesRequestID(t *testing.T) {
+	logs := captureLogs(t)
+	h := harness.New(t)
+	ownerID := h.CreateUser("owner", models.RoleUser)
+	product := services.Product{UserID: ownerID, ProductName: "Desk", ProductPrice: 120}
+	if err := h.Products.Create(context.Background(), &product); err != nil {
+		t.Fatalf("Error creating product: %v", err)
+	}
+
+	// Cache failures are logged by the cache with the request's logger
+	h.Redis.Close()
+	req := httptest.NewRequest("GET", fmt.Sprintf("/products/%d", product.ID), nil)
+	req.Header.Set("Authorization", "Bearer "+h.Token(ownerID))
+	req.Header.Set("X-Request-ID", "req-123")
+	rr := httptest.NewRecorder()
+	h.Router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status %v, but got %v: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+
+	messages := map[string]bool{}
+	for _, record := range logRecords(t, logs) {
+		if record["request_id"] != "req-123" {
+			t.Errorf("Expected every record to carry the request ID, but got %v", record)
+		}
+		messages[record["msg"].(string)] = true
+	}
+	for _, msg := range []string{"Started request", "Redis read failed", "Completed request"} {
+		if !messages[msg] {
+			t.Errorf("Expected a %q record, but got %v", msg, messages)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	imageprocessor "product-management/image-processor"
+	"product-management/metrics"
+	"product-management/models"
+	services "product-management/services"
+	"product-management/storage"
+	"product-management/tests/harness"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// sampleCount returns how many observations the histogram with labels has recorded
+func sampleCount(t *testing.T, vec *prometheus.HistogramVec, labels ...string) uint64 {
+	var m dto.Metric
+	if err := vec.WithLabelValues(labels...).(prometheus.Metric).Write(&m); err != nil {
+		t.Fatalf("Error reading histogram: %v", err)
+	}
+	return m.GetHistogram().GetSampleCount()
+}
+
+// scrapeMetrics returns the /metrics page served by h
+func scrapeMetrics(t *testing.T, h *harness.Harness) string {
+	rr := h.Do("GET", "/metrics", "", 0)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status %v, but got %v", http.StatusOK, rr.Code)
+	}
+	return rr.Body.String()
+}
+
+func TestMetricsEndpointReportsRoutesAndCache(t *testing.T) {
+	h := harness.New(t)
+	ownerID := h.CreateUser("owner", models.RoleUser)
+	product := services.Product{UserID: ownerID, ProductName: "Desk", ProductPrice: 120}
+	if err := h.Products.Create(context.Background(), &product); err != nil {
+		t.Fatalf("Error creating product: %v", err)
+	}
+
+	hits := testutil.ToFloat64(metrics.CacheRequests.WithLabelValues(metrics.CacheHit))
+	misses := testutil.ToFloat64(metrics.CacheRequests.WithLabelValues(metrics.CacheMiss))
+	found := sampleCount(t, metrics.RequestDuration, "GET", "/products/{id}", "200")
+	missing := sampleCount(t, metrics.RequestDuration, "GET", "/products/{id}", "404")
+
+	path := fmt.Sprintf("/products/%d", product.ID)
+	h.DoJSON("GET", path, "", ownerID, http.StatusOK, nil)
+	h.DoJSON("GET", path, "", ownerID, http.StatusOK, nil)
+	h.Do("GET", "/products/999999", "", ownerID)
+
+	if got := testutil.ToFloat64(metrics.CacheRequests.WithLabelValues(metrics.CacheMiss)) - misses; got != 2 {
+		t.Errorf("Expected 2 cache misses, but got %v", got)
+	}
+	if got := testutil.ToFloat64(metrics.CacheRequests.WithLabelValues(metrics.CacheHit)) - hits; got != 1 {
+		t.Errorf("Expected 1 cache hit, but got %v", got)
+	}
+	if got := sampleCount(t, metrics.RequestDuration, "GET", "/products/{id}", "200") - found; got != 2 {
+		t.Errorf("Expected 2 observations for the route template, but got %v", got)
+	}
+	if got := sampleCount(t, metrics.RequestDuration, "GET", "/products/{id}", "404") - missing; got != 1 {
+		t.Errorf("Expected 1 observation of the 404, but got %v", got)
+	}
+
+	page := scrapeMetrics(t, h)
+	for _, series := range []string{
+		`http_request_duration_seconds_count{method="GET",route="/products/{id}",status="200"}`,
+		`product_cache_requests_total{result="hit"}`,
+		`go_goroutines`,
+	} {
+		if !strings.Contains(page, series) {
+			t.Errorf("Expected /metrics to contain %s", series)
+		}
+	}
+	if strings.Contains(page, fmt.Sprintf(`route="%s"`, path)) {
+		t.Errorf("Expected routes to be reported by template, not path")
+	}
+}
+
+func TestImageQueueAndWorkerMetrics(t *testing.T) {
+	h := harness.New(t)
+	ownerID := h.CreateUser("owner", models.RoleUser)
+
+	published := testutil.ToFloat64(metrics.JobsPublished.WithLabelValues(metrics.ResultSuccess))
+	succeeded := sampleCount(t, metrics.JobDuration, metrics.ResultSuccess)
+	failed := sampleCount(t, metrics.JobDuration, metrics.ResultFailure)
+
+	body := `{"product_name":"Lamp","product_price":40,"product_images":["http://example.com/ok.jpg","http://example.com/broken.jpg"]}`
+	h.DoJSON("POST", "/products", body, ownerID, http.StatusCreated, nil)
+	if got := testutil.ToFloat64(metrics.JobsPublished.WithLabelValues(metrics.ResultSuccess)) - published; got != 2 {
+		t.Errorf("Expected 2 published jobs, but got %v", got)
+	}
+
+	h.Queue.Drain(func(ctx context.Context, job imageprocessor.ImageJob) error {
+		if job.ImageIndex == 1 {
+			return errors.New("decode failed")
+		}
+		return nil
+	}, nil)
+
+	if got := sampleCount(t, metrics.JobDuration, metrics.ResultSuccess) - succeeded; got != 1 {
+		t.Errorf("Expected 1 successful job, but got %v", got)
+	}
+	if got := sampleCount(t, metrics.JobDuration, metrics.ResultFailure) - failed; got != imageprocessor.MaxAttempts {
+		t.Errorf("Expected %d failed attempts, but got %v", imageprocessor.MaxAttempts, got)
+	}
+}
+
+func TestProcessorStageMetrics(t *testing.T) {
+	source := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing.jpg" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(truncatedPNG(t))
+	}))
+	defer source.Close()
+
+	processor := imageprocessor.NewProcessor(storage.NewMemoryStore("", ""), localImageConfig())
+	downloadFailures := testutil.ToFloat64(metrics.StageFailures.WithLabelValues(metrics.StageDownload))
+	compressFailures := testutil.ToFloat64(metrics.StageFailures.WithLabelValues(metrics.StageCompress))
+	downloads := sampleCount(t, metrics.StageDuration, metrics.StageDownload)
+
+	if _, err := processor.ProcessImage(context.Background(), source.URL+"/missing.jpg"); err == nil {
+		t.Errorf("Expected the download to fail")
+	}
+	if _, err := processor.ProcessImage(context.Background(), source.URL+"/garbage.jpg"); err == nil {
+		t.Errorf("Expected the compression to fail")
+	}
+
+	if got := testutil.ToFloat64(metrics.StageFailures.WithLabelValues(metrics.StageDownload)) - downloadFailures; got != 1 {
+		t.Errorf("Expected 1 download failure, but got %v", got)
+	}
+	if got := testutil.ToFloat64(metrics.StageFailures.WithLabelValues(metrics.StageCompress)) - compressFailures; got != 1 {
+		t.Errorf("Expected 1 compress failure, but got %v", got)
+	}
+	if got := sampleCount(t, metrics.StageDuration, metrics.StageDownload) - downloads; got != 1 {
+		t.Errorf("Expected 1 timed download, but got %v", got)
+	}
+}
+
+func TestDatabasePoolMetrics(t *testing.T) {
+	db, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error creating sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	if err := metrics.RegisterDB("metrics_test", db); err != nil {
+		t.Fatalf("Error registering database metrics: %v", err)
+	}
+	page := scrapeMetrics(t, harness.New(t))
+	for _, series := range []string{`go_sql_open_connections{db_name="metrics_test"}`, `go_sql_wait_count_total{db_name="metrics_test"}`} {
+		if !strings.Contains(page, series) {
+			t.Errorf("Expected /metrics to contain %s", series)
+		}
+	}
+}
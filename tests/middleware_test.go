@@ -0,0 +1,192 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"product-management/metrics"
+	"product-management/models"
+	"product-management/tests/harness"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestRequestIDPropagation(t *testing.T) {
+	h := harness.New(t)
+
+	tests := []struct {
+		name     string
+		header   string
+		expected string
+	}{
+		{name: "reused", header: "client-id.42", expected: "client-id.42"},
+		{name: "generated when missing", header: ""},
+		{name: "replaced when malformed", header: "bad id\r\n"},
+		{name: "replaced when too long", header: strings.Repeat("a", 129)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/healthz", nil)
+			if tt.header != "" {
+				req.Header.Set("X-Request-ID", tt.header)
+			}
+			rr := httptest.NewRecorder()
+			h.Router.ServeHTTP(rr, req)
+
+			got := rr.Header().Get("X-Request-ID")
+			if tt.expected != "" && got != tt.expected {
+				t.Errorf("Expected request ID %q, but got %q", tt.expected, got)
+			}
+			if tt.expected == "" && (len(got) != 32 || got == tt.header) {
+				t.Errorf("Expected a generated request ID, but got %q", got)
+			}
+		})
+	}
+}
+
+func TestAccessLog(t *testing.T) {
+	logs := captureLogs(t)
+	h := harness.New(t)
+	ownerID := h.CreateUser("owner", models.RoleUser)
+
+	req := httptest.NewRequest("POST", "/products", strings.NewReader(`{"product_name":"Desk","product_price":120}`))
+	req.Header.Set("Authorization", "Bearer "+h.Token(ownerID))
+	req.Header.Set("X-Request-ID", "access-1")
+	rr := httptest.NewRecorder()
+	h.Router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected status %v, but got %v: %s", http.StatusCreated, rr.Code, rr.Body.String())
+	}
+
+	var access map[string]interface{}
+	for _, record := range logRecords(t, logs) {
+		if record["msg"] == "Completed request" {
+			access = record
+		}
+	}
+	if access == nil {
+		t.Fatalf("Expected an access log record")
+	}
+	expected := map[string]interface{}{
+		"request_id": "access-1",
+		"method":     "POST",
+		"path":       "/products",
+		"route":      "/products",
+		"status":     float64(http.StatusCreated),
+		"bytes":      float64(rr.Body.Len()),
+		"user_id":    float64(ownerID),
+		"level":      "INFO",
+	}
+	for key, value := range expected {
+		if access[key] != value {
+			t.Errorf("Expected %s to be %v, but got %v", key, value, access[key])
+		}
+	}
+	if _, ok := access["latency_ms"].(float64); !ok {
+		t.Errorf("Expected a latency, but got %v", access["latency_ms"])
+	}
+}
+
+func TestUnmatchedRequestsAreObserved(t *testing.T) {
+	logs := captureLogs(t)
+	h := harness.New(t)
+
+	tests := []struct {
+		method, path string
+		expected     int
+	}{
+		{method: "GET", path: "/no-such-route", expected: http.StatusNotFound},
+		{method: "DELETE", path: "/products", expected: http.StatusMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		observed := sampleCount(t, metrics.RequestDuration, tt.method, "unknown", strconv.Itoa(tt.expected))
+		requestID := "unmatched-" + strconv.Itoa(tt.expected)
+		req := httptest.NewRequest(tt.method, tt.path, nil)
+		req.Header.Set("X-Request-ID", requestID)
+		rr := httptest.NewRecorder()
+		h.Router.ServeHTTP(rr, req)
+
+		if rr.Code != tt.expected || rr.Header().Get("X-Request-ID") != requestID {
+			t.Errorf("%s %s: expected status %v with the request ID, but got %v and %q", tt.method, tt.path, tt.expected, rr.Code, rr.Header().Get("X-Request-ID"))
+		}
+		if got := sampleCount(t, metrics.RequestDuration, tt.method, "unknown", strconv.Itoa(tt.expected)) - observed; got != 1 {
+			t.Errorf("%s %s: expected 1 latency observation, but got %v", tt.method, tt.path, got)
+		}
+		logged := false
+		for _, record := range logRecords(t, logs) {
+			if record["msg"] == "Completed request" && record["request_id"] == requestID && record["status"] == float64(tt.expected) {
+				logged = true
+			}
+		}
+		if !logged {
+			t.Errorf("%s %s: expected an access log record", tt.method, tt.path)
+		}
+	}
+}
+
+func TestPanicRecovery(t *testing.T) {
+	logs := captureLogs(t)
+	h := harness.New(t)
+	h.Router.HandleFunc("/panic", func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	})
+
+	req := httptest.NewRequest("GET", "/panic", nil)
+	req.Header.Set("X-Request-ID", "panic-1")
+	rr := httptest.NewRecorder()
+	h.Router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusInternalServerError {
+		t.Fatalf("Expected status %v, but got %v", http.StatusInternalServerError, rr.Code)
+	}
+	var body map[string]string
+	if err := json.NewDecoder(rr.Body).Decode(&body); err != nil || body["error"] == "" {
+		t.Errorf("Expected a JSON error body, but got %v (err %v)", body, err)
+	}
+	if rr.Header().Get("Content-Type") != "application/json" || rr.Header().Get("X-Request-ID") != "panic-1" {
+		t.Errorf("Unexpected headers: %v", rr.Header())
+	}
+
+	var recovered, access map[string]interface{}
+	for _, record := range logRecords(t, logs) {
+		switch record["msg"] {
+		case "Recovered from panic":
+			recovered = record
+		case "Completed request":
+			access = record
+		}
+	}
+	if recovered == nil || recovered["panic"] != "boom" || recovered["request_id"] != "panic-1" || recovered["stack"] == "" {
+		t.Errorf("Expected the panic to be logged with its stack, but got %v", recovered)
+	}
+	if access == nil || access["status"] != float64(http.StatusInternalServerError) || access["level"] != "ERROR" {
+		t.Errorf("Expected the access log to record the 500, but got %v", access)
+	}
+}
+
+func TestRequestIDIsQueuedWithImageJobs(t *testing.T) {
+	h := harness.New(t)
+	ownerID := h.CreateUser("owner", models.RoleUser)
+
+	body := `{"product_name":"Lamp","product_price":40,"product_images":["http://example.com/a.jpg","http://example.com/b.jpg"]}`
+	req := httptest.NewRequest("POST", "/products", strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer "+h.Token(ownerID))
+	req.Header.Set("X-Request-ID", "create-lamp")
+	rr := httptest.NewRecorder()
+	h.Router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected status %v, but got %v: %s", http.StatusCreated, rr.Code, rr.Body.String())
+	}
+
+	jobs := h.Queue.Jobs()
+	if len(jobs) != 2 {
+		t.Fatalf("Expected 2 queued jobs, but got %+v", jobs)
+	}
+	for _, job := range jobs {
+		if job.RequestID != "create-lamp" {
+			t.Errorf("Expected job %s to carry the request ID, but got %q", job.CorrelationID, job.RequestID)
+		}
+	}
+}
@@ -0,0 +1,217 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"product-management/db"
+	"regexp"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+// testMigrations are two small migrations; the second one cannot be rolled back
+var testMigrations = []db.Migration{
+	{Version: 1, Name: "create_widgets", Up: "CREATE TABLE widgets (id INT)", Down: "DROP TABLE widgets"},
+	{Version: 2, Name: "add_widget_name", Up: "ALTER TABLE widgets ADD COLUMN name TEXT"},
+}
+
+// newMigrator returns a Migrator over testMigrations backed by sqlmock
+func newMigrator(t *testing.T) (*db.Migrator, sqlmock.Sqlmock) {
+	mockDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error creating sqlmock: %v", err)
+	}
+	t.Cleanup(func() { mockDB.Close() })
+	return db.NewMigrator(mockDB, testMigrations), mock
+}
+
+// expectMigrationLock expects the lock, schema_migrations setup and the read of applied versions
+func expectMigrationLock(mock sqlmock.Sqlmock, applied ...int) {
+	mock.ExpectExec(`SELECT pg_advisory_lock\(\$1\)`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`CREATE TABLE IF NOT EXISTS schema_migrations`).WillReturnResult(sqlmock.NewResult(0, 0))
+	rows := sqlmock.NewRows([]string{"version", "applied_at"})
+	for _, version := range applied {
+		rows.AddRow(version, time.Date(2024, 1, version, 0, 0, 0, 0, time.UTC))
+	}
+	mock.ExpectQuery(`SELECT version, applied_at FROM schema_migrations`).WillReturnRows(rows)
+}
+
+func expectMigrationUnlock(mock sqlmock.Sqlmock) {
+	mock.ExpectExec(`SELECT pg_advisory_unlock\(\$1\)`).WillReturnResult(sqlmock.NewResult(0, 0))
+}
+
+func expectApply(mock sqlmock.Sqlmock, migration db.Migration) {
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(migration.Up)).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`INSERT INTO schema_migrations`).WithArgs(migration.Version, migration.Name).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+}
+
+func expectRollBack(mock sqlmock.Sqlmock, migration db.Migration) {
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(migration.Down)).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`DELETE FROM schema_migrations WHERE version = \$1`).WithArgs(migration.Version).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+}
+
+func TestEmbeddedMigrations(t *testing.T) {
+	migrations, err := db.Migrations()
+	if err != nil {
+		t.Fatalf("Error loading embedded migrations: %v", err)
+	}
+	if len(migrations) == 0 {
+		t.Fatal("Expected embedded migrations")
+	}
+
+	for i, migration := range migrations {
+		if migration.Version != i+1 {
+			t.Errorf("Expected migration %d to have version %d, got %d", i, i+1, migration.Version)
+		}
+		if strings.TrimSpace(migration.Up) == "" || strings.TrimSpace(migration.Down) == "" {
+			t.Errorf("Migration %03d_%s should have both up and down SQL", migration.Version, migration.Name)
+		}
+	}
+}
+
+func TestLoadMigrationsErrors(t *testing.T) {
+	sql := &fstest.MapFile{Data: []byte("SELECT 1")}
+	tests := []struct {
+		name  string
+		files fstest.MapFS
+	}{
+		{name: "bad file name", files: fstest.MapFS{"create_users.sql": sql}},
+		{name: "missing up file", files: fstest.MapFS{"001_users.down.sql": sql}},
+		{name: "duplicate version", files: fstest.MapFS{"001_users.up.sql": sql, "001_products.up.sql": sql}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := db.LoadMigrations(tt.files); err == nil {
+				t.Error("Expected an error")
+			}
+		})
+	}
+
+	// Other files are ignored and versions sort numerically
+	migrations, err := db.LoadMigrations(fstest.MapFS{
+		"README.md":            {Data: []byte("notes")},
+		"010_later.up.sql":     sql,
+		"002_earlier.up.sql":   sql,
+		"002_earlier.down.sql": sql,
+	})
+	if err != nil {
+		t.Fatalf("Error loading migrations: %v", err)
+	}
+	if len(migrations) != 2 || migrations[0].Version != 2 || migrations[0].Down == "" || migrations[1].Version != 10 {
+		t.Errorf("Unexpected migrations: %+v", migrations)
+	}
+}
+
+func TestMigratorUpAppliesPending(t *testing.T) {
+	migrator, mock := newMigrator(t)
+	expectMigrationLock(mock, 1)
+	expectApply(mock, testMigrations[1])
+	expectMigrationUnlock(mock)
+
+	applied, err := migrator.Up(context.Background())
+	if err != nil {
+		t.Fatalf("Error applying migrations: %v", err)
+	}
+	if len(applied) != 1 || applied[0].Version != 2 {
+		t.Errorf("Expected only migration 2 to be applied, got %+v", applied)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unmet database expectations: %v", err)
+	}
+}
+
+func TestMigratorUpStopsAtFailure(t *testing.T) {
+	migrator, mock := newMigrator(t)
+	expectMigrationLock(mock)
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(testMigrations[0].Up)).WillReturnError(errors.New("syntax error"))
+	mock.ExpectRollback()
+	expectMigrationUnlock(mock)
+
+	applied, err := migrator.Up(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "001_create_widgets") {
+		t.Errorf("Expected the failing migration in the error, got %v", err)
+	}
+	if len(applied) != 0 {
+		t.Errorf("Expected nothing to be applied, got %+v", applied)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unmet database expectations: %v", err)
+	}
+}
+
+func TestMigratorDown(t *testing.T) {
+	migrator, mock := newMigrator(t)
+	expectMigrationLock(mock, 1)
+	expectRollBack(mock, testMigrations[0])
+	expectMigrationUnlock(mock)
+
+	rolledBack, err := migrator.Down(context.Background(), 5)
+	if err != nil {
+		t.Fatalf("Error rolling back migrations: %v", err)
+	}
+	if len(rolledBack) != 1 || rolledBack[0].Version != 1 {
+		t.Errorf("Expected migration 1 to be rolled back, got %+v", rolledBack)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unmet database expectations: %v", err)
+	}
+}
+
+func TestMigratorDownIrreversible(t *testing.T) {
+	migrator, mock := newMigrator(t)
+	expectMigrationLock(mock, 1, 2)
+	expectMigrationUnlock(mock)
+
+	if _, err := migrator.Down(context.Background(), 1); !errors.Is(err, db.ErrIrreversible) {
+		t.Errorf("Expected ErrIrreversible, got %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unmet database expectations: %v", err)
+	}
+}
+
+func TestMigratorRedo(t *testing.T) {
+	migrator, mock := newMigrator(t)
+	expectMigrationLock(mock, 1)
+	expectRollBack(mock, testMigrations[0])
+	expectApply(mock, testMigrations[0])
+	expectMigrationUnlock(mock)
+
+	redone, err := migrator.Redo(context.Background())
+	if err != nil {
+		t.Fatalf("Error redoing migration: %v", err)
+	}
+	if redone == nil || redone.Version != 1 {
+		t.Errorf("Expected migration 1 to be redone, got %+v", redone)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unmet database expectations: %v", err)
+	}
+}
+
+func TestMigratorStatus(t *testing.T) {
+	migrator, mock := newMigrator(t)
+	expectMigrationLock(mock, 1)
+	expectMigrationUnlock(mock)
+
+	statuses, err := migrator.Status(context.Background())
+	if err != nil {
+		t.Fatalf("Error reading migration status: %v", err)
+	}
+	if len(statuses) != 2 || !statuses[0].Applied || statuses[0].AppliedAt.IsZero() || statuses[1].Applied {
+		t.Errorf("Unexpected statuses: %+v", statuses)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unmet database expectations: %v", err)
+	}
+}
@@ -0,0 +1,144 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"product-management/api/handlers"
+	services "product-management/services"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+// getProductPage requests a product list and decodes the paged envelope
+func getProductPage(t *testing.T, router http.Handler, path string) services.ProductPage {
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("GET", path, nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status %v, but got %v: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+
+	var page services.ProductPage
+	if err := json.NewDecoder(rr.Body).Decode(&page); err != nil {
+		t.Fatalf("Error decoding response body: %v", err)
+	}
+	return page
+}
+
+func TestGetProductsPaginatesWithCursor(t *testing.T) {
+	router, mock := newMockRouter(t)
+	created := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	// First page: limit 2 fetches 3 rows to detect the next page
+	mock.ExpectQuery(`SELECT (.+) FROM products ORDER BY product_price DESC, id DESC LIMIT \$1`).
+		WithArgs(3).
+		WillReturnRows(productRows().
+			AddRow(5, 1, "Five", "", "{}", 50.0, "{}", "{}", created).
+			AddRow(3, 1, "Three", "", "{}", 30.0, "{}", "{}", created).
+			AddRow(4, 1, "Four", "", "{}", 30.0, "{}", "{}", created))
+
+	first := getProductPage(t, router, "/products?limit=2&sort=price&order=desc")
+	if len(first.Data) != 2 || !first.Paging.HasMore || first.Paging.NextCursor == "" {
+		t.Fatalf("Unexpected first page: %+v", first)
+	}
+
+	// Second page continues strictly after (30, 3)
+	mock.ExpectQuery(`SELECT (.+) FROM products WHERE \(product_price, id\) < \(\$1, \$2\) ORDER BY product_price DESC, id DESC LIMIT \$3`).
+		WithArgs(30.0, 3, 3).
+		WillReturnRows(productRows().AddRow(4, 1, "Four", "", "{}", 30.0, "{}", "{}", created))
+
+	second := getProductPage(t, router, "/products?limit=2&sort=price&order=desc&cursor="+first.Paging.NextCursor)
+	if len(second.Data) != 1 || second.Data[0].ID != 4 || second.Paging.HasMore || second.Paging.NextCursor != "" {
+		t.Errorf("Unexpected second page: %+v", second)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unmet database expectations: %v", err)
+	}
+}
+
+func TestGetProductsDefaults(t *testing.T) {
+	router, mock := newMockRouter(t)
+	mock.ExpectQuery(`ORDER BY id ASC LIMIT \$1`).
+		WithArgs(services.DefaultPageLimit + 1).
+		WillReturnRows(productRows())
+
+	page := getProductPage(t, router, "/products")
+	if page.Data == nil || len(page.Data) != 0 {
+		t.Errorf("Expected an empty data array, got %+v", page.Data)
+	}
+	if page.Paging.Limit != services.DefaultPageLimit || page.Paging.Sort != "id" || page.Paging.Order != "asc" {
+		t.Errorf("Unexpected paging metadata: %+v", page.Paging)
+	}
+}
+
+func TestLegacyGetAllProductsUsesPagedQuery(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error creating sqlmock: %v", err)
+	}
+	defer mockDB.Close()
+
+	mock.ExpectQuery(`ORDER BY product_name ASC, id ASC LIMIT \$1`).
+		WithArgs(6).
+		WillReturnRows(productRows())
+
+	handler := handlers.GetAllProducts(services.NewPostgresProductRepository(mockDB))
+	page := getProductPage(t, handler, "/products?limit=5&sort=name")
+	if page.Paging.Sort != "name" || page.Paging.Limit != 5 {
+		t.Errorf("Unexpected paging metadata: %+v", page.Paging)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unmet database expectations: %v", err)
+	}
+}
+
+func TestGetProductsPagingErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+	}{
+		{name: "limit too large", query: "limit=1000"},
+		{name: "limit not a number", query: "limit=ten"},
+		{name: "unknown sort", query: "sort=colour"},
+		{name: "unknown order", query: "order=sideways"},
+		{name: "garbage cursor", query: "cursor=not-base64!"},
+		{name: "cursor for another sort", query: "sort=name&cursor=eyJzb3J0IjoicHJpY2UiLCJvcmRlciI6ImFzYyIsInZhbHVlIjoxMCwiaWQiOjF9"},
+		{name: "cursor with wrong value type", query: "sort=price&cursor=eyJzb3J0IjoicHJpY2UiLCJvcmRlciI6ImFzYyIsInZhbHVlIjoidGVuIiwiaWQiOjF9"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router, _ := newMockRouter(t)
+
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, httptest.NewRequest("GET", "/products?"+tt.query, nil))
+
+			if rr.Code != http.StatusBadRequest {
+				t.Errorf("Expected status %v, but got %v: %s", http.StatusBadRequest, rr.Code, rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestPageCursorKeepsSortPosition(t *testing.T) {
+	// Cursors must round-trip through the API for every sort
+	for _, sort := range []string{"id", "price", "name", "created_at"} {
+		t.Run(sort, func(t *testing.T) {
+			router, mock := newMockRouter(t)
+			mock.ExpectQuery("SELECT (.+) FROM products").WillReturnRows(productRows().
+				AddRow(1, 1, "A", "", "{}", 1.0, "{}", "{}", time.Now()).
+				AddRow(2, 1, "B", "", "{}", 2.0, "{}", "{}", time.Now()))
+			first := getProductPage(t, router, "/products?limit=1&sort="+sort)
+
+			mock.ExpectQuery("SELECT (.+) FROM products").WillReturnRows(productRows())
+			getProductPage(t, router, "/products?limit=1&sort="+sort+"&cursor="+first.Paging.NextCursor)
+
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("Unmet database expectations: %v", err)
+			}
+		})
+	}
+}
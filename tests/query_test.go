@@ -0,0 +1,159 @@
+package tests
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	services "product-management/services"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+// productFilterCase is one filter together with the SQL it must add and how many arguments it binds
+type productFilterCase struct {
+	name      string
+	apply     func(f *services.ProductFilter)
+	condition string
+	args      int
+}
+
+func productFilterCases() []productFilterCase {
+	minPrice, maxPrice, hasImages := 10.0, 100.0, true
+	after := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	before := time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)
+
+	return []productFilterCase{
+		{name: "user_id", apply: func(f *services.ProductFilter) { f.UserID = 7 }, condition: "user_id = $", args: 1},
+		{name: "price_min", apply: func(f *services.ProductFilter) { f.MinPrice = &minPrice }, condition: "product_price >= $", args: 1},
+		{name: "price_max", apply: func(f *services.ProductFilter) { f.MaxPrice = &maxPrice }, condition: "product_price <= $", args: 1},
+		{name: "name", apply: func(f *services.ProductFilter) { f.NameContains = "50%_off" }, condition: "product_name ILIKE $", args: 1},
+		{name: "has_images", apply: func(f *services.ProductFilter) { f.HasImages = &hasImages }, condition: "coalesce(cardinality(product_images), 0) > 0", args: 0},
+		{name: "created_after", apply: func(f *services.ProductFilter) { f.CreatedAfter = &after }, condition: "created_at >= $", args: 1},
+		{name: "created_before", apply: func(f *services.ProductFilter) { f.CreatedBefore = &before }, condition: "created_at < $", args: 1},
+		{name: "ids", apply: func(f *services.ProductFilter) { f.IDs = []int{1, 2, 3} }, condition: "id = ANY($", args: 1},
+		{name: "q", apply: func(f *services.ProductFilter) { f.Search = "lamp:*" }, condition: "search_vector @@ to_tsquery('english', $", args: 1},
+	}
+}
+
+var placeholderPattern = regexp.MustCompile(`\$(\d+)`)
+
+func TestBuildProductQueryEveryFilterCombination(t *testing.T) {
+	cases := productFilterCases()
+	page, err := services.ParsePageRequest("", "", "", "")
+	if err != nil {
+		t.Fatalf("Error parsing page request: %v", err)
+	}
+
+	for mask := 0; mask < 1<<len(cases); mask++ {
+		var filter services.ProductFilter
+		var names []string
+		expectedArgs := 1 // LIMIT
+		for i, c := range cases {
+			if mask&(1<<i) != 0 {
+				c.apply(&filter)
+				names = append(names, c.name)
+				expectedArgs += c.args
+			}
+		}
+
+		t.Run(strings.Join(append([]string{"none"}, names...), "+"), func(t *testing.T) {
+			query, args := services.BuildProductQuery(filter, page)
+
+			// Every selected filter appears, and no other one does
+			for i, c := range cases {
+				if strings.Contains(query, c.condition) != (mask&(1<<i) != 0) {
+					t.Errorf("Filter %s: presence mismatch in %q", c.name, query)
+				}
+			}
+			if (mask == 0) == strings.Contains(query, " WHERE ") {
+				t.Errorf("Unexpected WHERE clause in %q", query)
+			}
+
+			// Placeholders run $1..$n in order and match the argument count
+			matches := placeholderPattern.FindAllStringSubmatch(query, -1)
+			if len(matches) != len(args) || len(args) != expectedArgs {
+				t.Fatalf("Expected %d args and placeholders, got %d args and %d placeholders in %q", expectedArgs, len(args), len(matches), query)
+			}
+			for i, match := range matches {
+				if match[1] != fmt.Sprint(i+1) {
+					t.Errorf("Placeholder %d is $%s in %q", i+1, match[1], query)
+				}
+			}
+		})
+	}
+}
+
+func TestBuildProductQueryExactSQL(t *testing.T) {
+	minPrice := 5.0
+	page, err := services.ParsePageRequest("10", "price", "desc", "")
+	if err != nil {
+		t.Fatalf("Error parsing page request: %v", err)
+	}
+
+	query, args := services.BuildProductQuery(services.ProductFilter{MinPrice: &minPrice, NameContains: "lamp"}, page)
+
+	if !strings.HasSuffix(query, ` FROM products WHERE product_price >= $1 AND product_name ILIKE $2 ESCAPE '\' ORDER BY product_price DESC, id DESC LIMIT $3`) {
+		t.Errorf("Unexpected query: %s", query)
+	}
+	if len(args) != 3 || args[0] != 5.0 || args[1] != "%lamp%" || args[2] != 11 {
+		t.Errorf("Unexpected args: %v", args)
+	}
+}
+
+func TestBuildProductQueryEscapesLikeWildcards(t *testing.T) {
+	page, _ := services.ParsePageRequest("", "", "", "")
+	_, args := services.BuildProductQuery(services.ProductFilter{NameContains: `50%_off\`}, page)
+
+	if args[0] != `%50\%\_off\\%` {
+		t.Errorf("Expected wildcards to be escaped, got %v", args[0])
+	}
+}
+
+func TestGetProductsFilterQueryParameters(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    string
+		sql      string
+		args     []interface{}
+		expected int
+	}{
+		{name: "price only", query: "price_max=20", sql: `WHERE product_price <= \$1 ORDER BY`, args: []interface{}{20.0, 21}, expected: http.StatusOK},
+		{name: "user and price", query: "user_id=3&price_min=1", sql: `WHERE user_id = \$1 AND product_price >= \$2 ORDER BY`, args: []interface{}{3, 1.0, 21}, expected: http.StatusOK},
+		{name: "zero minimum price", query: "price_min=0", sql: `WHERE product_price >= \$1 ORDER BY`, args: []interface{}{0.0, 21}, expected: http.StatusOK},
+		{name: "no images", query: "has_images=false", sql: `WHERE coalesce\(cardinality\(product_images\), 0\) = 0 ORDER BY`, args: []interface{}{21}, expected: http.StatusOK},
+		{name: "date range", query: "created_after=2024-01-01&created_before=2024-02-01T00:00:00Z", sql: `WHERE created_at >= \$1 AND created_at < \$2 ORDER BY`, args: []interface{}{time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC), 21}, expected: http.StatusOK},
+		{name: "ids", query: "ids=1,2,3", sql: `WHERE id = ANY\(\$1\) ORDER BY`, args: []interface{}{"{1,2,3}", 21}, expected: http.StatusOK},
+		{name: "invalid user_id", query: "user_id=abc", expected: http.StatusBadRequest},
+		{name: "negative price", query: "price_min=-1", expected: http.StatusBadRequest},
+		{name: "inverted price range", query: "price_min=10&price_max=5", expected: http.StatusBadRequest},
+		{name: "invalid has_images", query: "has_images=maybe", expected: http.StatusBadRequest},
+		{name: "invalid date", query: "created_after=yesterday", expected: http.StatusBadRequest},
+		{name: "invalid ids", query: "ids=1,x", expected: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router, mock := newMockRouter(t)
+			if tt.sql != "" {
+				args := make([]driver.Value, len(tt.args))
+				for i, arg := range tt.args {
+					args[i] = arg
+				}
+				mock.ExpectQuery(tt.sql).WithArgs(args...).WillReturnRows(productRows())
+			}
+
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, httptest.NewRequest("GET", "/products?"+tt.query, nil))
+
+			if rr.Code != tt.expected {
+				t.Fatalf("Expected status %v, but got %v: %s", tt.expected, rr.Code, rr.Body.String())
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("Unmet database expectations: %v", err)
+			}
+		})
+	}
+}
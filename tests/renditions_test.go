@@ -0,0 +1,232 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"product-management/config"
+	imageprocessor "product-management/image-processor"
+	"product-management/models"
+	services "product-management/services"
+	"product-management/storage"
+	"product-management/tests/harness"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// serveImage serves a width by height PNG at every path until the test ends
+func serveImage(t *testing.T, width, height int) *httptest.Server {
+	var source bytes.Buffer
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for x := 0; x < width; x++ {
+		img.Set(x, x%height, color.RGBA{B: 200, A: 255})
+	}
+	if err := png.Encode(&source, img); err != nil {
+		t.Fatalf("Error encoding source image: %v", err)
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(source.Bytes())
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestProcessImageRendersEveryRendition(t *testing.T) {
+	server := serveImage(t, 1600, 1200)
+	imagecfg := localImageConfig()
+	imagecfg.Renditions = append(imagecfg.Renditions, config.RenditionConfig{Name: "poster", Width: 4000, Fit: config.FitInside, Format: "png"})
+	store := storage.NewMemoryStore("https://cdn.example.com", "")
+	processor := imageprocessor.NewProcessor(store, imagecfg)
+
+	sourceURL := server.URL + "/photo.png"
+	renditions, err := processor.ProcessImage(context.Background(), sourceURL)
+	if err != nil {
+		t.Fatalf("Error processing image: %v", err)
+	}
+
+	expected := map[string]struct {
+		width, height int
+		format        string
+	}{
+		"thumbnail": {width: 160, height: 160, format: "jpeg"},
+		"square":    {width: 600, height: 600, format: "jpeg"},
+		"medium":    {width: 800, height: 600, format: "jpeg"},
+		"large":     {width: 1600, height: 1200, format: "jpeg"},
+		// Fitting never enlarges the source
+		"poster": {width: 1600, height: 1200, format: "png"},
+	}
+	if len(renditions) != len(expected) {
+		t.Fatalf("Expected %d renditions, but got %+v", len(expected), renditions)
+	}
+	for name, want := range expected {
+		rendition := renditions[name]
+		key := imageprocessor.RenditionKey(sourceURL, name, want.format)
+		if rendition.Key != key || rendition.URL != "https://cdn.example.com/"+key || rendition.Format != want.format {
+			t.Errorf("%s: unexpected rendition %+v", name, rendition)
+		}
+		if rendition.Width != want.width || rendition.Height != want.height {
+			t.Errorf("%s: expected %dx%d, but got %dx%d", name, want.width, want.height, rendition.Width, rendition.Height)
+		}
+
+		body, info, err := store.Get(context.Background(), key)
+		if err != nil {
+			t.Fatalf("%s: error reading rendition: %v", name, err)
+		}
+		stored, format, err := image.Decode(body)
+		body.Close()
+		if err != nil {
+			t.Fatalf("%s: error decoding rendition: %v", name, err)
+		}
+		if format != want.format || info.Size != int64(rendition.Bytes) || stored.Bounds().Dx() != want.width || stored.Bounds().Dy() != want.height {
+			t.Errorf("%s: expected a %dx%d %s of %d bytes, but got a %v %s of %d bytes", name, want.width, want.height, want.format, rendition.Bytes, stored.Bounds(), format, info.Size)
+		}
+	}
+
+	// Reprocessing replaces the renditions rather than adding new objects
+	if _, err := processor.ProcessImage(context.Background(), sourceURL, "thumbnail"); err != nil {
+		t.Fatalf("Error reprocessing image: %v", err)
+	}
+	if keys := store.Keys(); len(keys) != len(expected) {
+		t.Errorf("Expected %d stored objects, but got %v", len(expected), keys)
+	}
+}
+
+func TestRenditionProfiles(t *testing.T) {
+	processor := imageprocessor.NewProcessor(storage.NewMemoryStore("", ""), config.Default().Image)
+	names := func(profiles []config.RenditionConfig) []string {
+		var names []string
+		for _, profile := range profiles {
+			names = append(names, profile.Name)
+		}
+		sort.Strings(names)
+		return names
+	}
+
+	for _, requested := range [][]string{nil, {imageprocessor.RenditionCompressed}} {
+		profiles, err := processor.Profiles(requested)
+		if err != nil || fmt.Sprint(names(profiles)) != "[large medium square thumbnail]" {
+			t.Errorf("%q: expected every rendition, but got %v, %v", requested, names(profiles), err)
+		}
+	}
+	profiles, err := processor.Profiles([]string{"thumbnail"})
+	if err != nil || len(profiles) != 1 || profiles[0].Width != 160 {
+		t.Errorf("Expected the thumbnail profile, but got %+v, %v", profiles, err)
+	}
+	if _, err := processor.Profiles([]string{"thumbnail", "poster"}); !errors.Is(err, imageprocessor.ErrUnsupportedJob) {
+		t.Errorf("Expected an unknown rendition to be unsupported, but got %v", err)
+	}
+}
+
+func TestProductImagesExposeRenditions(t *testing.T) {
+	h := harness.New(t)
+	ownerID := h.CreateUser("owner", models.RoleUser)
+
+	var product services.Product
+	body := `{"product_name":"Lamp","product_price":40,"product_images":["http://example.com/a.jpg","http://example.com/b.jpg"]}`
+	h.DoJSON("POST", "/products", body, ownerID, http.StatusCreated, &product)
+	if len(product.Images) != 2 || product.Images[0].SourceURL != "http://example.com/a.jpg" || len(product.Images[0].Renditions) != 0 {
+		t.Fatalf("Expected images without renditions, but got %+v", product.Images)
+	}
+
+	renditions := imageprocessor.Renditions{
+		"thumbnail": {URL: "https://cdn.example.com/a/thumbnail.jpg", Width: 160, Height: 160, Format: "jpeg"},
+		"medium":    {URL: "https://cdn.example.com/a/medium.jpg", Width: 800, Height: 600, Format: "jpeg"},
+	}
+	if err := h.Products.SetImageRenditions(context.Background(), product.ID, 0, "http://example.com/a.jpg", renditions["medium"].URL, renditions); err != nil {
+		t.Fatalf("Error storing renditions: %v", err)
+	}
+
+	// Each response is decoded into a fresh product so maps from earlier responses do not leak in
+	path := fmt.Sprintf("/products/%d", product.ID)
+	do := func(method, body string) services.Product {
+		var product services.Product
+		h.DoJSON(method, path, body, ownerID, http.StatusOK, &product)
+		return product
+	}
+	product = do("GET", "")
+	if !reflect.DeepEqual(product.Images[0].Renditions["thumbnail"], renditions["thumbnail"]) || len(product.Images[1].Renditions) != 0 {
+		t.Errorf("Expected the first image's renditions, but got %+v", product.Images)
+	}
+	if len(product.CompressedProductImages) != 1 || product.CompressedProductImages[0] != renditions["medium"].URL {
+		t.Errorf("Expected the primary rendition in compressed_product_images, but got %q", product.CompressedProductImages)
+	}
+
+	// Replacing the first image drops its renditions; the reordered one keeps none either
+	body = `{"product_name":"Lamp","product_price":40,"product_images":["http://example.com/c.jpg","http://example.com/a.jpg"]}`
+	product = do("PUT", body)
+	for i, image := range product.Images {
+		if len(image.Renditions) != 0 {
+			t.Errorf("Expected image %d to have no renditions after the update, but got %+v", i, image)
+		}
+	}
+	product = do("GET", "")
+	if len(product.Images) != 2 || len(product.Images[0].Renditions) != 0 || len(product.Images[1].Renditions) != 0 {
+		t.Errorf("Expected the stored renditions to be dropped, but got %+v", product.Images)
+	}
+
+	// Keeping the first image keeps its renditions
+	do("PUT", `{"product_name":"Lamp","product_price":40,"product_images":["http://example.com/c.jpg"]}`)
+	if err := h.Products.SetImageRenditions(context.Background(), product.ID, 0, "http://example.com/c.jpg", "", renditions); err != nil {
+		t.Fatalf("Error storing renditions: %v", err)
+	}
+	product = do("PATCH", `{"product_name":"Desk lamp"}`)
+	if !reflect.DeepEqual(product.Images[0].Renditions["medium"], renditions["medium"]) {
+		t.Errorf("Expected a patch that keeps the image to keep its renditions, but got %+v", product.Images)
+	}
+}
+
+func TestProductUpdatePrunesAndQueuesImages(t *testing.T) {
+	h := harness.New(t)
+	ownerID := h.CreateUser("owner", models.RoleUser)
+
+	var product services.Product
+	body := `{"product_name":"Lamp","product_price":40,"product_images":["http://example.com/a.jpg","http://example.com/b.jpg"]}`
+	h.DoJSON("POST", "/products", body, ownerID, http.StatusCreated, &product)
+	h.Queue.Drain(func(ctx context.Context, job imageprocessor.ImageJob) error { return nil }, nil)
+	for i, source := range product.ProductImages {
+		compressed := fmt.Sprintf("https://cdn.example.com/%d.jpg", i)
+		renditions := imageprocessor.Renditions{"medium": {URL: compressed, Format: "jpeg"}}
+		if err := h.Products.SetImageRenditions(context.Background(), product.ID, i, source, compressed, renditions); err != nil {
+			t.Fatalf("Error storing renditions: %v", err)
+		}
+	}
+
+	// Replacing the second image drops its compressed copy and queues the new one only
+	var updated services.Product
+	path := fmt.Sprintf("/products/%d", product.ID)
+	body = `{"product_name":"Lamp","product_price":40,"product_images":["http://example.com/a.jpg","http://example.com/c.jpg"]}`
+	h.DoJSON("PUT", path, body, ownerID, http.StatusOK, &updated)
+	if !reflect.DeepEqual(updated.CompressedProductImages, []string{"https://cdn.example.com/0.jpg"}) {
+		t.Errorf("Expected only the kept image's compressed copy, but got %q", updated.CompressedProductImages)
+	}
+	if len(updated.Images) != 2 || len(updated.Images[0].Renditions) != 1 || len(updated.Images[1].Renditions) != 0 {
+		t.Errorf("Unexpected images after the update: %+v", updated.Images)
+	}
+	if updated.CreatedAt.IsZero() {
+		t.Errorf("Expected the response to carry the stored product, but got %+v", updated)
+	}
+	jobs := h.Queue.Jobs()
+	if len(jobs) != 1 || jobs[0].ImageIndex != 1 || jobs[0].SourceURL != "http://example.com/c.jpg" {
+		t.Errorf("Expected a job for the added image only, but got %+v", jobs)
+	}
+
+	var stored services.Product
+	h.DoJSON("GET", path, "", ownerID, http.StatusOK, &stored)
+	if !reflect.DeepEqual(stored.CompressedProductImages, updated.CompressedProductImages) || !reflect.DeepEqual(stored.Images, updated.Images) {
+		t.Errorf("Expected GET to match the update response, but got %+v and %+v", stored, updated)
+	}
+
+	// A patch that leaves the images alone queues nothing
+	h.Queue.Drain(func(ctx context.Context, job imageprocessor.ImageJob) error { return nil }, nil)
+	h.DoJSON("PATCH", path, `{"product_price":45}`, ownerID, http.StatusOK, nil)
+	if jobs := h.Queue.Jobs(); len(jobs) != 0 {
+		t.Errorf("Expected no jobs for an unchanged image list, but got %+v", jobs)
+	}
+}
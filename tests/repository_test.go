@@ -0,0 +1,252 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	imageprocessor "product-management/image-processor"
+	"product-management/models"
+	services "product-management/services"
+	"product-management/tests/harness"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+// newMemoryRouter boots the harness and returns its router and repositories
+func newMemoryRouter(t *testing.T) (*mux.Router, *services.MemoryProductRepository, *services.MemoryUserRepository) {
+	h := harness.New(t)
+	return h.Router, h.Products, h.Users
+}
+
+// createUser stores a user with the given role and returns its ID
+func createUser(t *testing.T, users services.UserRepository, username, role string) int {
+	user := models.User{Username: username, Password: "hash", Role: role}
+	if err := users.Create(context.Background(), &user); err != nil {
+		t.Fatalf("Error creating user: %v", err)
+	}
+	return user.ID
+}
+
+// seedProducts stores products with the given names and prices for ownerID
+func seedProducts(t *testing.T, products services.ProductRepository, ownerID int, prices map[string]float64) {
+	for name, price := range prices {
+		product := services.Product{UserID: ownerID, ProductName: name, ProductDescription: "Sturdy " + name, ProductPrice: price}
+		if err := products.Create(context.Background(), &product); err != nil {
+			t.Fatalf("Error creating product: %v", err)
+		}
+	}
+}
+
+func TestMemoryRepositoryProductLifecycle(t *testing.T) {
+	router, _, users := newMemoryRouter(t)
+	ownerID := createUser(t, users, "owner", models.RoleUser)
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, authorizedRequest(t, "POST", "/products", `{"product_name":"Desk","product_price":120}`, ownerID))
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected status %v, but got %v: %s", http.StatusCreated, rr.Code, rr.Body.String())
+	}
+	var created services.Product
+	if err := json.NewDecoder(rr.Body).Decode(&created); err != nil {
+		t.Fatalf("Error decoding response body: %v", err)
+	}
+	if created.ID == 0 || created.UserID != ownerID || created.CreatedAt.IsZero() {
+		t.Fatalf("Unexpected created product: %+v", created)
+	}
+
+	path := fmt.Sprintf("/products/%d", created.ID)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, authorizedRequest(t, "PATCH", path, `{"product_price":99.5}`, ownerID))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status %v, but got %v: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("GET", path, nil))
+	var fetched services.Product
+	if err := json.NewDecoder(rr.Body).Decode(&fetched); err != nil {
+		t.Fatalf("Error decoding response body: %v", err)
+	}
+	if fetched.ProductName != "Desk" || fetched.ProductPrice != 99.5 {
+		t.Errorf("Unexpected product after patch: %+v", fetched)
+	}
+
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, authorizedRequest(t, "DELETE", path, "", ownerID))
+	if rr.Code != http.StatusNoContent {
+		t.Fatalf("Expected status %v, but got %v: %s", http.StatusNoContent, rr.Code, rr.Body.String())
+	}
+
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("GET", path, nil))
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("Expected status %v after delete, but got %v", http.StatusNotFound, rr.Code)
+	}
+}
+
+func TestMemoryRepositoryAuth(t *testing.T) {
+	router, _, _ := newMemoryRouter(t)
+
+	for _, expected := range []int{http.StatusCreated, http.StatusConflict} {
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, httptest.NewRequest("POST", "/users", strings.NewReader(`{"username":"alice","password":"correct horse"}`)))
+		if rr.Code != expected {
+			t.Fatalf("Expected status %v, but got %v: %s", expected, rr.Code, rr.Body.String())
+		}
+	}
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("POST", "/auth/login", strings.NewReader(`{"username":"alice","password":"correct horse"}`)))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status %v, but got %v: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("POST", "/auth/login", strings.NewReader(`{"username":"alice","password":"wrong password"}`)))
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %v, but got %v", http.StatusUnauthorized, rr.Code)
+	}
+}
+
+func TestMemoryRepositoryPaginatesWithTies(t *testing.T) {
+	router, products, users := newMemoryRouter(t)
+	ownerID := createUser(t, users, "owner", models.RoleUser)
+	seedProducts(t, products, ownerID, map[string]float64{"A": 10, "B": 20, "C": 20, "D": 20, "E": 30})
+
+	// Walk every page sorted by price descending; ties on price must neither repeat nor skip products
+	var names []string
+	path := "/products?limit=2&sort=price&order=desc"
+	for {
+		page := getProductPage(t, router, path)
+		for _, product := range page.Data {
+			names = append(names, product.ProductName)
+		}
+		if !page.Paging.HasMore {
+			break
+		}
+		path = "/products?limit=2&sort=price&order=desc&cursor=" + page.Paging.NextCursor
+	}
+
+	if len(names) != 5 || names[0] != "E" || names[4] != "A" {
+		t.Errorf("Unexpected order: %v", names)
+	}
+	seen := map[string]bool{}
+	for _, name := range names {
+		if seen[name] {
+			t.Errorf("Product %s returned twice: %v", name, names)
+		}
+		seen[name] = true
+	}
+}
+
+func TestMemoryRepositoryFiltersAndSearch(t *testing.T) {
+	router, products, users := newMemoryRouter(t)
+	ownerID := createUser(t, users, "owner", models.RoleUser)
+	otherID := createUser(t, users, "other", models.RoleUser)
+	seedProducts(t, products, ownerID, map[string]float64{"Desk Lamp": 40, "Floor Lamp": 90, "Desk": 200})
+	seedProducts(t, products, otherID, map[string]float64{"Lamp Shade": 15})
+
+	page := getProductPage(t, router, fmt.Sprintf("/products?user_id=%d&price_max=100&sort=price", ownerID))
+	if len(page.Data) != 2 || page.Data[0].ProductName != "Desk Lamp" || page.Data[1].ProductName != "Floor Lamp" {
+		t.Errorf("Unexpected filtered page: %+v", page.Data)
+	}
+
+	results := searchProducts(t, router, "/products/search?q=lam&price_min=20")
+	if len(results.Data) != 2 {
+		t.Fatalf("Expected 2 search results, got %+v", results.Data)
+	}
+	for _, result := range results.Data {
+		if result.Highlights.ProductName != "Desk <mark>Lamp</mark>" && result.Highlights.ProductName != "Floor <mark>Lamp</mark>" {
+			t.Errorf("Unexpected highlight: %q", result.Highlights.ProductName)
+		}
+	}
+
+	results = searchProducts(t, router, "/products/search?q=desk+lamp")
+	if len(results.Data) != 1 || results.Data[0].ProductName != "Desk Lamp" {
+		t.Errorf("Expected every word to match, got %+v", results.Data)
+	}
+}
+
+func TestMemoryRepositoryMergesRenditionSubsets(t *testing.T) {
+	ctx := context.Background()
+	products := services.NewMemoryProductRepository()
+	product := services.Product{ProductName: "Chair", ProductImages: []string{"http://example.com/a.jpg"}}
+	if err := products.Create(ctx, &product); err != nil {
+		t.Fatalf("Error creating product: %v", err)
+	}
+
+	full := imageprocessor.Renditions{"thumbnail": {URL: "http://cdn/a-thumb.jpg"}, "medium": {URL: "http://cdn/a-medium.jpg"}}
+	if err := products.SetImageRenditions(ctx, product.ID, 0, "http://example.com/a.jpg", "http://cdn/a-medium.jpg", full); err != nil {
+		t.Fatalf("Error setting image renditions: %v", err)
+	}
+	// A job for the thumbnail alone replaces it and keeps the medium rendition
+	subset := imageprocessor.Renditions{"thumbnail": {URL: "http://cdn/a-thumb-2.jpg"}}
+	if err := products.SetImageRenditions(ctx, product.ID, 0, "http://example.com/a.jpg", "", subset); err != nil {
+		t.Fatalf("Error setting image renditions: %v", err)
+	}
+
+	stored, _ := products.GetByID(ctx, product.ID)
+	renditions := stored.Images[0].Renditions
+	if len(renditions) != 2 || renditions["thumbnail"].URL != "http://cdn/a-thumb-2.jpg" || renditions["medium"].URL != "http://cdn/a-medium.jpg" {
+		t.Errorf("Expected the subset to be merged into the stored renditions, got %+v", renditions)
+	}
+	if len(stored.CompressedProductImages) != 1 || stored.CompressedProductImages[0] != "http://cdn/a-medium.jpg" {
+		t.Errorf("Expected the primary URL to be kept, got %q", stored.CompressedProductImages)
+	}
+}
+
+func TestMemoryRepositoryCompressedImages(t *testing.T) {
+	ctx := context.Background()
+	products := services.NewMemoryProductRepository()
+	product := services.Product{ProductName: "Chair", ProductImages: []string{"http://example.com/a.jpg", "http://example.com/b.jpg"}}
+	if err := products.Create(ctx, &product); err != nil {
+		t.Fatalf("Error creating product: %v", err)
+	}
+
+	// The second image finishes first, leaving a gap for the first one
+	renditions := imageprocessor.Renditions{"medium": {URL: "http://cdn/b.jpg"}}
+	if err := products.SetImageRenditions(ctx, product.ID, 1, "http://example.com/b.jpg", "http://cdn/b.jpg", renditions); err != nil {
+		t.Fatalf("Error setting image renditions: %v", err)
+	}
+	if err := products.SetImageRenditions(ctx, product.ID, 0, "http://example.com/replaced.jpg", "http://cdn/a.jpg", renditions); !errors.Is(err, services.ErrProductNotFound) {
+		t.Errorf("Expected a stale job to return ErrProductNotFound, got %v", err)
+	}
+
+	stored, _ := products.GetByID(ctx, product.ID)
+	if len(stored.CompressedProductImages) != 2 || stored.CompressedProductImages[0] != "" || stored.CompressedProductImages[1] != "http://cdn/b.jpg" {
+		t.Errorf("Unexpected compressed images: %q", stored.CompressedProductImages)
+	}
+	if len(stored.Images) != 2 || len(stored.Images[0].Renditions) != 0 || stored.Images[1].Renditions["medium"].URL != "http://cdn/b.jpg" {
+		t.Errorf("Unexpected images: %+v", stored.Images)
+	}
+
+	// A legacy job fills the gap at the image's position, and running it again changes nothing
+	for run, expected := range [][]int{{product.ID}, nil} {
+		ids, err := products.AddCompressedImage(ctx, "http://example.com/a.jpg", "http://cdn/a-legacy.jpg")
+		if err != nil || !slices.Equal(ids, expected) {
+			t.Errorf("Run %d: expected products %v to be updated, got %v, %v", run+1, expected, ids, err)
+		}
+		stored, _ = products.GetByID(ctx, product.ID)
+		if !slices.Equal(stored.CompressedProductImages, []string{"http://cdn/a-legacy.jpg", "http://cdn/b.jpg"}) {
+			t.Errorf("Run %d: unexpected compressed images: %q", run+1, stored.CompressedProductImages)
+		}
+	}
+
+	// Image states are removed along with their product
+	if err := products.RecordImageStatus(ctx, product.ID, services.ImageStatus{ImageIndex: 0, Status: services.ImageStatusDone}); err != nil {
+		t.Fatalf("Error recording image status: %v", err)
+	}
+	if err := products.Delete(ctx, product.ID); err != nil {
+		t.Fatalf("Error deleting product: %v", err)
+	}
+	status, err := products.GetImageStatus(ctx, product.ID)
+	if err != nil || len(status.Images) != 0 {
+		t.Errorf("Expected no image states after delete, got %+v, %v", status, err)
+	}
+}
@@ -0,0 +1,174 @@
+package tests
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	services "product-management/services"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+// searchRows has the product columns followed by the rank and both highlights
+func searchRows() *sqlmock.Rows {
+	return sqlmock.NewRows([]string{"id", "user_id", "product_name", "product_description", "product_images", "product_price",
+		"compressed_product_images", "image_renditions", "created_at", "search_rank", "name_headline", "description_headline"})
+}
+
+// searchProducts requests search results and decodes the paged envelope
+func searchProducts(t *testing.T, router http.Handler, path string) services.SearchPage {
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("GET", path, nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status %v, but got %v: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+
+	var page services.SearchPage
+	if err := json.NewDecoder(rr.Body).Decode(&page); err != nil {
+		t.Fatalf("Error decoding response body: %v", err)
+	}
+	return page
+}
+
+func TestParseSearchQuery(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{input: "mouse", expected: "mouse:*"},
+		{input: "Wireless  Mouse", expected: "wireless:* & mouse:*"},
+		{input: "lap-top!", expected: "lap:* & top:*"},
+		{input: "café 42", expected: "café:* & 42:*"},
+		{input: "'a' & !b | c:*", expected: "a:* & b:* & c:*"},
+	}
+
+	for _, tt := range tests {
+		search, err := services.ParseSearchQuery(tt.input)
+		if err != nil {
+			t.Errorf("ParseSearchQuery(%q) returned error: %v", tt.input, err)
+			continue
+		}
+		if search != tt.expected {
+			t.Errorf("ParseSearchQuery(%q) = %q, expected %q", tt.input, search, tt.expected)
+		}
+	}
+
+	for _, input := range []string{"", "  ", "&|!:*()", strings.Repeat("a", services.MaxSearchLength+1), strings.Repeat("a ", services.MaxSearchTerms+1)} {
+		if _, err := services.ParseSearchQuery(input); !errors.Is(err, services.ErrInvalidSearch) {
+			t.Errorf("ParseSearchQuery(%q) error = %v, expected ErrInvalidSearch", input, err)
+		}
+	}
+}
+
+func TestSearchProductsRanksAndHighlights(t *testing.T) {
+	router, mock := newMockRouter(t)
+	created := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	// First page: best matches first, one extra row to detect the next page
+	mock.ExpectQuery(`SELECT (.+), search_rank, ts_headline\('english', coalesce\(product_name, ''\), search_query, \$2\), `+
+		`ts_headline\('english', coalesce\(product_description, ''\), search_query, \$3\) `+
+		`FROM products, to_tsquery\('english', \$1\) AS search_query, ts_rank_cd\(search_vector, search_query\) AS search_rank `+
+		`WHERE search_vector @@ search_query ORDER BY search_rank DESC, id DESC LIMIT \$4`).
+		WithArgs("wireless:* & mou:*", sqlmock.AnyArg(), sqlmock.AnyArg(), 2).
+		WillReturnRows(searchRows().
+			AddRow(7, 1, "Wireless Mouse", "A <b>quiet</b> mouse", "{}", 25.0, "{}", "{}", created, 0.5,
+				"\uE000Wireless\uE001 \uE000Mouse\uE001", "A <b>quiet</b> \uE000mouse\uE001").
+			AddRow(3, 1, "Mouse pad", "", "{}", 5.0, "{}", "{}", created, 0.25, "\uE000Mouse\uE001 pad", ""))
+
+	first := searchProducts(t, router, "/products/search?q=Wireless+mou&limit=1")
+	if len(first.Data) != 1 || !first.Paging.HasMore || first.Paging.Sort != services.SortRelevance || first.Paging.Order != "desc" {
+		t.Fatalf("Unexpected first page: %+v", first)
+	}
+	result := first.Data[0]
+	if result.ID != 7 || result.ProductName != "Wireless Mouse" || result.Rank != 0.5 {
+		t.Errorf("Unexpected result: %+v", result)
+	}
+	if result.Highlights.ProductName != "<mark>Wireless</mark> <mark>Mouse</mark>" {
+		t.Errorf("Unexpected name highlight: %q", result.Highlights.ProductName)
+	}
+	// Product text is escaped so only the <mark> tags are markup
+	if result.Highlights.ProductDescription != "A &lt;b&gt;quiet&lt;/b&gt; <mark>mouse</mark>" {
+		t.Errorf("Unexpected description highlight: %q", result.Highlights.ProductDescription)
+	}
+
+	// Second page continues strictly after (0.5, 7)
+	mock.ExpectQuery(`WHERE search_vector @@ search_query AND \(search_rank, id\) < \(\$2, \$3\) ORDER BY search_rank DESC, id DESC LIMIT \$6`).
+		WithArgs("wireless:* & mou:*", 0.5, 7, sqlmock.AnyArg(), sqlmock.AnyArg(), 2).
+		WillReturnRows(searchRows().AddRow(3, 1, "Mouse pad", "", "{}", 5.0, "{}", "{}", created, 0.25, "\uE000Mouse\uE001 pad", ""))
+
+	second := searchProducts(t, router, "/products/search?q=Wireless+mou&limit=1&cursor="+first.Paging.NextCursor)
+	if len(second.Data) != 1 || second.Data[0].ID != 3 || second.Paging.HasMore {
+		t.Errorf("Unexpected second page: %+v", second)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unmet database expectations: %v", err)
+	}
+}
+
+func TestSearchProductsCombinesFilters(t *testing.T) {
+	router, mock := newMockRouter(t)
+	mock.ExpectQuery(`WHERE search_vector @@ search_query AND user_id = \$2 AND product_price <= \$3 ORDER BY product_price ASC, id ASC LIMIT \$6`).
+		WithArgs("lamp:*", 4, 50.0, sqlmock.AnyArg(), sqlmock.AnyArg(), services.DefaultPageLimit+1).
+		WillReturnRows(searchRows())
+
+	page := searchProducts(t, router, "/products/search?q=lamp&user_id=4&price_max=50&sort=price")
+	if page.Data == nil || len(page.Data) != 0 || page.Paging.Sort != "price" || page.Paging.Order != "asc" {
+		t.Errorf("Unexpected page: %+v", page)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unmet database expectations: %v", err)
+	}
+}
+
+func TestGetProductsSearchFilter(t *testing.T) {
+	router, mock := newMockRouter(t)
+	mock.ExpectQuery(`FROM products WHERE product_price >= \$1 AND search_vector @@ to_tsquery\('english', \$2\) ORDER BY id ASC LIMIT \$3`).
+		WithArgs(10.0, "desk:* & lamp:*", services.DefaultPageLimit+1).
+		WillReturnRows(productRows())
+
+	getProductPage(t, router, "/products?q=desk+lamp&price_min=10")
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unmet database expectations: %v", err)
+	}
+}
+
+func TestSearchProductsErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+	}{
+		{name: "missing q", query: ""},
+		{name: "blank q", query: "q=++"},
+		{name: "no words", query: "q=%26%7C%21"},
+		{name: "too many words", query: "q=" + strings.Repeat("a+", services.MaxSearchTerms+1)},
+		{name: "unknown sort", query: "q=lamp&sort=colour"},
+		{name: "cursor for another sort", query: "q=lamp&cursor=eyJzb3J0IjoicHJpY2UiLCJvcmRlciI6ImFzYyIsInZhbHVlIjoxMCwiaWQiOjF9"},
+		{name: "invalid filter", query: "q=lamp&price_min=-1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router, _ := newMockRouter(t)
+
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, httptest.NewRequest("GET", "/products/search?"+tt.query, nil))
+
+			if rr.Code != http.StatusBadRequest {
+				t.Errorf("Expected status %v, but got %v: %s", http.StatusBadRequest, rr.Code, rr.Body.String())
+			}
+		})
+	}
+
+	// Relevance only applies to search results
+	router, _ := newMockRouter(t)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("GET", "/products?sort=relevance", nil))
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %v for sort=relevance on /products, but got %v", http.StatusBadRequest, rr.Code)
+	}
+}
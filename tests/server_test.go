@@ -0,0 +1,117 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"product-management/server"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestServerDrainsInFlightRequestsBeforeHooks(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		io.WriteString(w, "done")
+	})
+
+	srv := server.New(handler, server.Options{DrainDelay: 10 * time.Millisecond, ShutdownTimeout: 5 * time.Second})
+	var stopped []string
+	srv.OnShutdown("worker", func(context.Context) error {
+		stopped = append(stopped, "worker")
+		return nil
+	})
+	srv.OnShutdown("database pool", func(context.Context) error {
+		stopped = append(stopped, "database pool")
+		return errors.New("already closed")
+	})
+	srv.OnShutdown("Redis client", func(context.Context) error {
+		stopped = append(stopped, "Redis client")
+		return nil
+	})
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Error listening: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() { served <- srv.Serve(ctx, ln) }()
+
+	type result struct {
+		body string
+		err  error
+	}
+	responses := make(chan result, 1)
+	go func() {
+		resp, err := http.Get("http://" + ln.Addr().String())
+		if err != nil {
+			responses <- result{err: err}
+			return
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		responses <- result{body: string(body), err: err}
+	}()
+
+	<-started
+	if !srv.Ready() {
+		t.Fatalf("Expected the server to be ready while serving")
+	}
+
+	cancel()
+	deadline := time.Now().Add(time.Second)
+	for srv.Ready() && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if srv.Ready() {
+		t.Fatalf("Expected the server to report not ready once shutdown starts")
+	}
+	if len(stopped) != 0 {
+		t.Fatalf("Hooks ran before in-flight requests drained: %v", stopped)
+	}
+
+	close(release)
+	if res := <-responses; res.err != nil || res.body != "done" {
+		t.Fatalf("Expected the in-flight request to complete, got %q, %v", res.body, res.err)
+	}
+
+	err = <-served
+	if err == nil || !strings.Contains(err.Error(), "failed to stop database pool: already closed") {
+		t.Errorf("Expected the failing hook to be reported, got %v", err)
+	}
+	if expected := []string{"worker", "database pool", "Redis client"}; !reflect.DeepEqual(stopped, expected) {
+		t.Errorf("Expected hooks to run in order %v, but got %v", expected, stopped)
+	}
+	if _, err := net.DialTimeout("tcp", ln.Addr().String(), 100*time.Millisecond); err == nil {
+		t.Errorf("Expected the listener to be closed after shutdown")
+	}
+}
+
+func TestServerRunsHooksWhenListenFails(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Error listening: %v", err)
+	}
+	defer ln.Close()
+
+	srv := server.New(http.NotFoundHandler(), server.Options{Addr: ln.Addr().String(), ShutdownTimeout: time.Second})
+	closed := false
+	srv.OnShutdown("database pool", func(context.Context) error {
+		closed = true
+		return nil
+	})
+
+	if err := srv.Run(context.Background()); err == nil {
+		t.Fatalf("Expected Run to fail on an address in use")
+	}
+	if !closed || srv.Ready() {
+		t.Errorf("Expected hooks to run and the server to stay not ready, got closed=%v ready=%v", closed, srv.Ready())
+	}
+}
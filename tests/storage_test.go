@@ -0,0 +1,243 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"product-management/config"
+	imageprocessor "product-management/image-processor"
+	"product-management/storage"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestObjectStores(t *testing.T) {
+	local, err := storage.NewLocalStore(t.TempDir(), "https://cdn.example.com/images", "secret")
+	if err != nil {
+		t.Fatalf("Error creating local store: %v", err)
+	}
+	stores := map[string]interface {
+		storage.ObjectStore
+		Verify(key, method string, query url.Values) error
+	}{
+		"memory": storage.NewMemoryStore("https://cdn.example.com/images", "secret"),
+		"local":  local,
+	}
+
+	for name, store := range stores {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			if err := store.Put(ctx, "compressed/a.jpg", strings.NewReader("first"), "image/jpeg"); err != nil {
+				t.Fatalf("Error storing object: %v", err)
+			}
+			if err := store.Put(ctx, "compressed/a.jpg", strings.NewReader("second"), "image/jpeg"); err != nil {
+				t.Fatalf("Error replacing object: %v", err)
+			}
+
+			body, info, err := store.Get(ctx, "compressed/a.jpg")
+			if err != nil {
+				t.Fatalf("Error reading object: %v", err)
+			}
+			data, _ := io.ReadAll(body)
+			body.Close()
+			if string(data) != "second" || info.Size != 6 || info.ContentType != "image/jpeg" {
+				t.Errorf("Expected the replaced object, but got %q with %+v", data, info)
+			}
+			if got := store.URL("compressed/a b.jpg"); got != "https://cdn.example.com/images/compressed/a%20b.jpg" {
+				t.Errorf("Unexpected URL %s", got)
+			}
+
+			signed, err := store.SignedURL(ctx, "compressed/a.jpg", "PUT", time.Minute)
+			if err != nil {
+				t.Fatalf("Error signing URL: %v", err)
+			}
+			u, _ := url.Parse(signed)
+			if err := store.Verify("compressed/a.jpg", "PUT", u.Query()); err != nil {
+				t.Errorf("Expected the signed URL to verify, but got %v", err)
+			}
+			if err := store.Verify("compressed/b.jpg", "PUT", u.Query()); !errors.Is(err, storage.ErrInvalidSignature) {
+				t.Errorf("Expected a signature for another key to be rejected, but got %v", err)
+			}
+			if err := store.Verify("compressed/a.jpg", "GET", u.Query()); !errors.Is(err, storage.ErrInvalidSignature) {
+				t.Errorf("Expected a signature for another method to be rejected, but got %v", err)
+			}
+			expired, _ := store.SignedURL(ctx, "compressed/a.jpg", "GET", -time.Minute)
+			u, _ = url.Parse(expired)
+			if err := store.Verify("compressed/a.jpg", "GET", u.Query()); !errors.Is(err, storage.ErrInvalidSignature) {
+				t.Errorf("Expected an expired signature to be rejected, but got %v", err)
+			}
+
+			if err := store.Delete(ctx, "compressed/a.jpg"); err != nil {
+				t.Fatalf("Error deleting object: %v", err)
+			}
+			if err := store.Delete(ctx, "compressed/a.jpg"); err != nil {
+				t.Errorf("Expected deleting a missing object to succeed, but got %v", err)
+			}
+			if _, _, err := store.Get(ctx, "compressed/a.jpg"); !errors.Is(err, storage.ErrNotFound) {
+				t.Errorf("Expected ErrNotFound, but got %v", err)
+			}
+
+			for _, key := range []string{"", "/etc/passwd", "../outside.jpg", "a/../../outside.jpg", `a\b.jpg`} {
+				if err := store.Put(ctx, key, strings.NewReader("x"), ""); !errors.Is(err, storage.ErrInvalidKey) {
+					t.Errorf("Expected key %q to be rejected, but got %v", key, err)
+				}
+			}
+		})
+	}
+}
+
+func TestLocalStoreLayout(t *testing.T) {
+	dir := t.TempDir()
+	store, err := storage.New(config.StorageConfig{Backend: storage.BackendLocal, Dir: dir}, config.S3Config{})
+	if err != nil {
+		t.Fatalf("Error creating store: %v", err)
+	}
+	if err := store.Put(context.Background(), "compressed/a.jpg", strings.NewReader("data"), "image/jpeg"); err != nil {
+		t.Fatalf("Error storing object: %v", err)
+	}
+
+	if data, err := os.ReadFile(filepath.Join(dir, "compressed", "a.jpg")); err != nil || string(data) != "data" {
+		t.Errorf("Expected the object to be a file under the directory, but got %q, %v", data, err)
+	}
+	if got := store.URL("compressed/a.jpg"); !strings.HasPrefix(got, "file://") || !strings.HasSuffix(got, "/compressed/a.jpg") {
+		t.Errorf("Expected a file URL, but got %s", got)
+	}
+	if _, err := store.SignedURL(context.Background(), "compressed/a.jpg", "GET", time.Minute); !errors.Is(err, storage.ErrSigningDisabled) {
+		t.Errorf("Expected signing without a secret to fail, but got %v", err)
+	}
+}
+
+func TestS3StoreURLs(t *testing.T) {
+	tests := []struct {
+		name     string
+		cfg      config.S3Config
+		url      string
+		presign  string
+		expected []string
+	}{
+		{
+			name:     "AWS",
+			cfg:      config.S3Config{Bucket: "images", Region: "eu-west-1"},
+			url:      "https://images.s3.eu-west-1.amazonaws.com/compressed/a.jpg",
+			expected: []string{"https://images.s3.eu-west-1.amazonaws.com/compressed/a.jpg?", "X-Amz-Signature="},
+		},
+		{
+			name:     "MinIO",
+			cfg:      config.S3Config{Bucket: "images", Region: "us-east-1", Endpoint: "http://minio:9000", ForcePathStyle: true},
+			url:      "http://minio:9000/images/compressed/a.jpg",
+			expected: []string{"http://minio:9000/images/compressed/a.jpg?", "X-Amz-Expires=900"},
+		},
+		{
+			name: "CDN",
+			cfg:  config.S3Config{Bucket: "images", Region: "us-east-1", PublicURL: "https://cdn.example.com/"},
+			url:  "https://cdn.example.com/compressed/a.jpg",
+		},
+	}
+
+	t.Setenv("AWS_ACCESS_KEY_ID", "test")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "test")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store, err := storage.NewS3Store(tt.cfg)
+			if err != nil {
+				t.Fatalf("Error creating store: %v", err)
+			}
+			if got := store.URL("compressed/a.jpg"); got != tt.url {
+				t.Errorf("Expected URL %s, but got %s", tt.url, got)
+			}
+			signed, err := store.SignedURL(context.Background(), "compressed/a.jpg", "GET", 15*time.Minute)
+			if err != nil {
+				t.Fatalf("Error presigning: %v", err)
+			}
+			for _, expected := range tt.expected {
+				if !strings.Contains(signed, expected) {
+					t.Errorf("Expected the presigned URL to contain %q, but got %s", expected, signed)
+				}
+			}
+		})
+	}
+
+	if _, err := storage.New(config.StorageConfig{Backend: storage.BackendS3}, config.S3Config{}); err == nil || !strings.Contains(err.Error(), "S3_BUCKET") {
+		t.Errorf("Expected the S3 backend to require a bucket, but got %v", err)
+	}
+}
+
+func TestS3SignedUploadURLSignsSize(t *testing.T) {
+	t.Setenv("AWS_ACCESS_KEY_ID", "test")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "test")
+	store, err := storage.NewS3Store(config.S3Config{Bucket: "images", Region: "eu-west-1", ACL: "public-read"})
+	if err != nil {
+		t.Fatalf("Error creating store: %v", err)
+	}
+
+	signed, err := store.SignedUploadURL(context.Background(), "uploads/1/2/a.png", 1234, 15*time.Minute)
+	if err != nil {
+		t.Fatalf("Error presigning: %v", err)
+	}
+	parsed, err := url.Parse(signed)
+	if err != nil {
+		t.Fatalf("Error parsing presigned URL: %v", err)
+	}
+	signedHeaders := strings.Split(parsed.Query().Get("X-Amz-SignedHeaders"), ";")
+	for _, header := range []string{"content-length", "x-amz-acl"} {
+		if !slices.Contains(signedHeaders, header) {
+			t.Errorf("Expected %s to be signed, but the signed headers are %v", header, signedHeaders)
+		}
+	}
+
+	if _, err := store.SignedUploadURL(context.Background(), "uploads/1/2/a.png", 0, 15*time.Minute); err == nil {
+		t.Error("Expected presigning an empty upload to fail")
+	}
+}
+
+func TestProcessImageStoresCompressedCopy(t *testing.T) {
+	var source bytes.Buffer
+	img := image.NewRGBA(image.Rect(0, 0, 1600, 1200))
+	for x := 0; x < 1600; x++ {
+		img.Set(x, x%1200, color.RGBA{R: 200, A: 255})
+	}
+	if err := png.Encode(&source, img); err != nil {
+		t.Fatalf("Error encoding source image: %v", err)
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(source.Bytes())
+	}))
+	defer server.Close()
+
+	store := storage.NewMemoryStore("https://cdn.example.com", "")
+	processor := imageprocessor.NewProcessor(store, localImageConfig())
+	sourceURL := server.URL + "/photo.png"
+	renditions, err := processor.ProcessImage(context.Background(), sourceURL, "medium")
+	if err != nil {
+		t.Fatalf("Error processing image: %v", err)
+	}
+
+	key := imageprocessor.RenditionKey(sourceURL, "medium", "jpeg")
+	if len(renditions) != 1 || renditions["medium"].URL != "https://cdn.example.com/"+key {
+		t.Errorf("Expected the stored image's URL, but got %+v", renditions)
+	}
+	body, info, err := store.Get(context.Background(), key)
+	if err != nil {
+		t.Fatalf("Error reading compressed image: %v", err)
+	}
+	defer body.Close()
+	compressed, err := jpeg.Decode(body)
+	if err != nil {
+		t.Fatalf("Expected a JPEG, but got %v", err)
+	}
+	if info.ContentType != "image/jpeg" || compressed.Bounds().Dx() != 800 || compressed.Bounds().Dy() != 600 {
+		t.Errorf("Expected an 800x600 JPEG, but got %s %v", info.ContentType, compressed.Bounds())
+	}
+}
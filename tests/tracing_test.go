@@ -0,0 +1,202 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"product-management/config"
+	imageprocessor "product-management/image-processor"
+	"product-management/models"
+	services "product-management/services"
+	"product-management/storage"
+	"product-management/tests/harness"
+	"product-management/tracing"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// recordSpans installs a tracer provider recording every span until the test ends
+func recordSpans(t *testing.T) *tracetest.SpanRecorder {
+	if _, err := tracing.Setup(context.Background(), config.Default().Tracing, ""); err != nil {
+		t.Fatalf("Error setting up tracing: %v", err)
+	}
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(provider)
+	t.Cleanup(func() {
+		otel.SetTracerProvider(previous)
+		provider.Shutdown(context.Background())
+	})
+	return recorder
+}
+
+// spansNamed returns the ended spans called name, oldest first
+func spansNamed(recorder *tracetest.SpanRecorder, name string) []sdktrace.ReadOnlySpan {
+	var spans []sdktrace.ReadOnlySpan
+	for _, span := range recorder.Ended() {
+		if span.Name() == name {
+			spans = append(spans, span)
+		}
+	}
+	return spans
+}
+
+func TestTraceFollowsImageJobsIntoTheWorker(t *testing.T) {
+	recorder := recordSpans(t)
+	h := harness.New(t)
+	ownerID := h.CreateUser("owner", models.RoleUser)
+
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	body := `{"product_name":"Lamp","product_price":40,"product_images":["http://example.com/a.jpg"]}`
+	req := httptest.NewRequest("POST", "/products", strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer "+h.Token(ownerID))
+	req.Header.Set("traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+	rr := httptest.NewRecorder()
+	h.Router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected status %v, but got %v: %s", http.StatusCreated, rr.Code, rr.Body.String())
+	}
+
+	attempts := 0
+	h.Queue.Drain(func(ctx context.Context, job imageprocessor.ImageJob) error {
+		attempts++
+		if got := trace.SpanContextFromContext(ctx).TraceID().String(); got != traceID {
+			t.Errorf("Expected the handler to run in trace %s, but got %s", traceID, got)
+		}
+		if attempts == 1 {
+			return errors.New("decode failed")
+		}
+		return nil
+	}, nil)
+
+	server := spansNamed(recorder, "POST /products")
+	if len(server) != 1 {
+		t.Fatalf("Expected 1 server span, but got %d", len(server))
+	}
+	if server[0].SpanKind() != trace.SpanKindServer || server[0].Parent().SpanID().String() != "00f067aa0ba902b7" {
+		t.Errorf("Expected a server span continuing the caller's, but got kind %v and parent %v", server[0].SpanKind(), server[0].Parent().SpanID())
+	}
+
+	publish := spansNamed(recorder, imageprocessor.QueueName+" publish")
+	process := spansNamed(recorder, imageprocessor.QueueName+" process")
+	if len(publish) != 1 || len(process) != 2 {
+		t.Fatalf("Expected 1 publish and 2 process spans, but got %d and %d", len(publish), len(process))
+	}
+	retry := spansNamed(recorder, fmt.Sprintf("%s.retry.%s publish", imageprocessor.QueueName, imageprocessor.RetryDelay(2)))
+	if len(retry) != 1 {
+		t.Fatalf("Expected 1 retry publish span, but got %d", len(retry))
+	}
+
+	chain := []struct {
+		name   string
+		span   sdktrace.ReadOnlySpan
+		parent sdktrace.ReadOnlySpan
+	}{
+		{name: "publish", span: publish[0], parent: server[0]},
+		{name: "first attempt", span: process[0], parent: publish[0]},
+		{name: "retry publish", span: retry[0], parent: process[0]},
+		{name: "second attempt", span: process[1], parent: retry[0]},
+	}
+	for _, link := range chain {
+		if got := link.span.SpanContext().TraceID().String(); got != traceID {
+			t.Errorf("%s: expected trace %s, but got %s", link.name, traceID, got)
+		}
+		if link.span.Parent().SpanID() != link.parent.SpanContext().SpanID() {
+			t.Errorf("%s: expected parent %s, but got %s", link.name, link.parent.Name(), link.span.Parent().SpanID())
+		}
+	}
+	if process[0].Status().Code != codes.Error || process[1].Status().Code == codes.Error {
+		t.Errorf("Expected only the failed attempt to be marked as an error, but got %v and %v", process[0].Status(), process[1].Status())
+	}
+}
+
+func TestTracedImageStages(t *testing.T) {
+	recorder := recordSpans(t)
+	source := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(truncatedPNG(t))
+	}))
+	defer source.Close()
+
+	processor := imageprocessor.NewProcessor(storage.NewMemoryStore("", ""), localImageConfig())
+	ctx, parent := tracing.Tracer().Start(context.Background(), "job")
+	_, err := processor.ProcessImage(ctx, source.URL+"/garbage.jpg")
+	parent.End()
+	if err == nil {
+		t.Fatalf("Expected the compression to fail")
+	}
+
+	download := spansNamed(recorder, "image download")
+	compress := spansNamed(recorder, "image compress")
+	if len(download) != 1 || len(compress) != 1 {
+		t.Fatalf("Expected one download and one compress span, but got %d and %d", len(download), len(compress))
+	}
+	for _, span := range []sdktrace.ReadOnlySpan{download[0], compress[0]} {
+		if span.Parent().SpanID() != parent.SpanContext().SpanID() {
+			t.Errorf("Expected %s to be a child of the job span", span.Name())
+		}
+	}
+	if download[0].Status().Code == codes.Error || compress[0].Status().Code != codes.Error {
+		t.Errorf("Expected only the compress stage to fail, but got %v and %v", download[0].Status(), compress[0].Status())
+	}
+	if uploads := spansNamed(recorder, "image upload"); len(uploads) != 0 {
+		t.Errorf("Expected no upload after a failed compression, but got %d spans", len(uploads))
+	}
+}
+
+func TestTracedSQLAndRedisCalls(t *testing.T) {
+	recorder := recordSpans(t)
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error creating sqlmock: %v", err)
+	}
+	defer db.Close()
+	expectCaller(mock, 7, models.RoleUser)
+	if _, err := services.NewPostgresUserRepository(db).GetByID(context.Background(), 7); err != nil {
+		t.Fatalf("Error reading user: %v", err)
+	}
+
+	selects := spansNamed(recorder, "postgres SELECT")
+	if len(selects) != 1 {
+		t.Fatalf("Expected 1 SELECT span, but got %d", len(selects))
+	}
+	attrs := map[string]string{}
+	for _, attr := range selects[0].Attributes() {
+		attrs[string(attr.Key)] = attr.Value.Emit()
+	}
+	if attrs["db.system"] != "postgresql" || !strings.HasPrefix(attrs["db.statement"], "SELECT id, username") {
+		t.Errorf("Expected the span to describe the statement, but got %v", attrs)
+	}
+
+	h := harness.New(t)
+	product := services.Product{UserID: 1, ProductName: "Desk", ProductPrice: 120}
+	if err := h.Products.Create(context.Background(), &product); err != nil {
+		t.Fatalf("Error creating product: %v", err)
+	}
+	h.DoJSON("GET", fmt.Sprintf("/products/%d", product.ID), "", h.CreateUser("reader", models.RoleUser), http.StatusOK, nil)
+
+	// The miss reads the product, then its generation before loading it
+	get := spansNamed(recorder, "redis get")
+	if len(get) != 2 {
+		t.Fatalf("Expected 2 Redis GET spans, but got %d", len(get))
+	}
+	server := spansNamed(recorder, "GET /products/{id}")
+	for _, span := range get {
+		if span.Status().Code == codes.Error {
+			t.Errorf("Expected a cache miss not to be recorded as an error, but got %v", span.Status())
+		}
+		if len(server) != 1 || span.Parent().SpanID() != server[0].SpanContext().SpanID() {
+			t.Errorf("Expected the Redis calls to be children of the request span")
+		}
+	}
+}
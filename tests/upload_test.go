@@ -0,0 +1,267 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/gif"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"product-management/api"
+	"product-management/config"
+	imageprocessor "product-management/image-processor"
+	"product-management/models"
+	services "product-management/services"
+	"product-management/tests/harness"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+// uploadFile is one file field of a multipart upload
+type uploadFile struct {
+	field, name string
+	data        []byte
+}
+
+// postMultipart uploads files to the images of a product through router
+func postMultipart(t *testing.T, router *mux.Router, h *harness.Harness, productID, userID int, files ...uploadFile) *httptest.ResponseRecorder {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	if err := writer.WriteField("caption", "ignored"); err != nil {
+		t.Fatalf("Error writing field: %v", err)
+	}
+	for _, file := range files {
+		part, err := writer.CreateFormFile(file.field, file.name)
+		if err != nil {
+			t.Fatalf("Error creating form file: %v", err)
+		}
+		part.Write(file.data)
+	}
+	writer.Close()
+
+	req := httptest.NewRequest("POST", fmt.Sprintf("/products/%d/images", productID), &body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	req.Header.Set("Authorization", "Bearer "+h.Token(userID))
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	return rr
+}
+
+// uploadKeys lists the keys of the uploaded source images in the harness store
+func uploadKeys(h *harness.Harness) []string {
+	var keys []string
+	for _, key := range h.Store.Keys() {
+		if strings.HasPrefix(key, imageprocessor.UploadPrefix) {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+func TestUploadProductImages(t *testing.T) {
+	h := harness.New(t)
+	ownerID := h.CreateUser("owner", models.RoleUser)
+	var product services.Product
+	h.DoJSON("POST", "/products", `{"product_name":"Lamp","product_price":40,"product_images":["http://example.com/a.jpg"]}`, ownerID, http.StatusCreated, &product)
+
+	var gifData bytes.Buffer
+	if err := gif.Encode(&gifData, image.NewGray(image.Rect(0, 0, 300, 200)), nil); err != nil {
+		t.Fatalf("Error encoding GIF: %v", err)
+	}
+	rr := postMultipart(t, h.Router, h, product.ID, ownerID,
+		uploadFile{field: "image", name: "front.png", data: encodePNG(t, 400, 300)},
+		uploadFile{field: "image", name: "back.jpg", data: gifData.Bytes()},
+	)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected status %v, but got %v: %s", http.StatusCreated, rr.Code, rr.Body.String())
+	}
+	var updated services.Product
+	if err := json.NewDecoder(rr.Body).Decode(&updated); err != nil {
+		t.Fatalf("Error decoding product: %v", err)
+	}
+	if len(updated.ProductImages) != 3 || len(updated.Images) != 3 || updated.ProductImages[0] != "http://example.com/a.jpg" {
+		t.Fatalf("Expected the uploads to follow the existing image, but got %q", updated.ProductImages)
+	}
+
+	// The content type and extension come from the content, not the file name
+	keys := uploadKeys(h)
+	if len(keys) != 2 {
+		t.Fatalf("Expected 2 stored uploads, but got %q", keys)
+	}
+	for i, format := range []string{"png", "gif"} {
+		key, ok := imageprocessor.UploadedKey(h.Store, updated.ProductImages[i+1])
+		if !ok || !strings.HasPrefix(key, fmt.Sprintf("uploads/%d/%d/", ownerID, product.ID)) || !strings.HasSuffix(key, "."+format) {
+			t.Errorf("Expected a %s upload of the product, but got %s", format, updated.ProductImages[i+1])
+			continue
+		}
+		body, info, err := h.Store.Get(context.Background(), key)
+		if err != nil {
+			t.Fatalf("Error reading upload: %v", err)
+		}
+		body.Close()
+		if info.ContentType != imageprocessor.SourceContentType(format) {
+			t.Errorf("Expected %s, but got %s", imageprocessor.SourceContentType(format), info.ContentType)
+		}
+	}
+
+	jobs := h.Queue.Jobs()
+	if len(jobs) != 3 || jobs[1].ImageIndex != 1 || jobs[1].SourceURL != updated.ProductImages[1] || jobs[2].ImageIndex != 2 {
+		t.Fatalf("Expected jobs for images 1 and 2, but got %+v", jobs)
+	}
+	var status services.ProductImageStatus
+	h.DoJSON("GET", fmt.Sprintf("/products/%d/images/status", product.ID), "", ownerID, http.StatusOK, &status)
+	if len(status.Images) != 3 || status.Images[2].Status != services.ImageStatusPending {
+		t.Errorf("Expected the uploads to be pending, but got %+v", status.Images)
+	}
+
+	// Uploads are read from the store; fetching localhost would be refused
+	processor := imageprocessor.NewProcessor(h.Store, h.Config.Image)
+	renditions, err := processor.ProcessImage(context.Background(), jobs[1].SourceURL)
+	if err != nil {
+		t.Fatalf("Error processing upload: %v", err)
+	}
+	if renditions[h.Config.Image.PrimaryRendition].URL == "" {
+		t.Errorf("Expected the primary rendition, but got %+v", renditions)
+	}
+
+	// Stored objects are served from the same URLs
+	h.DoJSON("GET", strings.TrimPrefix(updated.ProductImages[1], "http://localhost"), "", 0, http.StatusOK, nil)
+}
+
+func TestUploadProductImagesRejects(t *testing.T) {
+	h := harness.New(t)
+	ownerID := h.CreateUser("owner", models.RoleUser)
+	otherID := h.CreateUser("other", models.RoleUser)
+	var product services.Product
+	h.DoJSON("POST", "/products", `{"product_name":"Lamp","product_price":40}`, ownerID, http.StatusCreated, &product)
+
+	imagecfg := h.Config.Image
+	imagecfg.MaxBytes = 4096
+	imagecfg.MaxPixels = 10000
+	router := api.NewRouter(api.Dependencies{Products: h.Products, Users: h.Users, Queue: h.Queue, Tokens: h.Tokens, Store: h.Store, Image: imagecfg})
+	withoutStore := api.NewRouter(api.Dependencies{Products: h.Products, Users: h.Users, Queue: h.Queue, Tokens: h.Tokens})
+	large := append(encodePNG(t, 90, 90), bytes.Repeat([]byte{0}, 8192)...)
+
+	tests := []struct {
+		name   string
+		router *mux.Router
+		userID int
+		files  []uploadFile
+		status int
+	}{
+		{name: "not the owner", router: router, userID: otherID, files: []uploadFile{{field: "image", name: "a.png", data: encodePNG(t, 8, 8)}}, status: http.StatusForbidden},
+		{name: "not an image", router: router, userID: ownerID, files: []uploadFile{{field: "image", name: "a.png", data: []byte("<html>hello</html>")}}, status: http.StatusUnsupportedMediaType},
+		{name: "too many pixels", router: router, userID: ownerID, files: []uploadFile{{field: "image", name: "a.png", data: encodePNG(t, 200, 100)}}, status: http.StatusRequestEntityTooLarge},
+		{name: "too many bytes", router: router, userID: ownerID, files: []uploadFile{{field: "image", name: "a.png", data: large}}, status: http.StatusRequestEntityTooLarge},
+		{name: "no image field", router: router, userID: ownerID, files: []uploadFile{{field: "photo", name: "a.png", data: encodePNG(t, 8, 8)}}, status: http.StatusBadRequest},
+		{name: "no store", router: withoutStore, userID: ownerID, files: []uploadFile{{field: "image", name: "a.png", data: encodePNG(t, 8, 8)}}, status: http.StatusServiceUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := postMultipart(t, tt.router, h, product.ID, tt.userID, tt.files...)
+			if rr.Code != tt.status {
+				t.Errorf("Expected status %v, but got %v: %s", tt.status, rr.Code, rr.Body.String())
+			}
+		})
+	}
+
+	h.DoJSON("POST", fmt.Sprintf("/products/%d/images", product.ID), `{"image":"a.png"}`, ownerID, http.StatusBadRequest, nil)
+	if keys := uploadKeys(h); len(keys) != 0 {
+		t.Errorf("Expected rejected uploads to be removed, but got %q", keys)
+	}
+	if stored, _ := h.Products.GetByID(context.Background(), product.ID); len(stored.ProductImages) != 0 {
+		t.Errorf("Expected no images to be added, but got %q", stored.ProductImages)
+	}
+}
+
+func TestPresignedImageUpload(t *testing.T) {
+	h := harness.New(t)
+	ownerID := h.CreateUser("owner", models.RoleUser)
+	adminID := h.CreateUser("admin", models.RoleAdmin)
+	otherID := h.CreateUser("other", models.RoleUser)
+	var product services.Product
+	h.DoJSON("POST", "/products", `{"product_name":"Lamp","product_price":40}`, ownerID, http.StatusCreated, &product)
+	base := fmt.Sprintf("/products/%d/images/uploads", product.ID)
+
+	// put uploads data through an upload link handed out by the API
+	put := func(uploadURL string, data []byte) int {
+		link, err := url.Parse(uploadURL)
+		if err != nil {
+			t.Fatalf("Error parsing upload URL: %v", err)
+		}
+		req := httptest.NewRequest("PUT", link.RequestURI(), bytes.NewReader(data))
+		req.Header.Set("Content-Type", "image/png")
+		rr := httptest.NewRecorder()
+		h.Router.ServeHTTP(rr, req)
+		return rr.Code
+	}
+	var upload struct {
+		Key       string            `json:"key"`
+		UploadURL string            `json:"upload_url"`
+		Method    string            `json:"method"`
+		Headers   map[string]string `json:"headers"`
+	}
+	data := encodePNG(t, 64, 48)
+	h.DoJSON("POST", base, fmt.Sprintf(`{"content_type":"image/png","size":%d}`, len(data)), ownerID, http.StatusOK, &upload)
+	if upload.Method != "PUT" || upload.Headers["Content-Type"] != "image/png" || upload.Headers["Content-Length"] != strconv.Itoa(len(data)) ||
+		!strings.HasPrefix(upload.Key, fmt.Sprintf("uploads/%d/%d/", ownerID, product.ID)) || !strings.HasPrefix(upload.UploadURL, harness.StorageURL+"/"+upload.Key+"?") {
+		t.Fatalf("Unexpected upload %+v", upload)
+	}
+	h.DoJSON("POST", base, `{"content_type":"text/html","size":100}`, ownerID, http.StatusBadRequest, nil)
+	h.DoJSON("POST", base, `{"content_type":"image/png"}`, ownerID, http.StatusBadRequest, nil)
+	h.DoJSON("POST", base, fmt.Sprintf(`{"content_type":"image/png","size":%d}`, config.Default().Image.MaxBytes+1), ownerID, http.StatusRequestEntityTooLarge, nil)
+
+	// Nothing has been uploaded yet
+	complete := fmt.Sprintf(`{"key":%q}`, upload.Key)
+	h.DoJSON("POST", base+"/complete", complete, ownerID, http.StatusNotFound, nil)
+
+	if code := put(strings.Replace(upload.UploadURL, "signature=", "signature=0", 1), data); code != http.StatusForbidden {
+		t.Errorf("Expected a tampered link to be refused, but got %v", code)
+	}
+	if code := put(strings.Replace(upload.UploadURL, "size=", "size=1", 1), data); code != http.StatusForbidden {
+		t.Errorf("Expected a link with another size to be refused, but got %v", code)
+	}
+	if code := put(upload.UploadURL, append(data, 0)); code != http.StatusBadRequest {
+		t.Errorf("Expected a larger body than signed for to be refused, but got %v", code)
+	}
+	// Only the caller's own uploads can be reported, even by an admin
+	h.DoJSON("POST", base+"/complete", complete, adminID, http.StatusBadRequest, nil)
+	if code := put(upload.UploadURL, data); code != http.StatusOK {
+		t.Fatalf("Expected the upload to be stored, but got %v", code)
+	}
+
+	var updated services.Product
+	h.DoJSON("POST", base+"/complete", complete, ownerID, http.StatusCreated, &updated)
+	if len(updated.ProductImages) != 1 || updated.ProductImages[0] != h.Store.URL(upload.Key) {
+		t.Fatalf("Expected the upload to be added, but got %q", updated.ProductImages)
+	}
+	if jobs := h.Queue.Jobs(); len(jobs) != 1 || jobs[0].SourceURL != updated.ProductImages[0] {
+		t.Errorf("Expected a job for the upload, but got %+v", jobs)
+	}
+	h.DoJSON("POST", base+"/complete", complete, ownerID, http.StatusConflict, nil)
+	h.DoJSON("POST", base+"/complete", fmt.Sprintf(`{"key":"uploads/%d/999/a.png"}`, ownerID), ownerID, http.StatusBadRequest, nil)
+	h.DoJSON("POST", base+"/complete", fmt.Sprintf(`{"key":"uploads/%d/%d/../../999/a.png"}`, ownerID, product.ID), ownerID, http.StatusBadRequest, nil)
+
+	// Another user cannot attach the upload to a product of their own
+	attach := fmt.Sprintf(`{"product_name":"Copy","product_price":1,"product_images":[%q]}`, updated.ProductImages[0])
+	h.DoJSON("POST", "/products", attach, otherID, http.StatusForbidden, nil)
+	h.DoJSON("POST", "/products", attach, ownerID, http.StatusCreated, nil)
+
+	// Content that is not an image is deleted when it is reported
+	html := []byte("<html>hello</html>")
+	h.DoJSON("POST", base, fmt.Sprintf(`{"content_type":"image/png","size":%d}`, len(html)), ownerID, http.StatusOK, &upload)
+	if code := put(upload.UploadURL, html); code != http.StatusOK {
+		t.Fatalf("Expected the upload to be stored, but got %v", code)
+	}
+	h.DoJSON("POST", base+"/complete", fmt.Sprintf(`{"key":%q}`, upload.Key), ownerID, http.StatusUnsupportedMediaType, nil)
+	if keys := uploadKeys(h); len(keys) != 1 {
+		t.Errorf("Expected only the accepted upload to be kept, but got %q", keys)
+	}
+}
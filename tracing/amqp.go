@@ -0,0 +1,56 @@
+package tracing
+
+import (
+	"context"
+
+	"github.com/streadway/amqp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// headerCarrier reads and writes trace context in AMQP message headers
+type headerCarrier amqp.Table
+
+func (c headerCarrier) Get(key string) string {
+	value, _ := c[key].(string)
+	return value
+}
+
+func (c headerCarrier) Set(key, value string) {
+	c[key] = value
+}
+
+func (c headerCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for key := range c {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// InjectHeaders returns a copy of headers carrying the trace context of ctx
+func InjectHeaders(ctx context.Context, headers amqp.Table) amqp.Table {
+	injected := amqp.Table{}
+	for key, value := range headers {
+		injected[key] = value
+	}
+	otel.GetTextMapPropagator().Inject(ctx, headerCarrier(injected))
+	return injected
+}
+
+// ExtractHeaders returns a copy of ctx continuing the trace carried by headers
+func ExtractHeaders(ctx context.Context, headers amqp.Table) context.Context {
+	return otel.GetTextMapPropagator().Extract(ctx, headerCarrier(headers))
+}
+
+// InjectMap and ExtractMap do the same for in-memory messages
+func InjectMap(ctx context.Context) map[string]string {
+	carrier := propagation.MapCarrier{}
+	otel.GetTextMapPropagator().Inject(ctx, carrier)
+	return carrier
+}
+
+// ExtractMap returns a copy of ctx continuing the trace carried by headers
+func ExtractMap(ctx context.Context, headers map[string]string) context.Context {
+	return otel.GetTextMapPropagator().Extract(ctx, propagation.MapCarrier(headers))
+}
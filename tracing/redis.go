@@ -0,0 +1,60 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+
+	"github.com/go-redis/redis/v8"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// RedisHook runs every Redis command and pipeline in a client span. A missing key
+// is a normal outcome and is not recorded as an error.
+type RedisHook struct{}
+
+// BeforeProcess starts the span for one command
+func (RedisHook) BeforeProcess(ctx context.Context, cmd redis.Cmder) (context.Context, error) {
+	ctx, _ = startRedis(ctx, cmd.Name(), attribute.String("db.operation", cmd.Name()))
+	return ctx, nil
+}
+
+// AfterProcess ends the span for one command
+func (RedisHook) AfterProcess(ctx context.Context, cmd redis.Cmder) error {
+	endRedis(ctx, cmd.Err())
+	return nil
+}
+
+// BeforeProcessPipeline starts one span for a whole pipeline
+func (RedisHook) BeforeProcessPipeline(ctx context.Context, cmds []redis.Cmder) (context.Context, error) {
+	ctx, _ = startRedis(ctx, "pipeline", attribute.Int("db.redis.pipeline_length", len(cmds)))
+	return ctx, nil
+}
+
+// AfterProcessPipeline ends the span for a pipeline with its first error, if any
+func (RedisHook) AfterProcessPipeline(ctx context.Context, cmds []redis.Cmder) error {
+	var err error
+	for _, cmd := range cmds {
+		if cmdErr := cmd.Err(); cmdErr != nil && !errors.Is(cmdErr, redis.Nil) {
+			err = cmdErr
+			break
+		}
+	}
+	endRedis(ctx, err)
+	return nil
+}
+
+func startRedis(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return Tracer().Start(ctx, "redis "+name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(append(attrs, attribute.String("db.system", "redis"))...),
+	)
+}
+
+func endRedis(ctx context.Context, err error) {
+	span := trace.SpanFromContext(ctx)
+	if !errors.Is(err, redis.Nil) {
+		RecordError(span, err)
+	}
+	span.End()
+}
@@ -0,0 +1,66 @@
+package tracing
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// DB wraps a Postgres pool so every query runs in a client span carrying its
+// parameterised statement; argument values are never recorded
+type DB struct {
+	db *sql.DB
+}
+
+// WrapDB returns a DB tracing the queries made through db
+func WrapDB(db *sql.DB) *DB {
+	return &DB{db: db}
+}
+
+// QueryContext runs a query returning rows. The span covers executing the query,
+// not reading the rows.
+func (d *DB) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	ctx, span := startQuery(ctx, query)
+	defer span.End()
+	rows, err := d.db.QueryContext(ctx, query, args...)
+	RecordError(span, err)
+	return rows, err
+}
+
+// QueryRowContext runs a query returning at most one row. Errors surface from
+// Row.Scan, so the span only records those reported by Row.Err.
+func (d *DB) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	ctx, span := startQuery(ctx, query)
+	defer span.End()
+	row := d.db.QueryRowContext(ctx, query, args...)
+	RecordError(span, row.Err())
+	return row
+}
+
+// ExecContext runs a statement returning no rows
+func (d *DB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	ctx, span := startQuery(ctx, query)
+	defer span.End()
+	result, err := d.db.ExecContext(ctx, query, args...)
+	RecordError(span, err)
+	return result, err
+}
+
+// startQuery starts a span named after the statement's operation, such as SELECT
+func startQuery(ctx context.Context, query string) (context.Context, trace.Span) {
+	operation := "query"
+	if fields := strings.Fields(query); len(fields) > 0 {
+		operation = strings.ToUpper(fields[0])
+	}
+	return Tracer().Start(ctx, "postgres "+operation,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("db.system", "postgresql"),
+			attribute.String("db.operation", operation),
+			attribute.String("db.statement", query),
+		),
+	)
+}
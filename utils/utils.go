@@ -2,9 +2,11 @@ package utils
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 )
 
 // RespondWithError sends an error response with a specific message and status code
@@ -25,3 +27,56 @@ func ParsePrice(price string) (float64, error) {
 	price = strings.TrimSpace(price)
 	return strconv.ParseFloat(price, 64)
 }
+
+// ParseID converts a path parameter to a positive integer ID
+func ParseID(id string) (int, error) {
+	value, err := strconv.Atoi(strings.TrimSpace(id))
+	if err != nil {
+		return 0, err
+	}
+	if value <= 0 {
+		return 0, fmt.Errorf("id must be positive, got %d", value)
+	}
+	return value, nil
+}
+
+// MergePatch applies a JSON merge patch (RFC 7396) to a JSON document
+func MergePatch(original, patch []byte) ([]byte, error) {
+	var target, changes interface{}
+	if err := json.Unmarshal(original, &target); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(patch, &changes); err != nil {
+		return nil, err
+	}
+	return json.Marshal(mergeValues(target, changes))
+}
+
+// mergeValues recursively merges patch into target, deleting keys set to null
+func mergeValues(target, patch interface{}) interface{} {
+	patchObject, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	targetObject, ok := target.(map[string]interface{})
+	if !ok {
+		targetObject = map[string]interface{}{}
+	}
+	for key, value := range patchObject {
+		if value == nil {
+			delete(targetObject, key)
+			continue
+		}
+		targetObject[key] = mergeValues(targetObject[key], value)
+	}
+	return targetObject
+}
+
+// ParseTime accepts an RFC 3339 timestamp or a YYYY-MM-DD date (midnight UTC)
+func ParseTime(value string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.Parse("2006-01-02", value)
+}